@@ -1,9 +1,11 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	_ "github.com/golang-migrate/migrate/v4/database/postgres"
@@ -15,12 +17,14 @@ import (
 	authv1 "github.com/nullexp/finman-api-gateway/internal/adapter/grpc/auth/v1"
 	txv1 "github.com/nullexp/finman-api-gateway/internal/adapter/grpc/transaction/v1"
 	userv1 "github.com/nullexp/finman-api-gateway/internal/adapter/grpc/user/v1"
+	"github.com/nullexp/finman-api-gateway/pkg/infrastructure/grpc/interceptor"
 
 	"github.com/nullexp/finman-api-gateway/internal/adapter/http"
 	ginapi "github.com/nullexp/finman-api-gateway/pkg/infrastructure/http/gin"
 	"github.com/nullexp/finman-api-gateway/pkg/infrastructure/http/protocol/model"
 	"github.com/nullexp/finman-api-gateway/pkg/infrastructure/http/protocol/model/openapi"
 	logger "github.com/nullexp/finman-api-gateway/pkg/infrastructure/log"
+	"github.com/nullexp/finman-api-gateway/pkg/infrastructure/misc"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
 )
@@ -40,22 +44,43 @@ func main() {
 	txUrl := os.Getenv("FINMAN_TRANSACTION_URL")
 
 	jwtSecret := os.Getenv("JWT_SECRET")
+	jwtExpireMinute, err := strconv.Atoi(os.Getenv("JWT_EXPIRE_MINUTE"))
+	if err != nil {
+		log.Fatalln(err)
+	}
+	refreshExpireHour := envInt("REFRESH_EXPIRE_HOUR", 720)
 	port := os.Getenv("PORT")
 	ip := os.Getenv("IP")
 
-	authConn, err := establishGRPCConnection(authUrl, 10)
+	retryConfig := interceptor.RetryConfig{}
+	if retryFile := os.Getenv("RETRY_POLICY_FILE"); retryFile != "" {
+		retryConfig, err = interceptor.LoadRetryConfig(retryFile)
+		if err != nil {
+			log.Fatalln(err)
+		}
+	}
+	err = retryConfig.Validate(map[string][]grpc.ServiceDesc{
+		"auth":        {authv1.AuthService_ServiceDesc},
+		"user":        {userv1.UserService_ServiceDesc, userv1.RoleService_ServiceDesc},
+		"transaction": {txv1.TransactionService_ServiceDesc},
+	})
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	authConn, err := establishGRPCConnection(authUrl, 10, retryConfig.Service("auth"))
 	if err != nil {
 		log.Fatalf("Failed to connect: %v", err)
 	}
 	defer authConn.Close()
 
-	userConn, err := establishGRPCConnection(userUrl, 10)
+	userConn, err := establishGRPCConnection(userUrl, 10, retryConfig.Service("user"))
 	if err != nil {
 		log.Fatalf("Failed to connect: %v", err)
 	}
 	defer authConn.Close()
 
-	transactionConn, err := establishGRPCConnection(txUrl, 10)
+	transactionConn, err := establishGRPCConnection(txUrl, 10, retryConfig.Service("transaction"))
 	if err != nil {
 		log.Fatalf("Failed to connect: %v", err)
 	}
@@ -65,10 +90,123 @@ func main() {
 	userClient := userv1.NewUserServiceClient(userConn)
 	roleClient := userv1.NewRoleServiceClient(userConn)
 	txClient := txv1.NewTransactionServiceClient(transactionConn)
-	tokenService := adapter.NewTokenService(jwtSecret, 10)
+	tokenService := adapter.NewTokenService(jwtSecret, time.Duration(jwtExpireMinute)*time.Minute)
+	keyStoreFile := os.Getenv("JWT_KEY_STORE_FILE")
+	if keyStoreFile != "" {
+		err = tokenService.KeyRing().SetStore(adapter.NewFileSigningKeyStore(keyStoreFile))
+		if err != nil {
+			log.Fatalln(err)
+		}
+	}
+	// the configured key signs until the store holds an active key of its own
+	if _, ok := tokenService.KeyRing().Active(); !ok {
+		if keyFile := os.Getenv("JWT_SIGNING_KEY_FILE"); keyFile != "" {
+			signingKey, err := adapter.LoadSigningKey(os.Getenv("JWT_SIGNING_KEY_ID"), os.Getenv("JWT_SIGNING_ALG"), keyFile)
+			if err != nil {
+				log.Fatalln(err)
+			}
+			err = tokenService.SetSigningKey(signingKey)
+			if err != nil {
+				log.Fatalln(err)
+			}
+		}
+	}
+	if rotateHour, _ := strconv.Atoi(os.Getenv("JWT_ROTATE_HOUR")); rotateHour > 0 {
+		if keyStoreFile == "" {
+			log.Fatalln("JWT_ROTATE_HOUR needs JWT_KEY_STORE_FILE, rotated keys would not survive a restart")
+		}
+		go tokenService.KeyRing().RunRotation(context.Background(), time.Duration(rotateHour)*time.Hour, os.Getenv("JWT_ROTATE_ALG"))
+	}
+	jwtIssuer := os.Getenv("JWT_ISSUER")
+	jwtAudience := splitList(os.Getenv("JWT_AUDIENCE"))
+	jwtLeewaySecond, _ := strconv.Atoi(os.Getenv("JWT_LEEWAY_SECOND"))
+	tokenService.SetIssuer(jwtIssuer, jwtAudience...)
+	claimsPolicy := misc.ClaimsPolicy{
+		Issuers:   splitList(os.Getenv("JWT_TRUSTED_ISSUERS")),
+		Audiences: jwtAudience,
+		Leeway:    time.Duration(jwtLeewaySecond) * time.Second,
+	}
+	if jwtIssuer != "" {
+		claimsPolicy.Issuers = append(claimsPolicy.Issuers, jwtIssuer)
+	}
+	bearerAuthenticator := adapter.NewIssuerAuthenticator(tokenService)
+	if oidcIssuer := os.Getenv("OIDC_ISSUER"); oidcIssuer != "" {
+		oidcConfig := adapter.OidcConfig{
+			Issuer:      oidcIssuer,
+			Discovery:   os.Getenv("OIDC_DISCOVERY"),
+			Jwks:        os.Getenv("OIDC_JWKS"),
+			Audiences:   splitList(os.Getenv("OIDC_AUDIENCE")),
+			GroupsClaim: os.Getenv("OIDC_GROUPS_CLAIM"),
+		}
+		oidcConfig.Mapping, err = adapter.LoadOidcMapping(os.Getenv("OIDC_MAPPING_FILE"))
+		if err != nil {
+			log.Fatalln(err)
+		}
+		oidcAuthenticator, err := adapter.NewOidcAuthenticator(oidcConfig)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		bearerAuthenticator.AppendIssuer(oidcIssuer, oidcAuthenticator)
+		// Empty lists accept anything, only extend lists that restrict
+		if len(claimsPolicy.Issuers) != 0 {
+			claimsPolicy.Issuers = append(claimsPolicy.Issuers, oidcIssuer)
+		}
+		if len(claimsPolicy.Audiences) != 0 {
+			claimsPolicy.Audiences = append(claimsPolicy.Audiences, oidcConfig.Audiences...)
+		}
+	}
+	if impersonationMinute, _ := strconv.Atoi(os.Getenv("IMPERSONATION_EXPIRE_MINUTE")); impersonationMinute > 0 {
+		tokenService.SetImpersonationExpireAfter(time.Duration(impersonationMinute) * time.Minute)
+	}
+	refreshStore := adapter.NewMemoryRefreshTokenStore()
+	tokenService.SetRefreshStore(refreshStore, time.Duration(refreshExpireHour)*time.Hour)
+	revocationList := adapter.NewMemoryRevocationList(refreshStore, time.Duration(jwtExpireMinute)*time.Minute)
 
-	api.AppendAuthenticator("/", tokenService)
-	api.AppendAuthorizer("/", adapter.NewAuthorizer(roleClient, tokenService))
+	permissionCacheSize := envInt("PERMISSION_CACHE_SIZE", 10000)
+	permissionCacheSecond := envInt("PERMISSION_CACHE_SECOND", 60)
+	permissionCacheNegativeSecond := envInt("PERMISSION_CACHE_NEGATIVE_SECOND", 10)
+	permissionCache := adapter.NewPermissionCache(permissionCacheSize, time.Duration(permissionCacheSecond)*time.Second, time.Duration(permissionCacheNegativeSecond)*time.Second)
+
+	lockoutPolicy := adapter.DefaultLockoutPolicy()
+	if maxFailures, _ := strconv.Atoi(os.Getenv("LOGIN_MAX_FAILURES")); maxFailures > 0 {
+		lockoutPolicy.MaxFailures = maxFailures
+	}
+	if ipMaxFailures, _ := strconv.Atoi(os.Getenv("LOGIN_IP_MAX_FAILURES")); ipMaxFailures > 0 {
+		lockoutPolicy.IpMaxFailures = ipMaxFailures
+	}
+	if lockoutSecond, _ := strconv.Atoi(os.Getenv("LOGIN_LOCKOUT_SECOND")); lockoutSecond > 0 {
+		lockoutPolicy.Lockout = time.Duration(lockoutSecond) * time.Second
+	}
+	if maxLockoutMinute, _ := strconv.Atoi(os.Getenv("LOGIN_MAX_LOCKOUT_MINUTE")); maxLockoutMinute > 0 {
+		lockoutPolicy.MaxLockout = time.Duration(maxLockoutMinute) * time.Minute
+	}
+
+	apiKeyService := adapter.NewApiKeyService(adapter.NewMemoryApiKeyStore())
+	oauthClients := adapter.NewMemoryOAuthClientStore()
+	if clientsFile := os.Getenv("OAUTH_CLIENTS_FILE"); clientsFile != "" {
+		oauthClients, err = adapter.LoadOAuthClients(clientsFile)
+		if err != nil {
+			log.Fatalln(err)
+		}
+	}
+	oauthServer := adapter.NewOAuthServer(oauthClients, misc.NewSha256Password(os.Getenv("OAUTH_CLIENT_SECRET_PEPPER")), tokenService, claimsPolicy, revocationList)
+
+	api.AppendAuthenticator("/", bearerAuthenticator)
+	api.AppendSchemeAuthenticator("/", ginapi.ApiKey, apiKeyService)
+	batchAuthorizer := adapter.NewBatchAuthorizer(roleClient, oauthClients, tokenService, permissionCache)
+	api.AppendBatchAuthorizer("/", batchAuthorizer)
+	api.SetOwnerResolver(adapter.NewOwnerResolver())
+	if policyFile := os.Getenv("PERMISSION_POLICY_FILE"); policyFile != "" {
+		api.SetPolicyFile(policyFile, time.Duration(envInt("PERMISSION_POLICY_RELOAD_SECOND", 10))*time.Second)
+	}
+	api.SetDefaultTimeout(time.Duration(envInt("REQUEST_TIMEOUT_SECOND", 30)) * time.Second)
+	api.SetTrustedProxies(splitList(os.Getenv("TRUSTED_PROXIES")))
+	if forwardedHeaders, ok := os.LookupEnv("FORWARDED_HEADERS"); ok {
+		api.SetForwardedHeaders(splitList(forwardedHeaders))
+	}
+	api.SetRevocationList(revocationList)
+	api.SetClaimsPolicy(claimsPolicy)
+	api.SetAuditHandler(adapter.NewAuditLogger())
 
 	api.SetContact(openapi.Contact{Name: "Hope Golestany", Email: "hopegolestany@gmail.com", URL: "https://github.com/nullexp"})
 	api.SetInfo(openapi.Info{Version: "1", Description: "This is the API documentation for the FinMan User Service. Use these APIs to access and manage user resources", Title: "Finman Api Definition"})
@@ -78,18 +216,33 @@ func main() {
 		log.Fatalln(err)
 	}
 
-	auth := http.NewSession(authClient)
+	auth := http.NewSession(authClient, userClient, tokenService, revocationList, adapter.NewLoginGuard(adapter.NewMemoryLoginAttemptStore(), lockoutPolicy))
 	api.AppendModule(auth)
 
-	user := http.NewUser(userClient, tokenService)
+	user := http.NewUser(userClient, tokenService, revocationList, permissionCache)
 	api.AppendModule(user)
 
-	role := http.NewRole(roleClient)
+	role := http.NewRole(roleClient, permissionCache)
 	api.AppendModule(role)
 
 	tx := http.NewTransaction(txClient, tokenService)
 	api.AppendModule(tx)
 
+	jwks := http.NewJwks(tokenService)
+	api.AppendModule(jwks)
+
+	keys := http.NewKey(tokenService.KeyRing())
+	api.AppendModule(keys)
+
+	apiKeys := http.NewApiKey(apiKeyService, userClient, tokenService, batchAuthorizer)
+	api.AppendModule(apiKeys)
+
+	oauth := http.NewOAuth(oauthServer)
+	api.AppendModule(oauth)
+
+	permissions := http.NewPermission(api, batchAuthorizer)
+	api.AppendModule(permissions)
+
 	portValue, err := strconv.Atoi(port)
 	if err != nil {
 		log.Fatalln(err)
@@ -105,13 +258,18 @@ func main() {
 	}
 }
 
-// establishGRPCConnection establishes a gRPC connection with retry mechanism
-func establishGRPCConnection(serverAddr string, retryAttempts int) (*grpc.ClientConn, error) {
+// establishGRPCConnection establishes a gRPC connection with retry mechanism, calls on it send the
+// origin of the request they are made for as metadata and are retried by the policy of the service
+func establishGRPCConnection(serverAddr string, retryAttempts int, retryPolicy interceptor.ServiceRetryPolicy) (*grpc.ClientConn, error) {
 	var conn *grpc.ClientConn
 	var err error
 
 	for i := 0; i < retryAttempts; i++ {
-		conn, err = grpc.NewClient(serverAddr, grpc.WithTransportCredentials(insecure.NewCredentials())) // insecure for test purpose
+		conn, err = grpc.NewClient(serverAddr,
+			grpc.WithTransportCredentials(insecure.NewCredentials()), // insecure for test purpose
+			grpc.WithChainUnaryInterceptor(interceptor.UnaryOrigin(), interceptor.UnaryRetry(retryPolicy)),
+			grpc.WithChainStreamInterceptor(interceptor.StreamOrigin()),
+		)
 		if err == nil {
 			log.Println("connected")
 			return conn, nil
@@ -121,3 +279,23 @@ func establishGRPCConnection(serverAddr string, retryAttempts int) (*grpc.Client
 	}
 	return nil, err
 }
+
+// splitList parses a comma separated environment value, an empty value gives an empty list
+func splitList(value string) []string {
+	out := []string{}
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// envInt parses an integer environment value, an empty or invalid value gives def
+func envInt(key string, def int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return def
+	}
+	return value
+}
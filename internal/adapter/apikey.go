@@ -0,0 +1,172 @@
+package adapter
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	driven "github.com/nullexp/finman-api-gateway/internal/port"
+	"github.com/nullexp/finman-api-gateway/internal/port/model"
+	"github.com/nullexp/finman-api-gateway/pkg/infrastructure/misc"
+)
+
+const (
+	apiKeySize   = 32
+	apiKeyPrefix = "fmk_"
+	// apiKeySessionAge bounds the claim of keys without expiry, so websockets opened with them reconnect now and then.
+	apiKeySessionAge = time.Hour
+)
+
+// ApiKeyService authenticates machine clients by api key and manages the keys.
+type ApiKeyService struct {
+	store driven.ApiKeyStore
+}
+
+func NewApiKeyService(store driven.ApiKeyStore) *ApiKeyService {
+	return &ApiKeyService{store: store}
+}
+
+// CreateApiKey returns the plain key, which is shown only once, and its stored description.
+func (s *ApiKeyService) CreateApiKey(name string, sb model.Subject, scopes []string, expiresAt int64) (string, model.ApiKey, error) {
+	raw := make([]byte, apiKeySize)
+	if _, err := rand.Read(raw); err != nil {
+		return "", model.ApiKey{}, err
+	}
+	key := apiKeyPrefix + base64.RawURLEncoding.EncodeToString(raw)
+
+	info := model.ApiKey{
+		Id:        uuid.NewString(),
+		Name:      name,
+		Hash:      hashToken(key),
+		Subject:   sb,
+		Scopes:    scopes,
+		CreatedAt: time.Now().Unix(),
+		ExpiresAt: expiresAt,
+	}
+	if err := s.store.Save(info); err != nil {
+		log.Printf("Error saving api key: %v", err)
+		return "", model.ApiKey{}, err
+	}
+	return key, info, nil
+}
+
+func (s *ApiKeyService) GetApiKeys() ([]model.ApiKey, error) {
+	return s.store.GetAll()
+}
+
+func (s *ApiKeyService) RevokeApiKey(id string) error {
+	return s.store.Delete(id)
+}
+
+// GetModel resolves the key to a claim of its subject limited to the key scopes and records its use.
+func (s *ApiKeyService) GetModel(key string) (misc.JwtClaim, error) {
+	info, err := s.store.GetByHash(hashToken(key))
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if err := s.store.Touch(info.Id, now.Unix()); err != nil {
+		log.Printf("Error recording api key use: %v", err)
+	}
+
+	sub, err := encodeSubject(info.Subject)
+	if err != nil {
+		return nil, err
+	}
+	expiresAt := info.ExpiresAt
+	if expiresAt == 0 {
+		expiresAt = now.Add(apiKeySessionAge).Unix()
+	}
+	return model.ScopedClaims{
+		StandardClaims: model.StandardClaims{
+			Subject:   sub,
+			Identity:  info.Id,
+			IssuedAt:  info.CreatedAt,
+			ExpiresAt: expiresAt,
+		},
+		Scopes: info.Scopes,
+	}, nil
+}
+
+func (s *ApiKeyService) CheckToken(key string) (bool, error) {
+	_, err := s.store.GetByHash(hashToken(key))
+	if errors.Is(err, driven.ErrApiKeyNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+type memoryApiKeyStore struct {
+	mu     sync.RWMutex
+	keys   map[string]model.ApiKey
+	hashes map[string]string
+}
+
+// NewMemoryApiKeyStore creates a process local api key store.
+func NewMemoryApiKeyStore() driven.ApiKeyStore {
+	return &memoryApiKeyStore{keys: map[string]model.ApiKey{}, hashes: map[string]string{}}
+}
+
+func (s *memoryApiKeyStore) Save(key model.ApiKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.keys[key.Id] = key
+	s.hashes[key.Hash] = key.Id
+	return nil
+}
+
+func (s *memoryApiKeyStore) GetByHash(hash string) (model.ApiKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	key, ok := s.keys[s.hashes[hash]]
+	if !ok {
+		return key, driven.ErrApiKeyNotFound
+	}
+	return key, nil
+}
+
+func (s *memoryApiKeyStore) GetAll() ([]model.ApiKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	out := []model.ApiKey{}
+	for _, v := range s.keys {
+		out = append(out, v)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt < out[j].CreatedAt })
+	return out, nil
+}
+
+func (s *memoryApiKeyStore) Touch(id string, usedAt int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, ok := s.keys[id]
+	if !ok {
+		return driven.ErrApiKeyNotFound
+	}
+	key.LastUsedAt = usedAt
+	s.keys[id] = key
+	return nil
+}
+
+func (s *memoryApiKeyStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, ok := s.keys[id]
+	if !ok {
+		return driven.ErrApiKeyNotFound
+	}
+	delete(s.hashes, key.Hash)
+	delete(s.keys, id)
+	return nil
+}
@@ -0,0 +1,61 @@
+package adapter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	driven "github.com/nullexp/finman-api-gateway/internal/port"
+	"github.com/nullexp/finman-api-gateway/internal/port/model"
+	"github.com/nullexp/finman-api-gateway/pkg/infrastructure/misc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApiKeyService(t *testing.T) {
+	store := NewMemoryApiKeyStore()
+	s := NewApiKeyService(store)
+	subject := model.Subject{UserId: uuid.NewString()}
+
+	key, info, err := s.CreateApiKey("batch", subject, []string{"ManageTransactions"}, 0)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, key)
+	assert.NotContains(t, info.Hash, key)
+
+	valid, err := s.CheckToken(key)
+	assert.NoError(t, err)
+	assert.True(t, valid)
+
+	claim, err := s.GetModel(key)
+	assert.NoError(t, err)
+	assert.Equal(t, info.Id, claim.GetIdentity())
+	assert.NoError(t, misc.ClaimsPolicy{}.Validate(claim))
+	sub, err := model.ToSubject(claim.GetSubject())
+	assert.NoError(t, err)
+	assert.Equal(t, subject, sub)
+	scoped, ok := claim.(misc.ScopedClaim)
+	assert.True(t, ok)
+	assert.Equal(t, []string{"ManageTransactions"}, scoped.GetScopes())
+
+	keys, err := s.GetApiKeys()
+	assert.NoError(t, err)
+	assert.Len(t, keys, 1)
+	assert.NotZero(t, keys[0].LastUsedAt)
+
+	assert.NoError(t, s.RevokeApiKey(info.Id))
+	valid, err = s.CheckToken(key)
+	assert.NoError(t, err)
+	assert.False(t, valid)
+	_, err = s.GetModel(key)
+	assert.ErrorIs(t, err, driven.ErrApiKeyNotFound)
+	assert.ErrorIs(t, s.RevokeApiKey(info.Id), driven.ErrApiKeyNotFound)
+}
+
+func TestApiKeyExpiry(t *testing.T) {
+	s := NewApiKeyService(NewMemoryApiKeyStore())
+	key, _, err := s.CreateApiKey("old", model.Subject{UserId: uuid.NewString()}, []string{"ManageUsers"}, time.Now().Add(-time.Minute).Unix())
+	assert.NoError(t, err)
+
+	claim, err := s.GetModel(key)
+	assert.NoError(t, err)
+	assert.ErrorIs(t, misc.ClaimsPolicy{}.Validate(claim), misc.ErrTokenExpired)
+}
@@ -0,0 +1,24 @@
+package adapter
+
+import (
+	"log"
+
+	"github.com/nullexp/finman-api-gateway/internal/port/model"
+	httpmodel "github.com/nullexp/finman-api-gateway/pkg/infrastructure/http/protocol/model"
+)
+
+// AuditLogger writes the audit trail of impersonated requests to the standard logger.
+type AuditLogger struct{}
+
+func NewAuditLogger() AuditLogger {
+	return AuditLogger{}
+}
+
+func (AuditLogger) Handle(entry httpmodel.AuditLog) {
+	userId := entry.Subject
+	if sub, err := model.ToSubject(entry.Subject); err == nil {
+		userId = sub.UserId
+	}
+	log.Printf("AUDIT: admin %s impersonating user %s %s %s (%s) from %s: %d",
+		entry.Actor, userId, entry.Method, entry.Path, entry.Route, entry.IP, entry.Status)
+}
@@ -2,21 +2,99 @@ package adapter
 
 import (
 	"context"
+	"slices"
+	"sync"
 
 	userv1 "github.com/nullexp/finman-api-gateway/internal/adapter/grpc/user/v1"
+	driven "github.com/nullexp/finman-api-gateway/internal/port"
 	"github.com/nullexp/finman-api-gateway/internal/port/model"
 	"github.com/nullexp/finman-api-gateway/pkg/infrastructure/http/protocol"
+	"github.com/nullexp/finman-api-gateway/pkg/infrastructure/misc"
 )
 
-func NewAuthorizer(client userv1.RoleServiceClient, parser model.SubjectParser) protocol.Authorizer {
-	return func(identity, permission string) (bool, error) {
+// NewAuthorizer asks the role service whether the user holds the permission. Decisions are kept in
+// cache when it is not nil. An oauth client holds the permissions its registration in clients lists.
+func NewAuthorizer(client userv1.RoleServiceClient, clients driven.OAuthClientStore, parser model.SubjectParser, cache *PermissionCache) protocol.Authorizer {
+	return func(ctx context.Context, identity, permission string) (bool, error) {
 
 		sub := parser.MustParseSubject(identity)
 		if sub.IsAdmin {
 			return true, nil
 		}
-		rs, err := client.IsUserPermittedToPermission(context.Background(), &userv1.IsUserPermittedToPermissionRequest{
-			UserId:     sub.UserId,
+		if sub.UserId == "" {
+			return slices.Contains(clientPermissions(clients, sub), permission), nil
+		}
+		return decide(ctx, client, cache, sub.UserId, permission)
+	}
+}
+
+// NewBatchAuthorizer decides every permission of a request together. The role service answers a single
+// permission per call and has no batch call, so every permission missing from cache is still a call of
+// its own; they only run in parallel, the request waiting for the slowest of them.
+func NewBatchAuthorizer(client userv1.RoleServiceClient, clients driven.OAuthClientStore, parser model.SubjectParser, cache *PermissionCache) protocol.BatchAuthorizer {
+	return func(ctx context.Context, identity string, permissions []string) (map[string]bool, error) {
+		out := make(map[string]bool, len(permissions))
+
+		sub := parser.MustParseSubject(identity)
+		if sub.IsAdmin {
+			for _, v := range permissions {
+				out[v] = true
+			}
+			return out, nil
+		}
+		if sub.UserId == "" {
+			granted := clientPermissions(clients, sub)
+			for _, v := range permissions {
+				out[v] = slices.Contains(granted, v)
+			}
+			return out, nil
+		}
+
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		var firstErr error
+		for _, v := range permissions {
+			wg.Add(1)
+			go func(permission string) {
+				defer wg.Done()
+				valid, err := decide(ctx, client, cache, sub.UserId, permission)
+
+				mu.Lock()
+				defer mu.Unlock()
+				if err != nil && firstErr == nil {
+					firstErr = err
+				}
+				out[permission] = valid
+			}(v)
+		}
+		wg.Wait()
+
+		if firstErr != nil {
+			return nil, firstErr
+		}
+		return out, nil
+	}
+}
+
+// clientPermissions returns the permissions of the oauth client of the subject. Clients have no role,
+// they hold the scopes they are registered with, and nothing once they are unregistered.
+func clientPermissions(clients driven.OAuthClientStore, sub model.Subject) []string {
+	if clients == nil || sub.ClientId == "" {
+		return nil
+	}
+	client, err := clients.GetClient(sub.ClientId)
+	if err != nil {
+		return nil
+	}
+	return client.Scopes
+}
+
+// decide asks the role service with the context of the request, so the call keeps its deadline and
+// carries its origin.
+func decide(ctx context.Context, client userv1.RoleServiceClient, cache *PermissionCache, userId, permission string) (bool, error) {
+	lookup := func() (bool, error) {
+		rs, err := client.IsUserPermittedToPermission(ctx, &userv1.IsUserPermittedToPermissionRequest{
+			UserId:     userId,
 			Permission: permission,
 		})
 
@@ -25,4 +103,20 @@ func NewAuthorizer(client userv1.RoleServiceClient, parser model.SubjectParser)
 		}
 		return rs.IsPermitted, nil
 	}
+	if cache == nil {
+		return lookup()
+	}
+	return cache.Decide(ctx, userId, permission, lookup)
+}
+
+// NewOwnerResolver returns the user id inside the subject of a claim, ownership rules of the routes
+// compare it with the owner of the resource.
+func NewOwnerResolver() protocol.OwnerResolver {
+	return func(claim misc.JwtClaim) (string, error) {
+		sub, err := model.ToSubject(claim.GetSubject())
+		if err != nil {
+			return "", err
+		}
+		return sub.UserId, nil
+	}
 }
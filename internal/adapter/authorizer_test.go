@@ -0,0 +1,103 @@
+package adapter
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	userv1 "github.com/nullexp/finman-api-gateway/internal/adapter/grpc/user/v1"
+	"github.com/nullexp/finman-api-gateway/internal/port/model"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+)
+
+type testRoleClient struct {
+	userv1.RoleServiceClient
+	granted map[string]bool
+	calls   int32
+	err     error
+	ctx     atomic.Value
+}
+
+func (c *testRoleClient) IsUserPermittedToPermission(ctx context.Context, in *userv1.IsUserPermittedToPermissionRequest, _ ...grpc.CallOption) (*userv1.IsUserPermittedToPermissionResponse, error) {
+	atomic.AddInt32(&c.calls, 1)
+	c.ctx.Store(ctx)
+	if c.err != nil {
+		return nil, c.err
+	}
+	return &userv1.IsUserPermittedToPermissionResponse{IsPermitted: c.granted[in.Permission]}, nil
+}
+
+func TestBatchAuthorizer(t *testing.T) {
+	client := &testRoleClient{granted: map[string]bool{"Read": true}}
+	authorize := NewBatchAuthorizer(client, nil, model.NewTestSubjectParser(model.Subject{UserId: "user"}), NewPermissionCache(10, time.Hour, time.Hour))
+
+	out, err := authorize(context.Background(), "user", []string{"Read", "Write"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]bool{"Read": true, "Write": false}, out)
+	assert.Equal(t, int32(2), client.calls)
+
+	_, err = authorize(context.Background(), "user", []string{"Read", "Write"})
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), client.calls, "decisions come from cache")
+}
+
+func TestBatchAuthorizerAdmin(t *testing.T) {
+	client := &testRoleClient{}
+	authorize := NewBatchAuthorizer(client, nil, model.NewTestSubjectParser(model.Subject{UserId: "admin", IsAdmin: true}), nil)
+
+	out, err := authorize(context.Background(), "admin", []string{"Read", "Write"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]bool{"Read": true, "Write": true}, out)
+	assert.Zero(t, client.calls)
+}
+
+func TestBatchAuthorizerClient(t *testing.T) {
+	client := &testRoleClient{}
+	clients := NewMemoryOAuthClientStore(model.OAuthClient{Id: "billing", Scopes: []string{"Read"}})
+
+	authorize := NewBatchAuthorizer(client, clients, model.NewTestSubjectParser(model.Subject{ClientId: "billing"}), nil)
+	out, err := authorize(context.Background(), "billing", []string{"Read", "Write"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]bool{"Read": true, "Write": false}, out)
+
+	authorize = NewBatchAuthorizer(client, clients, model.NewTestSubjectParser(model.Subject{ClientId: "removed"}), nil)
+	out, err = authorize(context.Background(), "removed", []string{"Read"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]bool{"Read": false}, out)
+	assert.Zero(t, client.calls)
+}
+
+func TestBatchAuthorizerContext(t *testing.T) {
+	client := &testRoleClient{}
+	authorize := NewBatchAuthorizer(client, nil, model.NewTestSubjectParser(model.Subject{UserId: "user"}), nil)
+
+	type key struct{}
+	ctx := context.WithValue(context.Background(), key{}, "request")
+	_, err := authorize(ctx, "user", []string{"Read"})
+	assert.NoError(t, err)
+	assert.Equal(t, "request", client.ctx.Load().(context.Context).Value(key{}))
+}
+
+func TestBatchAuthorizerError(t *testing.T) {
+	client := &testRoleClient{err: errors.New("unavailable")}
+	authorize := NewBatchAuthorizer(client, nil, model.NewTestSubjectParser(model.Subject{UserId: "user"}), nil)
+
+	_, err := authorize(context.Background(), "user", []string{"Read"})
+	assert.Error(t, err)
+}
+
+func TestOwnerResolver(t *testing.T) {
+	resolve := NewOwnerResolver()
+
+	sub, err := encodeSubject(model.Subject{UserId: "u1"})
+	assert.NoError(t, err)
+	id, err := resolve(model.StandardClaims{Subject: sub})
+	assert.NoError(t, err)
+	assert.Equal(t, "u1", id)
+
+	_, err = resolve(model.StandardClaims{Subject: "%not base64%"})
+	assert.Error(t, err)
+}
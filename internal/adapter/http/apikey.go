@@ -0,0 +1,248 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	userv1 "github.com/nullexp/finman-api-gateway/internal/adapter/grpc/user/v1"
+	driven "github.com/nullexp/finman-api-gateway/internal/port"
+	"github.com/nullexp/finman-api-gateway/internal/port/model"
+	httpapi "github.com/nullexp/finman-api-gateway/pkg/infrastructure/http/protocol"
+	"github.com/nullexp/finman-api-gateway/pkg/infrastructure/http/protocol/model/openapi"
+	"github.com/nullexp/finman-api-gateway/pkg/infrastructure/http/protocol/response"
+	"github.com/nullexp/finman-api-gateway/pkg/infrastructure/misc"
+)
+
+const ApiKeyBaseURL = "/api-keys"
+
+var (
+	ErrApiKeyNameRequired   = errors.New("name is required")
+	ErrApiKeyUserRequired   = errors.New("userId is required")
+	ErrApiKeyScopesRequired = errors.New("at least one scope is required")
+	ErrApiKeyExpired        = errors.New("expiresAt must be in the future")
+)
+
+// NewApiKey serves the api keys, authorize telling which scopes the caller holds and may grant a key.
+func NewApiKey(keys driven.ApiKeyManager, users userv1.UserServiceClient, parser model.SubjectParser, authorize httpapi.BatchAuthorizer) httpapi.Module {
+	return ApiKeyHandler{keys: keys, users: users, parser: parser, authorize: authorize}
+}
+
+type ApiKeyHandler struct {
+	keys      driven.ApiKeyManager
+	users     userv1.UserServiceClient
+	parser    model.SubjectParser
+	authorize httpapi.BatchAuthorizer
+}
+
+func (s ApiKeyHandler) GetRequestHandlers() []*httpapi.RequestDefinition {
+	return []*httpapi.RequestDefinition{
+		s.GetAllApiKeys(),
+		s.PostApiKey(),
+		s.DeleteApiKey(),
+	}
+}
+
+func (s ApiKeyHandler) GetBaseURL() string {
+	return ApiKeyBaseURL
+}
+
+const (
+	ApiKeyManagement  = "Api Key Management"
+	ApiKeyDescription = "Manage the api keys machine clients authenticate with, through the X-Api-Key header or the ApiKey authorization scheme"
+)
+
+func (s ApiKeyHandler) GetTag() openapi.Tag {
+	return openapi.Tag{
+		Name:        ApiKeyManagement,
+		Description: ApiKeyDescription,
+	}
+}
+
+func (s ApiKeyHandler) GetAllApiKeys() *httpapi.RequestDefinition {
+	return &httpapi.RequestDefinition{
+		Route:          "",
+		Method:         http.MethodGet,
+		FreeRoute:      false,
+		AnyPermissions: []string{"ManageApiKeys"},
+		ResponseDefinitions: []httpapi.ResponseDefinition{
+			{
+				Status:      http.StatusOK,
+				Description: "If everything is fine",
+				Dto:         &GetAllApiKeysResponse{},
+			},
+		},
+		Handler: func(req httpapi.Request) {
+			keys, err := s.keys.GetApiKeys()
+			if err != nil {
+				req.SetServerError(err.Error())
+				return
+			}
+			req.Negotiate(http.StatusOK, nil, GetAllApiKeysResponse{ApiKeys: keys})
+		},
+	}
+}
+
+func (s ApiKeyHandler) PostApiKey() *httpapi.RequestDefinition {
+	return &httpapi.RequestDefinition{
+		Route:          "",
+		Method:         http.MethodPost,
+		FreeRoute:      false,
+		Dto:            &CreateApiKeyRequest{},
+		AnyPermissions: []string{"ManageApiKeys"},
+		Description:    "Creates an api key acting as the user but limited to the given permissions. The key is returned only once. Only admins create keys for other users or for admins, and a key gets no scope its creator does not hold",
+		ResponseDefinitions: []httpapi.ResponseDefinition{
+			{
+				Status:      http.StatusCreated,
+				Description: "If key is created",
+				Dto:         &CreateApiKeyResponse{},
+			},
+			{
+				Status:      http.StatusBadRequest,
+				Description: "If user does not exist",
+			},
+			{
+				Status:      http.StatusForbidden,
+				Description: "If caller is scoped, may not create keys for the user or does not hold a scope",
+			},
+		},
+		Handler: func(req httpapi.Request) {
+			claim, ok := req.MustGetCaller().(misc.JwtClaim)
+			if !ok {
+				req.SetServerError(UnknownCaller)
+				return
+			}
+			// Api keys and client tokens are limited to their scopes, they may not mint keys to widen them
+			if _, scoped := claim.(misc.ScopedClaim); scoped {
+				req.SetForbidden()
+				return
+			}
+			caller := s.parser.MustParseSubject(claim.GetSubject())
+
+			dto := req.MustGetDTO().(*CreateApiKeyRequest)
+			if !caller.IsAdmin && dto.UserId != caller.UserId {
+				req.SetForbidden()
+				return
+			}
+			user, err := s.users.GetUserById(req.Context(), &userv1.GetUserByIdRequest{Id: dto.UserId})
+			if err != nil {
+				req.SetUpstreamError(err)
+				return
+			}
+			if !caller.IsAdmin && user.User.IsAdmin {
+				req.SetForbidden()
+				return
+			}
+			held, err := s.holdsScopes(req.Context(), claim.GetSubject(), dto.Scopes)
+			if err != nil {
+				req.SetServerError(err.Error())
+				return
+			}
+			if !held {
+				req.SetForbidden()
+				return
+			}
+
+			var expiresAt int64
+			if dto.ExpiresAt != nil {
+				expiresAt = dto.ExpiresAt.Unix()
+			}
+			sub := model.Subject{UserId: user.User.Id, IsAdmin: user.User.IsAdmin}
+			key, info, err := s.keys.CreateApiKey(dto.Name, sub, dto.Scopes, expiresAt)
+			if err != nil {
+				req.SetServerError(err.Error())
+				return
+			}
+			req.Negotiate(http.StatusCreated, nil, CreateApiKeyResponse{Key: key, ApiKey: info})
+		},
+	}
+}
+
+// holdsScopes reports whether the caller holds every permission among the scopes. A scope naming a
+// route is held, an unscoped caller may call any route.
+func (s ApiKeyHandler) holdsScopes(ctx context.Context, identity string, scopes []string) (bool, error) {
+	permissions := []string{}
+	for _, v := range scopes {
+		if !httpapi.IsRouteScope(v) {
+			permissions = append(permissions, v)
+		}
+	}
+	if len(permissions) == 0 {
+		return true, nil
+	}
+	granted, err := s.authorize(ctx, identity, permissions)
+	if err != nil {
+		return false, err
+	}
+	for _, v := range permissions {
+		if !granted[v] {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func (s ApiKeyHandler) DeleteApiKey() *httpapi.RequestDefinition {
+	return &httpapi.RequestDefinition{
+		Route:          "/:id",
+		Method:         http.MethodDelete,
+		FreeRoute:      false,
+		AnyPermissions: []string{"ManageApiKeys"},
+		Parameters:     simpleIdParamDef,
+		Description:    "Revokes the api key, requests made with it are rejected right away",
+		ResponseDefinitions: []httpapi.ResponseDefinition{
+			{
+				Status:      http.StatusNoContent,
+				Description: "If key is revoked",
+			},
+			{
+				Status:      http.StatusNotFound,
+				Description: "If key does not exist",
+			},
+		},
+		Handler: func(req httpapi.Request) {
+			id := req.MustGet(idDef.GetName()).(string)
+			err := s.keys.RevokeApiKey(id)
+			if errors.Is(err, driven.ErrApiKeyNotFound) {
+				req.SetNotFound(err.Error(), response.NotFound)
+				return
+			}
+			if err != nil {
+				req.SetServerError(err.Error())
+				return
+			}
+			req.ReturnStatus(http.StatusNoContent, nil)
+		},
+	}
+}
+
+type GetAllApiKeysResponse struct {
+	ApiKeys []model.ApiKey `json:"apiKeys"`
+}
+
+type CreateApiKeyRequest struct {
+	Name      string     `json:"name" validate:"required"`
+	UserId    string     `json:"userId" validate:"required,uuid"`
+	Scopes    []string   `json:"scopes" validate:"required,min=1" example:"ManageTransactions"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
+
+func (dto CreateApiKeyRequest) Validate(ctx context.Context) error {
+	switch {
+	case dto.Name == "":
+		return ErrApiKeyNameRequired
+	case dto.UserId == "":
+		return ErrApiKeyUserRequired
+	case len(dto.Scopes) == 0:
+		return ErrApiKeyScopesRequired
+	case dto.ExpiresAt != nil && dto.ExpiresAt.Before(time.Now()):
+		return ErrApiKeyExpired
+	}
+	return nil
+}
+
+type CreateApiKeyResponse struct {
+	Key    string       `json:"key"`
+	ApiKey model.ApiKey `json:"apiKey"`
+}
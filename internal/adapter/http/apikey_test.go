@@ -0,0 +1,59 @@
+package http
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nullexp/finman-api-gateway/internal/adapter"
+	userv1 "github.com/nullexp/finman-api-gateway/internal/adapter/grpc/user/v1"
+	"github.com/nullexp/finman-api-gateway/internal/port/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPostApiKey(t *testing.T) {
+	tokens := adapter.NewTokenService("secret", time.Hour)
+	managerId := uuid.NewString()
+	roles := testRoleClient{permissions: map[string][]string{managerId: {"ManageApiKeys", "ManageTransactions"}}}
+	authorize := adapter.NewBatchAuthorizer(roles, nil, tokens, nil)
+	users := &testUserClient{}
+	app := newTestApp(tokens, authorize, NewApiKey(adapter.NewApiKeyService(adapter.NewMemoryApiKeyStore()), users, tokens, authorize))
+
+	admin, err := tokens.CreateToken(model.Subject{UserId: uuid.NewString(), IsAdmin: true})
+	assert.NoError(t, err)
+	manager, err := tokens.CreateToken(model.Subject{UserId: managerId})
+	assert.NoError(t, err)
+
+	create := func(token string, user *userv1.User, scopes ...string) int {
+		users.user = user
+		return send(app, http.MethodPost, ApiKeyBaseURL, CreateApiKeyRequest{Name: "reports", UserId: user.Id, Scopes: scopes}, token).Code
+	}
+
+	t.Run("Expect admin to create keys for any user", func(t *testing.T) {
+		assert.Equal(t, http.StatusCreated, create(admin, &userv1.User{Id: uuid.NewString(), IsAdmin: true}, "ManageUsers"))
+		assert.Equal(t, http.StatusCreated, create(admin, &userv1.User{Id: managerId}, "ManageUsers"))
+	})
+
+	t.Run("Expect user to create keys for itself with the permissions it holds", func(t *testing.T) {
+		assert.Equal(t, http.StatusCreated, create(manager, &userv1.User{Id: managerId}, "ManageTransactions", "GET:/users/me/permissions"))
+	})
+
+	t.Run("Expect user to be refused a key for another user", func(t *testing.T) {
+		assert.Equal(t, http.StatusForbidden, create(manager, &userv1.User{Id: uuid.NewString()}, "ManageTransactions"))
+	})
+
+	t.Run("Expect user to be refused a key for an admin", func(t *testing.T) {
+		assert.Equal(t, http.StatusForbidden, create(manager, &userv1.User{Id: managerId, IsAdmin: true}, "ManageTransactions"))
+	})
+
+	t.Run("Expect user to be refused a scope it does not hold", func(t *testing.T) {
+		assert.Equal(t, http.StatusForbidden, create(manager, &userv1.User{Id: managerId}, "ManageTransactions", "ManageUsers"))
+	})
+
+	t.Run("Expect scoped caller to be refused", func(t *testing.T) {
+		scoped, err := tokens.CreateScopedToken(model.Subject{UserId: uuid.NewString(), IsAdmin: true}, []string{"ManageApiKeys", "ManageUsers"})
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusForbidden, create(scoped, &userv1.User{Id: uuid.NewString()}, "ManageUsers"))
+	})
+}
@@ -0,0 +1,61 @@
+package http
+
+import (
+	"net/http"
+
+	driven "github.com/nullexp/finman-api-gateway/internal/port"
+	"github.com/nullexp/finman-api-gateway/internal/port/model"
+	httpapi "github.com/nullexp/finman-api-gateway/pkg/infrastructure/http/protocol"
+	"github.com/nullexp/finman-api-gateway/pkg/infrastructure/http/protocol/model/openapi"
+)
+
+const WellKnownBaseURL = "/.well-known"
+
+func NewJwks(keys driven.KeySetProvider) httpapi.Module {
+	return JwksHandler{keys: keys}
+}
+
+type JwksHandler struct {
+	keys driven.KeySetProvider
+}
+
+func (s JwksHandler) GetRequestHandlers() []*httpapi.RequestDefinition {
+	return []*httpapi.RequestDefinition{
+		s.GetJwks(),
+	}
+}
+
+func (s JwksHandler) GetBaseURL() string {
+	return WellKnownBaseURL
+}
+
+const (
+	KeyManagement  = "Key Management"
+	KeyDescription = "Public keys that tokens of the gateway are signed with"
+)
+
+func (s JwksHandler) GetTag() openapi.Tag {
+	return openapi.Tag{
+		Name:        KeyManagement,
+		Description: KeyDescription,
+	}
+}
+
+func (s JwksHandler) GetJwks() *httpapi.RequestDefinition {
+	return &httpapi.RequestDefinition{
+		Route:       "/jwks.json",
+		Method:      http.MethodGet,
+		FreeRoute:   true,
+		Description: "Returns the public signing keys as a JSON Web Key Set, tokens name their key in the kid header",
+		ResponseDefinitions: []httpapi.ResponseDefinition{
+			{
+				Status:      http.StatusOK,
+				Description: "If everything is fine",
+				Dto:         &model.Jwks{},
+			},
+		},
+		Handler: func(req httpapi.Request) {
+			req.Negotiate(http.StatusOK, nil, s.keys.GetJwks())
+		},
+	}
+}
@@ -0,0 +1,174 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	driven "github.com/nullexp/finman-api-gateway/internal/port"
+	"github.com/nullexp/finman-api-gateway/internal/port/model"
+	httpapi "github.com/nullexp/finman-api-gateway/pkg/infrastructure/http/protocol"
+	"github.com/nullexp/finman-api-gateway/pkg/infrastructure/http/protocol/model/openapi"
+	"github.com/nullexp/finman-api-gateway/pkg/infrastructure/http/protocol/response"
+)
+
+const KeyBaseURL = "/keys"
+
+func NewKey(keys driven.KeyManager) httpapi.Module {
+	return KeyHandler{keys: keys}
+}
+
+type KeyHandler struct {
+	keys driven.KeyManager
+}
+
+func (s KeyHandler) GetRequestHandlers() []*httpapi.RequestDefinition {
+	return []*httpapi.RequestDefinition{
+		s.GetAllKeys(),
+		s.PostKey(),
+		s.PromoteKey(),
+		s.DeleteKey(),
+	}
+}
+
+func (s KeyHandler) GetBaseURL() string {
+	return KeyBaseURL
+}
+
+func (s KeyHandler) GetTag() openapi.Tag {
+	return openapi.Tag{
+		Name:        KeyManagement,
+		Description: KeyDescription,
+	}
+}
+
+func (s KeyHandler) GetAllKeys() *httpapi.RequestDefinition {
+	return &httpapi.RequestDefinition{
+		Route:          "",
+		Method:         http.MethodGet,
+		FreeRoute:      false,
+		AnyPermissions: []string{"ManageKeys"},
+		ResponseDefinitions: []httpapi.ResponseDefinition{
+			{
+				Status:      http.StatusOK,
+				Description: "If everything is fine",
+				Dto:         &GetAllKeysResponse{},
+			},
+		},
+		Handler: func(req httpapi.Request) {
+			req.Negotiate(http.StatusOK, nil, GetAllKeysResponse{Keys: s.keys.GetKeys()})
+		},
+	}
+}
+
+func (s KeyHandler) PostKey() *httpapi.RequestDefinition {
+	return &httpapi.RequestDefinition{
+		Route:          "",
+		Method:         http.MethodPost,
+		FreeRoute:      false,
+		Dto:            &CreateKeyRequest{},
+		AnyPermissions: []string{"ManageKeys"},
+		Description:    "Generates a verify-only key. It is published in the JWKS right away and signs tokens once promoted",
+		ResponseDefinitions: []httpapi.ResponseDefinition{
+			{
+				Status:      http.StatusCreated,
+				Description: "If key is generated",
+				Dto:         &model.SigningKeyInfo{},
+			},
+		},
+		Handler: func(req httpapi.Request) {
+			dto := req.MustGetDTO().(*CreateKeyRequest)
+			key, err := s.keys.GenerateKey(dto.Algorithm)
+			if err != nil {
+				req.SetBadRequest(err.Error(), response.ValidationError)
+				return
+			}
+			req.Negotiate(http.StatusCreated, nil, key)
+		},
+	}
+}
+
+func (s KeyHandler) PromoteKey() *httpapi.RequestDefinition {
+	return &httpapi.RequestDefinition{
+		Route:          "/:id/active",
+		Method:         http.MethodPut,
+		FreeRoute:      false,
+		AnyPermissions: []string{"ManageKeys"},
+		Parameters:     simpleIdParamDef,
+		Description:    "Makes the key the signing key. The previous one keeps verifying until tokens signed with it expire",
+		ResponseDefinitions: []httpapi.ResponseDefinition{
+			{
+				Status:      http.StatusNoContent,
+				Description: "If key is promoted",
+			},
+			{
+				Status:      http.StatusNotFound,
+				Description: "If key does not exist or has no private part",
+			},
+		},
+		Handler: func(req httpapi.Request) {
+			id := req.MustGet(idDef.GetName()).(string)
+			err := s.keys.Promote(id)
+			if errors.Is(err, driven.ErrSigningKeyNotFound) {
+				req.SetNotFound(err.Error(), response.NotFound)
+				return
+			}
+			if err != nil {
+				req.SetServerError(err.Error())
+				return
+			}
+			req.ReturnStatus(http.StatusNoContent, nil)
+		},
+	}
+}
+
+func (s KeyHandler) DeleteKey() *httpapi.RequestDefinition {
+	return &httpapi.RequestDefinition{
+		Route:          "/:id",
+		Method:         http.MethodDelete,
+		FreeRoute:      false,
+		AnyPermissions: []string{"ManageKeys"},
+		Parameters:     simpleIdParamDef,
+		Description:    "Retires a verify-only key at once, tokens signed with it are rejected afterwards",
+		ResponseDefinitions: []httpapi.ResponseDefinition{
+			{
+				Status:      http.StatusNoContent,
+				Description: "If key is retired",
+			},
+			{
+				Status:      http.StatusBadRequest,
+				Description: "If key is the active signing key",
+			},
+			{
+				Status:      http.StatusNotFound,
+				Description: "If key does not exist",
+			},
+		},
+		Handler: func(req httpapi.Request) {
+			id := req.MustGet(idDef.GetName()).(string)
+			err := s.keys.Retire(id)
+			switch {
+			case errors.Is(err, driven.ErrSigningKeyNotFound):
+				req.SetNotFound(err.Error(), response.NotFound)
+				return
+			case errors.Is(err, driven.ErrRetireActiveKey):
+				req.SetBadRequest(err.Error(), response.ValidationError)
+				return
+			case err != nil:
+				req.SetServerError(err.Error())
+				return
+			}
+			req.ReturnStatus(http.StatusNoContent, nil)
+		},
+	}
+}
+
+type GetAllKeysResponse struct {
+	Keys []model.SigningKeyInfo `json:"keys"`
+}
+
+type CreateKeyRequest struct {
+	Algorithm string `json:"algorithm" validate:"required,oneof=HS256 HS384 HS512 RS256 RS384 RS512 PS256 PS384 PS512 ES256 ES384 ES512 EdDSA" example:"RS256"`
+}
+
+func (CreateKeyRequest) Validate(context.Context) error { return nil }
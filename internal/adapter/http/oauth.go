@@ -0,0 +1,204 @@
+package http
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	driven "github.com/nullexp/finman-api-gateway/internal/port"
+	"github.com/nullexp/finman-api-gateway/internal/port/model"
+	httpapi "github.com/nullexp/finman-api-gateway/pkg/infrastructure/http/protocol"
+	"github.com/nullexp/finman-api-gateway/pkg/infrastructure/http/protocol/model/openapi"
+)
+
+const OAuthBaseURL = "/oauth"
+
+// Error codes of RFC 6749 section 5.2
+const (
+	OAuthInvalidRequest       = "invalid_request"
+	OAuthInvalidClient        = "invalid_client"
+	OAuthInvalidScope         = "invalid_scope"
+	OAuthUnsupportedGrantType = "unsupported_grant_type"
+	OAuthServerError          = "server_error"
+)
+
+const GrantTypeClientCredentials = "client_credentials"
+
+func NewOAuth(server driven.OAuthServer) httpapi.Module {
+	return OAuthHandler{server: server}
+}
+
+type OAuthHandler struct {
+	server driven.OAuthServer
+}
+
+func (s OAuthHandler) GetRequestHandlers() []*httpapi.RequestDefinition {
+	return []*httpapi.RequestDefinition{
+		s.PostToken(),
+		s.PostIntrospect(),
+	}
+}
+
+func (s OAuthHandler) GetBaseURL() string {
+	return OAuthBaseURL
+}
+
+const (
+	OAuthManagement  = "OAuth"
+	OAuthDescription = "Service to service authentication with the client credentials grant. Clients authenticate with HTTP Basic or with client_id and client_secret form fields"
+)
+
+func (s OAuthHandler) GetTag() openapi.Tag {
+	return openapi.Tag{
+		Name:        OAuthManagement,
+		Description: OAuthDescription,
+	}
+}
+
+func (s OAuthHandler) PostToken() *httpapi.RequestDefinition {
+	return &httpapi.RequestDefinition{
+		Route:       "/token",
+		Method:      http.MethodPost,
+		FreeRoute:   true,
+		Dto:         &OAuthTokenRequest{},
+		Description: "Issues an access token limited to the requested scopes, or to every scope of the client when scope is omitted",
+		ResponseDefinitions: []httpapi.ResponseDefinition{
+			{
+				Status:      http.StatusOK,
+				Description: "If client is authenticated",
+				Dto:         &model.OAuthToken{},
+			},
+			{
+				Status:      http.StatusBadRequest,
+				Description: "If grant type or scope is not valid",
+				Dto:         &OAuthErrorResponse{},
+			},
+			{
+				Status:      http.StatusUnauthorized,
+				Description: "If client authentication failed",
+				Dto:         &OAuthErrorResponse{},
+			},
+		},
+		Handler: func(req httpapi.Request) {
+			dto := req.MustGetDTO().(*OAuthTokenRequest)
+			req.SetHeader("Cache-Control", "no-store")
+			if dto.GrantType != GrantTypeClientCredentials {
+				req.Negotiate(http.StatusBadRequest, nil, OAuthErrorResponse{Error: OAuthUnsupportedGrantType})
+				return
+			}
+			id, secret, ok := getClientCredentials(req, dto.ClientId, dto.ClientSecret)
+			if !ok {
+				req.Negotiate(http.StatusBadRequest, nil, OAuthErrorResponse{Error: OAuthInvalidRequest, ErrorDescription: "client credentials are missing"})
+				return
+			}
+
+			token, err := s.server.IssueClientToken(id, secret, strings.Fields(dto.Scope))
+			if err != nil {
+				setOAuthError(req, err)
+				return
+			}
+			req.Negotiate(http.StatusOK, nil, token)
+		},
+	}
+}
+
+func (s OAuthHandler) PostIntrospect() *httpapi.RequestDefinition {
+	return &httpapi.RequestDefinition{
+		Route:       "/introspect",
+		Method:      http.MethodPost,
+		FreeRoute:   true,
+		Dto:         &OAuthIntrospectRequest{},
+		Description: "Reports whether a token is active along with its claims, as described in RFC 7662. Callers authenticate as a registered client",
+		ResponseDefinitions: []httpapi.ResponseDefinition{
+			{
+				Status:      http.StatusOK,
+				Description: "If client is authenticated, whether the token is active or not",
+				Dto:         &model.Introspection{},
+			},
+			{
+				Status:      http.StatusUnauthorized,
+				Description: "If client authentication failed",
+				Dto:         &OAuthErrorResponse{},
+			},
+		},
+		Handler: func(req httpapi.Request) {
+			dto := req.MustGetDTO().(*OAuthIntrospectRequest)
+			id, secret, ok := getClientCredentials(req, dto.ClientId, dto.ClientSecret)
+			if !ok {
+				req.Negotiate(http.StatusUnauthorized, nil, OAuthErrorResponse{Error: OAuthInvalidClient})
+				return
+			}
+
+			introspection, err := s.server.Introspect(id, secret, dto.Token)
+			if err != nil {
+				setOAuthError(req, err)
+				return
+			}
+			req.Negotiate(http.StatusOK, nil, introspection)
+		},
+	}
+}
+
+// getClientCredentials prefers HTTP Basic authentication and falls back to the form fields.
+func getClientCredentials(req httpapi.Request, formId, formSecret string) (string, string, bool) {
+	header := req.GetHeader("Authorization")
+	if !strings.HasPrefix(header, "Basic ") {
+		return formId, formSecret, formId != ""
+	}
+	data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(header, "Basic "))
+	if err != nil {
+		return "", "", false
+	}
+	rawId, rawSecret, ok := strings.Cut(string(data), ":")
+	if !ok {
+		return "", "", false
+	}
+	// Credentials are form encoded before they are put in the header
+	id, err := url.QueryUnescape(rawId)
+	if err != nil {
+		return "", "", false
+	}
+	secret, err := url.QueryUnescape(rawSecret)
+	if err != nil {
+		return "", "", false
+	}
+	return id, secret, true
+}
+
+func setOAuthError(req httpapi.Request, err error) {
+	switch {
+	case errors.Is(err, driven.ErrInvalidClient):
+		req.SetHeader("WWW-Authenticate", `Basic realm="oauth"`)
+		req.Negotiate(http.StatusUnauthorized, nil, OAuthErrorResponse{Error: OAuthInvalidClient})
+	case errors.Is(err, driven.ErrInvalidScope):
+		req.Negotiate(http.StatusBadRequest, nil, OAuthErrorResponse{Error: OAuthInvalidScope, ErrorDescription: err.Error()})
+	default:
+		req.Negotiate(http.StatusInternalServerError, nil, OAuthErrorResponse{Error: OAuthServerError})
+	}
+}
+
+type OAuthTokenRequest struct {
+	GrantType    string `json:"grant_type" form:"grant_type" example:"client_credentials"`
+	Scope        string `json:"scope" form:"scope"`
+	ClientId     string `json:"client_id" form:"client_id"`
+	ClientSecret string `json:"client_secret" form:"client_secret"`
+}
+
+func (OAuthTokenRequest) Validate(context.Context) error { return nil }
+
+type OAuthIntrospectRequest struct {
+	Token         string `json:"token" form:"token" validate:"required"`
+	TokenTypeHint string `json:"token_type_hint" form:"token_type_hint"`
+	ClientId      string `json:"client_id" form:"client_id"`
+	ClientSecret  string `json:"client_secret" form:"client_secret"`
+}
+
+func (OAuthIntrospectRequest) Validate(context.Context) error { return nil }
+
+type OAuthErrorResponse struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
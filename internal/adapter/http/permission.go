@@ -0,0 +1,122 @@
+package http
+
+import (
+	"net/http"
+	"slices"
+
+	httpapi "github.com/nullexp/finman-api-gateway/pkg/infrastructure/http/protocol"
+	"github.com/nullexp/finman-api-gateway/pkg/infrastructure/http/protocol/model"
+	"github.com/nullexp/finman-api-gateway/pkg/infrastructure/http/protocol/model/openapi"
+	"github.com/nullexp/finman-api-gateway/pkg/infrastructure/misc"
+)
+
+// PermissionBaseURL is empty since the routes of the module live under different resources
+const PermissionBaseURL = ""
+
+func NewPermission(catalog httpapi.PermissionCatalog, authorize httpapi.BatchAuthorizer) httpapi.Module {
+	return PermissionHandler{catalog: catalog, authorize: authorize}
+}
+
+type PermissionHandler struct {
+	catalog   httpapi.PermissionCatalog
+	authorize httpapi.BatchAuthorizer
+}
+
+func (s PermissionHandler) GetRequestHandlers() []*httpapi.RequestDefinition {
+	return []*httpapi.RequestDefinition{
+		s.GetPermissions(),
+		s.GetOwnPermissions(),
+	}
+}
+
+func (s PermissionHandler) GetBaseURL() string {
+	return PermissionBaseURL
+}
+
+const (
+	PermissionManagement  = "Permission Management"
+	PermissionDescription = "Use these apis to find out which permissions exist and which the caller holds"
+)
+
+func (s PermissionHandler) GetTag() openapi.Tag {
+	return openapi.Tag{
+		Name:        PermissionManagement,
+		Description: PermissionDescription,
+	}
+}
+
+func (s PermissionHandler) GetPermissions() *httpapi.RequestDefinition {
+	return &httpapi.RequestDefinition{
+		Route:       "/permissions",
+		Method:      http.MethodGet,
+		FreeRoute:   false,
+		Description: "Lists every permission the routes require, with the routes requiring it. Requirement any means one permission of the route is enough, all means the route needs this one",
+		ResponseDefinitions: []httpapi.ResponseDefinition{
+			{
+				Status:      http.StatusOK,
+				Description: "If everything is fine",
+				Dto:         &GetPermissionsResponse{},
+			},
+		},
+		Handler: func(req httpapi.Request) {
+			req.Negotiate(http.StatusOK, nil, GetPermissionsResponse{Permissions: s.catalog.GetPermissionCatalog()})
+		},
+	}
+}
+
+func (s PermissionHandler) GetOwnPermissions() *httpapi.RequestDefinition {
+	return &httpapi.RequestDefinition{
+		Route:       "/users/me/permissions",
+		Method:      http.MethodGet,
+		FreeRoute:   false,
+		Description: "Lists the permissions of the catalog the caller holds. Api keys and client tokens hold only the ones in their scopes",
+		ResponseDefinitions: []httpapi.ResponseDefinition{
+			{
+				Status:      http.StatusOK,
+				Description: "If everything is fine",
+				Dto:         &GetOwnPermissionsResponse{},
+			},
+		},
+		Handler: func(req httpapi.Request) {
+			claim, ok := req.MustGetCaller().(misc.JwtClaim)
+			if !ok {
+				req.SetServerError(UnknownCaller)
+				return
+			}
+
+			scoped, isScoped := claim.(misc.ScopedClaim)
+			asked := []string{}
+			for _, v := range s.catalog.GetPermissionCatalog() {
+				if isScoped && !slices.Contains(scoped.GetScopes(), v.Permission) {
+					continue
+				}
+				asked = append(asked, v.Permission)
+			}
+
+			owned := []string{}
+			if len(asked) != 0 {
+				granted, err := s.authorize(req.Context(), claim.GetSubject(), asked)
+				if err != nil {
+					req.SetServerError(err.Error())
+					return
+				}
+				for _, v := range asked {
+					if granted[v] {
+						owned = append(owned, v)
+					}
+				}
+			}
+			req.Negotiate(http.StatusOK, nil, GetOwnPermissionsResponse{Permissions: owned})
+		},
+	}
+}
+
+// dto
+
+type GetPermissionsResponse struct {
+	Permissions []model.PermissionCatalogEntry `json:"permissions"`
+}
+
+type GetOwnPermissionsResponse struct {
+	Permissions []string `json:"permissions"`
+}
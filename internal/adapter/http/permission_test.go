@@ -0,0 +1,100 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+
+	gingonic "github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/nullexp/finman-api-gateway/internal/adapter"
+	userv1 "github.com/nullexp/finman-api-gateway/internal/adapter/grpc/user/v1"
+	"github.com/nullexp/finman-api-gateway/internal/port/model"
+	"github.com/nullexp/finman-api-gateway/pkg/infrastructure/http/gin"
+	httpapi "github.com/nullexp/finman-api-gateway/pkg/infrastructure/http/protocol"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+)
+
+// testRoleClient permits the users the permissions they are mapped to.
+type testRoleClient struct {
+	userv1.RoleServiceClient
+	permissions map[string][]string
+}
+
+func (c testRoleClient) IsUserPermittedToPermission(_ context.Context, in *userv1.IsUserPermittedToPermissionRequest, _ ...grpc.CallOption) (*userv1.IsUserPermittedToPermissionResponse, error) {
+	return &userv1.IsUserPermittedToPermissionResponse{IsPermitted: slices.Contains(c.permissions[in.UserId], in.Permission)}, nil
+}
+
+func TestPermissions(t *testing.T) {
+	tokens := adapter.NewTokenService("secret", time.Hour)
+	userId := uuid.NewString()
+	client := testRoleClient{permissions: map[string][]string{userId: {"ManageRoles"}}}
+	authorize := adapter.NewBatchAuthorizer(client, nil, tokens, nil)
+
+	app := gin.NewGinApp()
+	app.AppendAuthenticator("/", tokens)
+	app.AppendBatchAuthorizer("/", authorize)
+	app.AppendModule(NewUser(&testUserClient{}, tokens, nil, nil))
+	app.AppendModule(NewRole(client, nil))
+	app.AppendModule(NewPermission(app, authorize))
+	app.Init(gingonic.TestMode)
+
+	admin, err := tokens.CreateToken(model.Subject{UserId: uuid.NewString(), IsAdmin: true})
+	assert.NoError(t, err)
+	user, err := tokens.CreateToken(model.Subject{UserId: userId})
+	assert.NoError(t, err)
+
+	own := func(token string) []string {
+		w := send(app, http.MethodGet, "/users/me/permissions", nil, token)
+		assert.Equal(t, http.StatusOK, w.Code)
+		out := GetOwnPermissionsResponse{}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &out))
+		return out.Permissions
+	}
+
+	t.Run("Expect catalog to list the permissions with their routes", func(t *testing.T) {
+		w := send(app, http.MethodGet, "/permissions", nil, admin)
+		assert.Equal(t, http.StatusOK, w.Code)
+		out := GetPermissionsResponse{}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &out))
+
+		permissions := map[string]int{}
+		for _, v := range out.Permissions {
+			permissions[v.Permission] = len(v.Routes)
+		}
+		assert.Equal(t, map[string]int{"ManageUsers": 6, "ManageRoles": 4}, permissions)
+	})
+
+	t.Run("Expect catalog to be refused without the token", func(t *testing.T) {
+		assert.Equal(t, http.StatusUnauthorized, send(app, http.MethodGet, "/permissions", nil, "").Code)
+	})
+
+	t.Run("Expect admin to hold every permission", func(t *testing.T) {
+		assert.ElementsMatch(t, []string{"ManageUsers", "ManageRoles"}, own(admin))
+	})
+
+	t.Run("Expect user to hold the permissions of the role", func(t *testing.T) {
+		assert.Equal(t, []string{"ManageRoles"}, own(user))
+	})
+
+	t.Run("Expect scoped token to hold the permissions of its scopes only", func(t *testing.T) {
+		route := httpapi.RouteScope(http.MethodGet, "/users/me/permissions")
+		scoped, err := tokens.CreateScopedToken(model.Subject{UserId: uuid.NewString(), IsAdmin: true}, []string{"ManageUsers", route})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"ManageUsers"}, own(scoped))
+
+		scoped, err = tokens.CreateScopedToken(model.Subject{UserId: userId}, []string{"ManageUsers", route})
+		assert.NoError(t, err)
+		assert.Empty(t, own(scoped))
+	})
+
+	t.Run("Expect scoped token without the route scope to be refused", func(t *testing.T) {
+		scoped, err := tokens.CreateScopedToken(model.Subject{UserId: userId}, []string{"ManageRoles"})
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusForbidden, send(app, http.MethodGet, "/users/me/permissions", nil, scoped).Code)
+	})
+}
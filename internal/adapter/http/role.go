@@ -6,23 +6,25 @@ import (
 	"time"
 
 	userv1 "github.com/nullexp/finman-api-gateway/internal/adapter/grpc/user/v1"
+	driven "github.com/nullexp/finman-api-gateway/internal/port"
 	httpapi "github.com/nullexp/finman-api-gateway/pkg/infrastructure/http/protocol"
 	"github.com/nullexp/finman-api-gateway/pkg/infrastructure/http/protocol/model/openapi"
 )
 
 const RoleBaseURL = "/roles"
 
-func NewRole(client userv1.RoleServiceClient) httpapi.Module {
-	return RoleHandler{client: client}
+func NewRole(client userv1.RoleServiceClient, permissions driven.PermissionInvalidator) httpapi.Module {
+	return RoleHandler{client: client, permissions: permissions}
 }
 
 type RoleHandler struct {
-	client userv1.RoleServiceClient
+	client      userv1.RoleServiceClient
+	permissions driven.PermissionInvalidator
 }
 
 func (s RoleHandler) GetRequestHandlers() []*httpapi.RequestDefinition {
 	return []*httpapi.RequestDefinition{
-		s.GetAllRoles(), s.PostRoles(),
+		s.GetAllRoles(), s.PostRoles(), s.UpdateRole(), s.DeleteRole(),
 	}
 }
 
@@ -56,9 +58,9 @@ func (s RoleHandler) GetAllRoles() *httpapi.RequestDefinition {
 			},
 		},
 		Handler: func(req httpapi.Request) {
-			Roles, err := s.client.GetAllRoles(context.Background(), &userv1.GetAllRolesRequest{})
+			Roles, err := s.client.GetAllRoles(req.Context(), &userv1.GetAllRolesRequest{})
 			if err != nil {
-				req.SetBadRequest(PleaseReadTheErrorCode, err.Error())
+				req.SetUpstreamError(err)
 				return
 			}
 			req.Negotiate(http.StatusCreated, err, Roles)
@@ -83,12 +85,12 @@ func (s RoleHandler) PostRoles() *httpapi.RequestDefinition {
 		},
 		Handler: func(req httpapi.Request) {
 			dto := req.MustGetDTO().(*CreateRoleRequest)
-			resp, err := s.client.CreateRole(context.Background(), &userv1.CreateRoleRequest{
+			resp, err := s.client.CreateRole(req.Context(), &userv1.CreateRoleRequest{
 				Name:        dto.Name,
 				Permissions: dto.Permissions,
 			})
 			if err != nil {
-				req.SetBadRequest(PleaseReadTheErrorCode, err.Error())
+				req.SetUpstreamError(err)
 				return
 			}
 			req.Negotiate(http.StatusCreated, err, CreateRoleResponse{
@@ -98,6 +100,67 @@ func (s RoleHandler) PostRoles() *httpapi.RequestDefinition {
 	}
 }
 
+func (s RoleHandler) UpdateRole() *httpapi.RequestDefinition {
+	return &httpapi.RequestDefinition{
+		Route:          "/:id",
+		Description:    "Replaces the name and the permissions of the role, users holding it get the new permissions right away",
+		Method:         http.MethodPut,
+		FreeRoute:      false,
+		Dto:            &UpdateRoleRequest{},
+		AnyPermissions: []string{"ManageRoles"},
+		Parameters:     simpleIdParamDef,
+		ResponseDefinitions: []httpapi.ResponseDefinition{
+			{
+				Status:      http.StatusOK,
+				Description: "If everything is fine",
+			},
+		},
+		Handler: func(req httpapi.Request) {
+			id := req.MustGet(idDef.GetName()).(string)
+			dto := req.MustGetDTO().(*UpdateRoleRequest)
+			_, err := s.client.UpdateRole(req.Context(), &userv1.UpdateRoleRequest{
+				Id:          id,
+				Name:        dto.Name,
+				Permissions: dto.Permissions,
+			})
+			if err != nil {
+				req.SetUpstreamError(err)
+				return
+			}
+			s.permissions.InvalidateAll()
+			req.ReturnStatus(http.StatusOK, nil)
+		},
+	}
+}
+
+func (s RoleHandler) DeleteRole() *httpapi.RequestDefinition {
+	return &httpapi.RequestDefinition{
+		Route:          "/:id",
+		Method:         http.MethodDelete,
+		FreeRoute:      false,
+		AnyPermissions: []string{"ManageRoles"},
+		Parameters:     simpleIdParamDef,
+		ResponseDefinitions: []httpapi.ResponseDefinition{
+			{
+				Status:      http.StatusOK,
+				Description: "If everything is fine",
+			},
+		},
+		Handler: func(req httpapi.Request) {
+			id := req.MustGet(idDef.GetName()).(string)
+			_, err := s.client.DeleteRole(req.Context(), &userv1.DeleteRoleRequest{
+				Id: id,
+			})
+			if err != nil {
+				req.SetUpstreamError(err)
+				return
+			}
+			s.permissions.InvalidateAll()
+			req.ReturnStatus(http.StatusOK, nil)
+		},
+	}
+}
+
 type Role struct {
 	Id          string    `json:"id"`
 	Name        string    `json:"name"`
@@ -136,7 +199,6 @@ type GetAllRolesResponse struct {
 }
 
 type UpdateRoleRequest struct {
-	Id          string   `json:"id" validate:"required,uuid"`
 	Name        string   `json:"name" validate:"required"`
 	Permissions []string `json:"permissions" validate:"required"`
 }
@@ -2,26 +2,58 @@ package http
 
 import (
 	"context"
+	"errors"
 	"net/http"
+	"time"
 
 	authv1 "github.com/nullexp/finman-api-gateway/internal/adapter/grpc/auth/v1"
+	userv1 "github.com/nullexp/finman-api-gateway/internal/adapter/grpc/user/v1"
+	driven "github.com/nullexp/finman-api-gateway/internal/port"
+	"github.com/nullexp/finman-api-gateway/internal/port/model"
 	httpapi "github.com/nullexp/finman-api-gateway/pkg/infrastructure/http/protocol"
 	"github.com/nullexp/finman-api-gateway/pkg/infrastructure/http/protocol/model/openapi"
+	"github.com/nullexp/finman-api-gateway/pkg/infrastructure/http/protocol/response"
+	"github.com/nullexp/finman-api-gateway/pkg/infrastructure/misc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	UnknownCaller = "Caller is not a token"
+	// InvalidLogin answers every rejected login alike, so a client can not tell which usernames exist
+	InvalidLogin = "Username or password is incorrect"
 )
 
 const SessionBaseURL = "/sessions"
 
-func NewSession(client authv1.AuthServiceClient) httpapi.Module {
-	return SessionHandler{client: client}
+var userIdDef = misc.NewQueryDefinition("userId",
+	[]misc.QueryOperator{misc.QueryOperatorEqual},
+	misc.DataTypeString)
+
+var userIdParamDef = []httpapi.RequestParameter{
+	{Definition: userIdDef, Query: false, Optional: false},
+}
+
+func NewSession(client authv1.AuthServiceClient, users userv1.UserServiceClient, tokens driven.TokenService, sessions driven.SessionRevoker, guard driven.LoginGuard) httpapi.Module {
+	return SessionHandler{client: client, users: users, tokens: tokens, sessions: sessions, guard: guard}
 }
 
 type SessionHandler struct {
-	client authv1.AuthServiceClient
+	client   authv1.AuthServiceClient
+	users    userv1.UserServiceClient
+	tokens   driven.TokenService
+	sessions driven.SessionRevoker
+	guard    driven.LoginGuard
 }
 
 func (s SessionHandler) GetRequestHandlers() []*httpapi.RequestDefinition {
 	return []*httpapi.RequestDefinition{
 		s.PostSession(),
+		s.RefreshSession(),
+		s.DeleteSession(),
+		s.DeleteUserSessions(),
+		s.ImpersonateUser(),
+		s.DeleteLockout(),
 	}
 }
 
@@ -57,19 +89,265 @@ func (s SessionHandler) PostSession() *httpapi.RequestDefinition {
 				Status:      http.StatusBadRequest,
 				Description: "If auth info is not valid",
 			},
+			{
+				Status:      http.StatusUnauthorized,
+				Description: "If username or password is incorrect",
+			},
+			{
+				Status:      http.StatusTooManyRequests,
+				Description: "If username or client is locked out after failed attempts, Retry-After tells when to try again",
+			},
 		},
 		Handler: func(req httpapi.Request) {
 			dto := req.MustGetDTO().(*CreateTokenRequest)
-			token, err := s.client.Login(context.Background(), &authv1.LoginRequest{Username: dto.Username, Password: dto.Password})
+			ip := req.GetClientIP()
+			retryAfter, err := s.guard.Check(dto.Username, ip)
+			if errors.Is(err, driven.ErrTooManyAttempts) {
+				req.SetTooManyRequests(err.Error(), response.TooManyAttempts, retryAfter)
+				return
+			}
+			if err != nil {
+				req.SetServerError(err.Error())
+				return
+			}
+
+			token, err := s.client.Login(req.Context(), &authv1.LoginRequest{Username: dto.Username, Password: dto.Password})
 			if err != nil {
-				req.SetBadRequest(PleaseReadTheErrorCode, err.Error())
+				if !isLoginRejection(err) {
+					req.SetUpstreamError(err)
+					return
+				}
+				if ferr := s.guard.Fail(dto.Username, ip); ferr != nil {
+					req.SetServerError(ferr.Error())
+					return
+				}
+				req.SetUnauthorized(InvalidLogin, response.InvalidAuthInfo)
 				return
 			}
-			req.Negotiate(http.StatusCreated, err, token)
+			if err = s.guard.Succeed(dto.Username); err != nil {
+				req.SetServerError(err.Error())
+				return
+			}
+			claims, err := s.tokens.GetToken(token.Token)
+			if err != nil {
+				req.SetServerError(err.Error())
+				return
+			}
+			sub, err := s.tokens.GetSubject(claims.Subject)
+			if err != nil {
+				req.SetServerError(err.Error())
+				return
+			}
+			// Re-mint the token so it is signed with the gateway key and verifiable through the JWKS
+			accessToken, refreshToken, err := s.tokens.CreateSession(sub)
+			if err != nil {
+				req.SetServerError(err.Error())
+				return
+			}
+			req.Negotiate(http.StatusCreated, nil, CreateTokenResponse{Token: accessToken, RefreshToken: refreshToken})
 		},
 	}
 }
 
+func (s SessionHandler) RefreshSession() *httpapi.RequestDefinition {
+	return &httpapi.RequestDefinition{
+		Route:       "/refresh",
+		Dto:         &RefreshTokenRequest{},
+		FreeRoute:   true,
+		Method:      http.MethodPost,
+		Description: "Exchanges a refresh token for a new token pair. Every refresh token can be used only once",
+		ResponseDefinitions: []httpapi.ResponseDefinition{
+			{
+				Status:      http.StatusCreated,
+				Description: "If refresh token is valid",
+				Dto:         &CreateTokenResponse{},
+			},
+			{
+				Status:      http.StatusUnauthorized,
+				Description: "If refresh token is unknown, expired or already used",
+			},
+		},
+		Handler: func(req httpapi.Request) {
+			dto := req.MustGetDTO().(*RefreshTokenRequest)
+			token, refreshToken, err := s.tokens.Refresh(dto.RefreshToken)
+			switch {
+			case errors.Is(err, driven.ErrRefreshTokenReused):
+				req.SetUnauthorized(err.Error(), response.RefreshTokenReused)
+				return
+			case errors.Is(err, driven.ErrRefreshTokenNotFound), errors.Is(err, driven.ErrRefreshTokenExpired):
+				req.SetUnauthorized(err.Error(), response.InvalidRefreshToken)
+				return
+			case err != nil:
+				req.SetServerError(err.Error())
+				return
+			}
+			req.Negotiate(http.StatusCreated, nil, CreateTokenResponse{Token: token, RefreshToken: refreshToken})
+		},
+	}
+}
+
+func (s SessionHandler) DeleteSession() *httpapi.RequestDefinition {
+	return &httpapi.RequestDefinition{
+		Route:       "",
+		Method:      http.MethodDelete,
+		FreeRoute:   false,
+		Description: "Logs out by revoking the token used for this request, and every token and refresh token of its login session",
+		// Lets an admin end an impersonation before the token expires
+		AllowImpersonation: true,
+		ResponseDefinitions: []httpapi.ResponseDefinition{
+			{
+				Status:      http.StatusNoContent,
+				Description: "If token is revoked",
+			},
+		},
+		Handler: func(req httpapi.Request) {
+			claim, ok := req.MustGetCaller().(misc.JwtClaim)
+			if !ok {
+				req.SetServerError(UnknownCaller)
+				return
+			}
+			err := s.sessions.Revoke(claim.GetIdentity(), claim.GetExpireTime())
+			if err != nil {
+				req.SetServerError(err.Error())
+				return
+			}
+			if claim, ok := claim.(misc.SessionClaim); ok && claim.GetSessionId() != "" {
+				if err = s.sessions.RevokeSession(claim.GetSessionId()); err != nil {
+					req.SetServerError(err.Error())
+					return
+				}
+			}
+			req.ReturnStatus(http.StatusNoContent, nil)
+		},
+	}
+}
+
+func (s SessionHandler) DeleteUserSessions() *httpapi.RequestDefinition {
+	return &httpapi.RequestDefinition{
+		Route:          "/users/:id",
+		Method:         http.MethodDelete,
+		FreeRoute:      false,
+		Parameters:     simpleIdParamDef,
+		AnyPermissions: []string{"ManageUsers"},
+		Description:    "Revokes every token and refresh token issued to the user so far",
+		ResponseDefinitions: []httpapi.ResponseDefinition{
+			{
+				Status:      http.StatusNoContent,
+				Description: "If sessions are revoked",
+			},
+		},
+		Handler: func(req httpapi.Request) {
+			id := req.MustGet(idDef.GetName()).(string)
+			err := s.sessions.RevokeUser(id)
+			if err != nil {
+				req.SetServerError(err.Error())
+				return
+			}
+			req.ReturnStatus(http.StatusNoContent, nil)
+		},
+	}
+}
+
+func (s SessionHandler) ImpersonateUser() *httpapi.RequestDefinition {
+	return &httpapi.RequestDefinition{
+		Route:       "/impersonate/:userId",
+		Method:      http.MethodPost,
+		FreeRoute:   false,
+		Parameters:  userIdParamDef,
+		Description: "Mints a short lived token acting as the user with the permissions of the user. The token can not change state and every request made with it is audited under the admin",
+		ResponseDefinitions: []httpapi.ResponseDefinition{
+			{
+				Status:      http.StatusCreated,
+				Description: "If token is minted",
+				Dto:         &ImpersonationResponse{},
+			},
+			{
+				Status:      http.StatusBadRequest,
+				Description: "If user does not exist",
+			},
+			{
+				Status:      http.StatusForbidden,
+				Description: "If caller is not an admin or the user is an admin",
+			},
+		},
+		Handler: func(req httpapi.Request) {
+			claim, ok := req.MustGetCaller().(misc.JwtClaim)
+			if !ok {
+				req.SetServerError(UnknownCaller)
+				return
+			}
+			// Api keys and client tokens are limited to their scopes, they may not widen them by impersonating
+			if _, scoped := claim.(misc.ScopedClaim); scoped {
+				req.SetForbidden()
+				return
+			}
+			caller, err := s.tokens.GetSubject(claim.GetSubject())
+			if err != nil {
+				req.SetServerError(err.Error())
+				return
+			}
+			if !caller.IsAdmin {
+				req.SetForbidden()
+				return
+			}
+
+			id := req.MustGet(userIdDef.GetName()).(string)
+			user, err := s.users.GetUserById(req.Context(), &userv1.GetUserByIdRequest{Id: id})
+			if err != nil {
+				req.SetUpstreamError(err)
+				return
+			}
+			if user.User.IsAdmin {
+				req.SetForbidden()
+				return
+			}
+
+			token, expiresAt, err := s.tokens.CreateImpersonationToken(model.Subject{UserId: user.User.Id}, caller.UserId)
+			if err != nil {
+				req.SetServerError(err.Error())
+				return
+			}
+			req.Negotiate(http.StatusCreated, nil, ImpersonationResponse{Token: token, ExpiresAt: expiresAt})
+		},
+	}
+}
+
+func (s SessionHandler) DeleteLockout() *httpapi.RequestDefinition {
+	return &httpapi.RequestDefinition{
+		Route:          "/lockouts/:id",
+		Method:         http.MethodDelete,
+		FreeRoute:      false,
+		Parameters:     simpleIdParamDef,
+		AnyPermissions: []string{"ManageUsers"},
+		Description:    "Lifts the lockout of a username or a client ip and forgets its failed login attempts",
+		ResponseDefinitions: []httpapi.ResponseDefinition{
+			{
+				Status:      http.StatusNoContent,
+				Description: "If lockout is cleared",
+			},
+		},
+		Handler: func(req httpapi.Request) {
+			id := req.MustGet(idDef.GetName()).(string)
+			if err := s.guard.Clear(id); err != nil {
+				req.SetServerError(err.Error())
+				return
+			}
+			req.ReturnStatus(http.StatusNoContent, nil)
+		},
+	}
+}
+
+// isLoginRejection tells a rejected login from a failure of the auth service, only rejections count as
+// failed attempts.
+func isLoginRejection(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.Canceled, codes.ResourceExhausted,
+		codes.Unknown, codes.Internal, codes.DataLoss, codes.Unimplemented:
+		return false
+	}
+	return true
+}
+
 type CreateTokenRequest struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
@@ -78,5 +356,17 @@ type CreateTokenRequest struct {
 func (CreateTokenRequest) Validate(context.Context) error { return nil }
 
 type CreateTokenResponse struct {
-	Token string `json:"token"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refreshToken"`
+}
+
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refreshToken" validate:"required"`
+}
+
+func (RefreshTokenRequest) Validate(context.Context) error { return nil }
+
+type ImpersonationResponse struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expiresAt"`
 }
@@ -0,0 +1,113 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	gingonic "github.com/gin-gonic/gin"
+	"github.com/nullexp/finman-api-gateway/internal/adapter"
+	authv1 "github.com/nullexp/finman-api-gateway/internal/adapter/grpc/auth/v1"
+	"github.com/nullexp/finman-api-gateway/pkg/infrastructure/http/gin"
+	httpapi "github.com/nullexp/finman-api-gateway/pkg/infrastructure/http/protocol"
+	"github.com/nullexp/finman-api-gateway/pkg/infrastructure/http/protocol/model"
+	"github.com/nullexp/finman-api-gateway/pkg/infrastructure/http/protocol/response"
+	"github.com/nullexp/finman-api-gateway/pkg/infrastructure/log"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func init() {
+	log.Initialize()
+}
+
+// send answers the request with the app, body being sent as JSON and token as Bearer token when given.
+func send(app *gin.GinApp, method, path string, body any, token string) *httptest.ResponseRecorder {
+	data := []byte{}
+	if body != nil {
+		data, _ = json.Marshal(body)
+	}
+	req, _ := http.NewRequest(method, path, bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set(gin.Authorization, "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	_ = app.TestHandle(w, req)
+	return w
+}
+
+// newTestApp serves the modules behind the token service, the callers holding what authorize grants.
+func newTestApp(tokens *adapter.TokenService, authorize httpapi.BatchAuthorizer, modules ...httpapi.Module) *gin.GinApp {
+	app := gin.NewGinApp()
+	app.AppendAuthenticator("/", tokens)
+	app.AppendBatchAuthorizer("/", authorize)
+	for _, v := range modules {
+		app.AppendModule(v)
+	}
+	app.Init(gingonic.TestMode)
+	return app
+}
+
+func decodeError(t *testing.T, w *httptest.ResponseRecorder) model.RequestError {
+	out := model.RequestError{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &out))
+	return out
+}
+
+// testAuthClient fails the login of every username with the code it is mapped to.
+type testAuthClient struct {
+	authv1.AuthServiceClient
+	failures map[string]codes.Code
+}
+
+func (c testAuthClient) Login(_ context.Context, in *authv1.LoginRequest, _ ...grpc.CallOption) (*authv1.LoginResponse, error) {
+	return nil, status.Error(c.failures[in.Username], "login of "+in.Username+" failed")
+}
+
+func TestPostSessionRejections(t *testing.T) {
+	client := testAuthClient{failures: map[string]codes.Code{
+		"ghost": codes.NotFound,
+		"alice": codes.Unauthenticated,
+		"bob":   codes.Unavailable,
+	}}
+	guard := adapter.NewLoginGuard(adapter.NewMemoryLoginAttemptStore(), adapter.LockoutPolicy{MaxFailures: 2, IpMaxFailures: 100, Lockout: time.Minute, MaxLockout: time.Minute, ResetAfter: time.Minute})
+	app := gin.NewGinApp()
+	app.AppendModule(NewSession(client, nil, nil, nil, guard))
+	app.Init(gingonic.TestMode)
+
+	login := func(username string) *httptest.ResponseRecorder {
+		return send(app, http.MethodPost, SessionBaseURL, CreateTokenRequest{Username: username, Password: "secret"}, "")
+	}
+
+	t.Run("Expect unknown user and wrong password to be answered alike", func(t *testing.T) {
+		missing, wrong := login("ghost"), login("alice")
+		assert.Equal(t, http.StatusUnauthorized, missing.Code)
+		assert.Equal(t, http.StatusUnauthorized, wrong.Code)
+		for _, w := range []*httptest.ResponseRecorder{missing, wrong} {
+			body := decodeError(t, w)
+			assert.Equal(t, InvalidLogin, body.Message)
+			assert.Equal(t, response.InvalidAuthInfo, body.Code)
+			assert.Nil(t, body.Detail)
+		}
+	})
+
+	t.Run("Expect rejections to count as failed attempts", func(t *testing.T) {
+		login("alice")
+		assert.Equal(t, http.StatusTooManyRequests, login("alice").Code)
+	})
+
+	t.Run("Expect outage to be passed on without counting", func(t *testing.T) {
+		for range 3 {
+			w := login("bob")
+			assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+			assert.NotContains(t, w.Body.String(), "login of bob")
+		}
+	})
+}
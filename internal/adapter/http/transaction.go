@@ -2,6 +2,7 @@ package http
 
 import (
 	"context"
+	"errors"
 	"log"
 	"net/http"
 	"time"
@@ -11,6 +12,7 @@ import (
 
 	httpapi "github.com/nullexp/finman-api-gateway/pkg/infrastructure/http/protocol"
 	"github.com/nullexp/finman-api-gateway/pkg/infrastructure/http/protocol/model/openapi"
+	"github.com/nullexp/finman-api-gateway/pkg/infrastructure/http/protocol/response"
 	"github.com/nullexp/finman-api-gateway/pkg/infrastructure/misc"
 )
 
@@ -41,6 +43,7 @@ func (s TransactionHandler) GetRequestHandlers() []*httpapi.RequestDefinition {
 		s.GetOwnTransactionById(),
 		s.GetAllTransactions(),
 		s.UpdateTransaction(),
+		s.PatchTransaction(),
 		s.DeleteTransaction(),
 	}
 }
@@ -80,14 +83,14 @@ func (s TransactionHandler) CreateTransaction() *httpapi.RequestDefinition {
 			caller := req.MustGetCaller()
 			sub := s.parser.MustParseSubject(caller.GetSubject())
 			dto := req.MustGetDTO().(*CreateTransactionRequest)
-			resp, err := s.client.CreateTransaction(context.Background(), &transactionv1.CreateTransactionRequest{
+			resp, err := s.client.CreateTransaction(req.Context(), &transactionv1.CreateTransactionRequest{
 				UserId:      sub.UserId,
 				Type:        dto.Type,
 				Amount:      dto.Amount,
 				Description: dto.Description,
 			})
 			if err != nil {
-				req.SetBadRequest(PleaseReadTheErrorCode, err.Error())
+				req.SetUpstreamError(err)
 				return
 			}
 			req.Negotiate(http.StatusCreated, err, CreateTransactionResponse{
@@ -99,24 +102,31 @@ func (s TransactionHandler) CreateTransaction() *httpapi.RequestDefinition {
 
 func (s TransactionHandler) GetTransactionById() *httpapi.RequestDefinition {
 	return &httpapi.RequestDefinition{
-		Route:      "/:id",
-		Method:     http.MethodGet,
-		FreeRoute:  false,
-		Parameters: simpleIdParamDef,
+		Route:          "/:id",
+		Method:         http.MethodGet,
+		FreeRoute:      false,
+		Parameters:     simpleIdParamDef,
+		AnyPermissions: []string{"ManageTransactions"},
+		Ownership:      &httpapi.OwnershipRule{ResponseField: "transaction.userId"},
+		Description:    "Users can read their own transactions, reading others needs ManageTransactions",
 		ResponseDefinitions: []httpapi.ResponseDefinition{
 			{
 				Status:      http.StatusOK,
 				Description: "If everything is fine",
 				Dto:         &GetTransactionByIdResponse{},
 			},
+			{
+				Status:      http.StatusForbidden,
+				Description: "If transaction belongs to someone else and caller can not manage transactions",
+			},
 		},
 		Handler: func(req httpapi.Request) {
 			id := req.MustGet(idDef.GetName()).(string)
-			resp, err := s.client.GetTransactionById(context.Background(), &transactionv1.GetTransactionByIdRequest{
+			resp, err := s.client.GetTransactionById(req.Context(), &transactionv1.GetTransactionByIdRequest{
 				Id: id,
 			})
 			if err != nil {
-				req.SetBadRequest(PleaseReadTheErrorCode, err.Error())
+				req.SetUpstreamError(err)
 				return
 			}
 			req.Negotiate(http.StatusOK, err, GetTransactionByIdResponse{
@@ -142,6 +152,8 @@ func (s TransactionHandler) GetTransactionsByUserId() *httpapi.RequestDefinition
 		FreeRoute:      false,
 		Parameters:     simpleIdParamDef,
 		AnyPermissions: []string{"ManageTransactions"},
+		Ownership:      &httpapi.OwnershipRule{PathParam: idDef.GetName()},
+		Description:    "Users can list their own transactions, listing others needs ManageTransactions",
 		ResponseDefinitions: []httpapi.ResponseDefinition{
 			{
 				Status:      http.StatusOK,
@@ -151,11 +163,11 @@ func (s TransactionHandler) GetTransactionsByUserId() *httpapi.RequestDefinition
 		},
 		Handler: func(req httpapi.Request) {
 			id := req.MustGet(idDef.GetName()).(string)
-			resp, err := s.client.GetTransactionsByUserId(context.Background(), &transactionv1.GetTransactionsByUserIdRequest{
+			resp, err := s.client.GetTransactionsByUserId(req.Context(), &transactionv1.GetTransactionsByUserIdRequest{
 				UserId: id,
 			})
 			if err != nil {
-				req.SetBadRequest(PleaseReadTheErrorCode, err.Error())
+				req.SetUpstreamError(err)
 				return
 			}
 			transactions := make([]Transaction, len(resp.Transactions))
@@ -180,9 +192,11 @@ func (s TransactionHandler) GetTransactionsByUserId() *httpapi.RequestDefinition
 
 func (s TransactionHandler) GetOwnTransactionById() *httpapi.RequestDefinition {
 	return &httpapi.RequestDefinition{
-		Route:     "/own/:id",
-		Method:    http.MethodGet,
-		FreeRoute: false,
+		Route:       "/own/:id",
+		Method:      http.MethodGet,
+		FreeRoute:   false,
+		Deprecated:  true,
+		Description: "Use GET /transactions/:id, which lets the owner in as well",
 		ResponseDefinitions: []httpapi.ResponseDefinition{
 			{
 				Status:      http.StatusOK,
@@ -194,12 +208,12 @@ func (s TransactionHandler) GetOwnTransactionById() *httpapi.RequestDefinition {
 			caller := req.MustGetCaller()
 			sub := s.parser.MustParseSubject(caller.GetSubject())
 			id := req.MustGet(idDef.GetName()).(string)
-			resp, err := s.client.GetOwnTransactionById(context.Background(), &transactionv1.GetOwnTransactionByIdRequest{
+			resp, err := s.client.GetOwnTransactionById(req.Context(), &transactionv1.GetOwnTransactionByIdRequest{
 				Id:     id,
 				UserId: sub.UserId,
 			})
 			if err != nil {
-				req.SetBadRequest(PleaseReadTheErrorCode, err.Error())
+				req.SetUpstreamError(err)
 				return
 			}
 			req.Negotiate(http.StatusOK, err, GetOwnTransactionByIdResponse{
@@ -232,9 +246,9 @@ func (s TransactionHandler) GetAllTransactions() *httpapi.RequestDefinition {
 			},
 		},
 		Handler: func(req httpapi.Request) {
-			resp, err := s.client.GetAllTransactions(context.Background(), &transactionv1.GetAllTransactionsRequest{})
+			resp, err := s.client.GetAllTransactions(req.Context(), &transactionv1.GetAllTransactionsRequest{})
 			if err != nil {
-				req.SetBadRequest(PleaseReadTheErrorCode, err.Error())
+				req.SetUpstreamError(err)
 				return
 			}
 			transactions := make([]Transaction, len(resp.Transactions))
@@ -274,7 +288,59 @@ func (s TransactionHandler) UpdateTransaction() *httpapi.RequestDefinition {
 		Handler: func(req httpapi.Request) {
 			id := req.MustGet(idDef.GetName()).(string)
 			dto := req.MustGetDTO().(*UpdateTransactionRequest)
-			_, err := s.client.UpdateTransaction(context.Background(), &transactionv1.UpdateTransactionRequest{
+			_, err := s.client.UpdateTransaction(req.Context(), &transactionv1.UpdateTransactionRequest{
+				Id:          id,
+				UserId:      dto.UserId,
+				Type:        dto.Type,
+				Amount:      dto.Amount,
+				Description: dto.Description,
+			})
+			if err != nil {
+				req.SetUpstreamError(err)
+				return
+			}
+			req.ReturnStatus(http.StatusNoContent, err)
+		},
+	}
+}
+
+func (s TransactionHandler) PatchTransaction() *httpapi.RequestDefinition {
+	return &httpapi.RequestDefinition{
+		Route:          "/:id",
+		Method:         http.MethodPatch,
+		FreeRoute:      false,
+		Parameters:     simpleIdParamDef,
+		Dto:            &PatchTransactionRequest{},
+		AnyPermissions: []string{"ManageTransactions"},
+		Description:    "Accepts a JSON Merge Patch (application/merge-patch+json or application/json) or a JSON Patch (application/json-patch+json) of the transaction",
+		ResponseDefinitions: []httpapi.ResponseDefinition{
+			{
+				Status:      http.StatusNoContent,
+				Description: "If everything is fine",
+			},
+			{
+				Status:      http.StatusBadRequest,
+				Description: "If patch is malformed, its test fails or the patched transaction is not valid",
+			},
+		},
+		Handler: func(req httpapi.Request) {
+			id := req.MustGet(idDef.GetName()).(string)
+			current, err := s.client.GetTransactionById(req.Context(), &transactionv1.GetTransactionByIdRequest{Id: id})
+			if err != nil {
+				req.SetUpstreamError(err)
+				return
+			}
+			dto := &PatchTransactionRequest{
+				UserId:      current.Transaction.UserId,
+				Type:        current.Transaction.Type,
+				Amount:      current.Transaction.Amount,
+				Description: current.Transaction.Description,
+			}
+			if err = req.MustGetPatch().Apply(req.Context(), dto); err != nil {
+				req.SetBadRequest(err.Error(), response.InvalidPatch)
+				return
+			}
+			_, err = s.client.UpdateTransaction(req.Context(), &transactionv1.UpdateTransactionRequest{
 				Id:          id,
 				UserId:      dto.UserId,
 				Type:        dto.Type,
@@ -282,7 +348,7 @@ func (s TransactionHandler) UpdateTransaction() *httpapi.RequestDefinition {
 				Description: dto.Description,
 			})
 			if err != nil {
-				req.SetBadRequest(PleaseReadTheErrorCode, err.Error())
+				req.SetUpstreamError(err)
 				return
 			}
 			req.ReturnStatus(http.StatusNoContent, err)
@@ -305,11 +371,11 @@ func (s TransactionHandler) DeleteTransaction() *httpapi.RequestDefinition {
 		},
 		Handler: func(req httpapi.Request) {
 			id := req.MustGet(idDef.GetName()).(string)
-			_, err := s.client.DeleteTransaction(context.Background(), &transactionv1.DeleteTransactionRequest{
+			_, err := s.client.DeleteTransaction(req.Context(), &transactionv1.DeleteTransactionRequest{
 				Id: id,
 			})
 			if err != nil {
-				req.SetBadRequest(PleaseReadTheErrorCode, err.Error())
+				req.SetUpstreamError(err)
 				return
 			}
 			req.ReturnStatus(http.StatusNoContent, err)
@@ -320,7 +386,7 @@ func (s TransactionHandler) DeleteTransaction() *httpapi.RequestDefinition {
 func MustParseTime(value string) time.Time {
 	t, err := time.Parse(time.RFC3339, value)
 	if err != nil {
-		log.Println("Error parsing date: %v", err)
+		log.Printf("Error parsing date: %v", err)
 	}
 	return t
 }
@@ -393,6 +459,28 @@ func (dto UpdateTransactionRequest) Validate(ctx context.Context) error {
 	return nil
 }
 
+type PatchTransactionRequest struct {
+	UserId      string `json:"userId" validate:"required,uuid"`
+	Type        string `json:"type" validate:"required,oneof=deposit withdrawal"`
+	Amount      int64  `json:"amount" validate:"required,gt=0"`
+	Description string `json:"description"`
+}
+
+var (
+	ErrInvalidTransactionType   = errors.New("type must be deposit or withdrawal")
+	ErrInvalidTransactionAmount = errors.New("amount must be greater than zero")
+)
+
+func (dto PatchTransactionRequest) Validate(ctx context.Context) error {
+	if dto.Type != "deposit" && dto.Type != "withdrawal" {
+		return ErrInvalidTransactionType
+	}
+	if dto.Amount <= 0 {
+		return ErrInvalidTransactionAmount
+	}
+	return nil
+}
+
 type DeleteTransactionRequest struct {
 	Id string `json:"id" validate:"required,uuid"`
 }
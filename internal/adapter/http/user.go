@@ -2,25 +2,29 @@ package http
 
 import (
 	"context"
+	"errors"
 	"net/http"
 	"time"
 
 	userv1 "github.com/nullexp/finman-api-gateway/internal/adapter/grpc/user/v1"
+	driven "github.com/nullexp/finman-api-gateway/internal/port"
 	"github.com/nullexp/finman-api-gateway/internal/port/model"
 	httpapi "github.com/nullexp/finman-api-gateway/pkg/infrastructure/http/protocol"
 	"github.com/nullexp/finman-api-gateway/pkg/infrastructure/http/protocol/model/openapi"
+	"github.com/nullexp/finman-api-gateway/pkg/infrastructure/http/protocol/response"
 )
 
-const PleaseReadTheErrorCode = "Please read the error message"
 const UserBaseURL = "/users"
 
-func NewUser(client userv1.UserServiceClient, parser model.SubjectParser) httpapi.Module {
-	return UserHandler{client: client, parser: parser}
+func NewUser(client userv1.UserServiceClient, parser model.SubjectParser, sessions driven.SessionRevoker, permissions driven.PermissionInvalidator) httpapi.Module {
+	return UserHandler{client: client, parser: parser, sessions: sessions, permissions: permissions}
 }
 
 type UserHandler struct {
-	client userv1.UserServiceClient
-	parser model.SubjectParser
+	client      userv1.UserServiceClient
+	parser      model.SubjectParser
+	sessions    driven.SessionRevoker
+	permissions driven.PermissionInvalidator
 }
 
 func (s UserHandler) GetRequestHandlers() []*httpapi.RequestDefinition {
@@ -29,6 +33,7 @@ func (s UserHandler) GetRequestHandlers() []*httpapi.RequestDefinition {
 		s.PostUsers(),
 		s.GetUserById(),
 		s.UpdateUser(),
+		s.PatchUser(),
 		s.DeleteUser(),
 	}
 }
@@ -63,9 +68,9 @@ func (s UserHandler) GetAllUsers() *httpapi.RequestDefinition {
 			},
 		},
 		Handler: func(req httpapi.Request) {
-			users, err := s.client.GetAllUsers(context.Background(), &userv1.GetAllUsersRequest{})
+			users, err := s.client.GetAllUsers(req.Context(), &userv1.GetAllUsersRequest{})
 			if err != nil {
-				req.SetBadRequest(PleaseReadTheErrorCode, err.Error())
+				req.SetUpstreamError(err)
 				return
 			}
 			req.Negotiate(http.StatusCreated, err, users)
@@ -89,13 +94,13 @@ func (s UserHandler) PostUsers() *httpapi.RequestDefinition {
 		},
 		Handler: func(req httpapi.Request) {
 			dto := req.MustGetDTO().(*CreateUserRequest)
-			resp, err := s.client.CreateUser(context.Background(), &userv1.CreateUserRequest{
+			resp, err := s.client.CreateUser(req.Context(), &userv1.CreateUserRequest{
 				Username: dto.Username,
 				Password: dto.Password,
 				RoleId:   dto.RoleId,
 			})
 			if err != nil {
-				req.SetBadRequest(PleaseReadTheErrorCode, err.Error())
+				req.SetUpstreamError(err)
 				return
 			}
 			req.Negotiate(http.StatusCreated, err, CreateUserResponse{
@@ -107,25 +112,32 @@ func (s UserHandler) PostUsers() *httpapi.RequestDefinition {
 
 func (s UserHandler) GetUserById() *httpapi.RequestDefinition {
 	return &httpapi.RequestDefinition{
-		Route:      "/:id",
-		Method:     http.MethodGet,
-		FreeRoute:  false,
-		Dto:        &GetUserByIdRequest{},
-		Parameters: simpleIdParamDef,
+		Route:          "/:id",
+		Method:         http.MethodGet,
+		FreeRoute:      false,
+		Dto:            &GetUserByIdRequest{},
+		Parameters:     simpleIdParamDef,
+		AnyPermissions: []string{"ManageUsers"},
+		Ownership:      &httpapi.OwnershipRule{PathParam: idDef.GetName()},
+		Description:    "Users can read themselves, reading others needs ManageUsers",
 		ResponseDefinitions: []httpapi.ResponseDefinition{
 			{
 				Status:      http.StatusOK,
 				Description: "If everything is fine",
 				Dto:         &GetUserByIdResponse{},
 			},
+			{
+				Status:      http.StatusForbidden,
+				Description: "If user is someone else and caller can not manage users",
+			},
 		},
 		Handler: func(req httpapi.Request) {
 			id := req.MustGet(idDef.GetName()).(string)
-			resp, err := s.client.GetUserById(context.Background(), &userv1.GetUserByIdRequest{
+			resp, err := s.client.GetUserById(req.Context(), &userv1.GetUserByIdRequest{
 				Id: id,
 			})
 			if err != nil {
-				req.SetBadRequest(PleaseReadTheErrorCode, err.Error())
+				req.SetUpstreamError(err)
 				return
 			}
 			req.Negotiate(http.StatusOK, nil, GetUserByIdResponse{
@@ -160,20 +172,69 @@ func (s UserHandler) UpdateUser() *httpapi.RequestDefinition {
 		Handler: func(req httpapi.Request) {
 			id := req.MustGet(idDef.GetName()).(string)
 			dto := req.MustGetDTO().(*UpdateUserRequest)
-			_, err := s.client.UpdateUser(context.Background(), &userv1.UpdateUserRequest{
+			_, err := s.client.UpdateUser(req.Context(), &userv1.UpdateUserRequest{
 				Id:       id,
 				Password: dto.Password,
 				RoleId:   dto.RoleId,
 			})
 			if err != nil {
-				req.SetBadRequest(PleaseReadTheErrorCode, err.Error())
+				req.SetUpstreamError(err)
 				return
 			}
+			// The role may have been replaced
+			s.permissions.InvalidateUser(id)
 			req.Negotiate(http.StatusOK, nil, nil)
 		},
 	}
 }
 
+func (s UserHandler) PatchUser() *httpapi.RequestDefinition {
+	return &httpapi.RequestDefinition{
+		Route:          "/:id",
+		Method:         http.MethodPatch,
+		FreeRoute:      false,
+		Dto:            &PatchUserRequest{},
+		AnyPermissions: []string{"ManageUsers"},
+		Parameters:     simpleIdParamDef,
+		Description:    "Accepts a JSON Merge Patch (application/merge-patch+json or application/json) or a JSON Patch (application/json-patch+json) of the user. The password can not be read back and the service has no way to leave it unchanged, so the patch must set it",
+		ResponseDefinitions: []httpapi.ResponseDefinition{
+			{
+				Status:      http.StatusOK,
+				Description: "If everything is fine",
+				Dto:         nil,
+			},
+			{
+				Status:      http.StatusBadRequest,
+				Description: "If patch is malformed, its test fails, it does not set the password or the patched user is not valid",
+			},
+		},
+		Handler: func(req httpapi.Request) {
+			id := req.MustGet(idDef.GetName()).(string)
+			current, err := s.client.GetUserById(req.Context(), &userv1.GetUserByIdRequest{Id: id})
+			if err != nil {
+				req.SetUpstreamError(err)
+				return
+			}
+			dto := &PatchUserRequest{RoleId: current.User.RoleId}
+			if err = req.MustGetPatch().Apply(req.Context(), dto); err != nil {
+				req.SetBadRequest(err.Error(), response.InvalidPatch)
+				return
+			}
+			_, err = s.client.UpdateUser(req.Context(), &userv1.UpdateUserRequest{
+				Id:       id,
+				Password: dto.Password,
+				RoleId:   dto.RoleId,
+			})
+			if err != nil {
+				req.SetUpstreamError(err)
+				return
+			}
+			s.permissions.InvalidateUser(id)
+			req.ReturnStatus(http.StatusOK, nil)
+		},
+	}
+}
+
 func (s UserHandler) DeleteUser() *httpapi.RequestDefinition {
 	return &httpapi.RequestDefinition{
 		Route:          "/:id",
@@ -191,11 +252,18 @@ func (s UserHandler) DeleteUser() *httpapi.RequestDefinition {
 		},
 		Handler: func(req httpapi.Request) {
 			id := req.MustGet(idDef.GetName()).(string)
-			_, err := s.client.DeleteUser(context.Background(), &userv1.DeleteUserRequest{
+			_, err := s.client.DeleteUser(req.Context(), &userv1.DeleteUserRequest{
 				Id: id,
 			})
 			if err != nil {
-				req.SetBadRequest(PleaseReadTheErrorCode, err.Error())
+				req.SetUpstreamError(err)
+				return
+			}
+			s.permissions.InvalidateUser(id)
+			// A deleted user must not keep using the tokens issued before
+			err = s.sessions.RevokeUser(id)
+			if err != nil {
+				req.SetServerError(err.Error())
 				return
 			}
 			req.ReturnStatus(http.StatusOK, nil)
@@ -249,6 +317,27 @@ func (dto UpdateUserRequest) Validate(ctx context.Context) error {
 	return nil
 }
 
+type PatchUserRequest struct {
+	Password string `json:"password,omitempty"`
+	RoleId   string `json:"roleId" validate:"required,uuid"`
+}
+
+var (
+	ErrRoleIdRequired = errors.New("roleId is required")
+	// ErrPasswordRequired keeps a patch from sending an empty password, the update replaces it
+	ErrPasswordRequired = errors.New("password is required, it can not be read back")
+)
+
+func (dto PatchUserRequest) Validate(ctx context.Context) error {
+	if dto.RoleId == "" {
+		return ErrRoleIdRequired
+	}
+	if dto.Password == "" {
+		return ErrPasswordRequired
+	}
+	return nil
+}
+
 type DeleteUserRequest struct {
 	Id string `json:"id" validate:"required,uuid"`
 }
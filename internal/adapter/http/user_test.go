@@ -0,0 +1,61 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nullexp/finman-api-gateway/internal/adapter"
+	userv1 "github.com/nullexp/finman-api-gateway/internal/adapter/grpc/user/v1"
+	"github.com/nullexp/finman-api-gateway/internal/port/model"
+	"github.com/nullexp/finman-api-gateway/pkg/infrastructure/http/protocol/response"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+)
+
+// testUserClient serves a single user and keeps the updates sent to it.
+type testUserClient struct {
+	userv1.UserServiceClient
+	user    *userv1.User
+	updates []*userv1.UpdateUserRequest
+}
+
+func (c *testUserClient) GetUserById(_ context.Context, in *userv1.GetUserByIdRequest, _ ...grpc.CallOption) (*userv1.GetUserByIdResponse, error) {
+	return &userv1.GetUserByIdResponse{User: c.user}, nil
+}
+
+func (c *testUserClient) UpdateUser(_ context.Context, in *userv1.UpdateUserRequest, _ ...grpc.CallOption) (*userv1.UpdateUserResponse, error) {
+	c.updates = append(c.updates, in)
+	return &userv1.UpdateUserResponse{}, nil
+}
+
+func TestPatchUser(t *testing.T) {
+	tokens := adapter.NewTokenService("secret", time.Hour)
+	admin, err := tokens.CreateToken(model.Subject{UserId: uuid.NewString(), IsAdmin: true})
+	assert.NoError(t, err)
+	user := &userv1.User{Id: uuid.NewString(), Username: "alice", RoleId: uuid.NewString()}
+	client := &testUserClient{user: user}
+	cache := adapter.NewPermissionCache(10, time.Minute, time.Minute)
+	app := newTestApp(tokens, adapter.NewBatchAuthorizer(nil, nil, tokens, cache), NewUser(client, tokens, nil, cache))
+
+	patch := func(body any) *http.Response {
+		return send(app, http.MethodPatch, UserBaseURL+"/"+user.Id, body, admin).Result()
+	}
+
+	t.Run("Expect patched password to be sent with the current role", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, patch(map[string]any{"password": "new-secret"}).StatusCode)
+		assert.Len(t, client.updates, 1)
+		assert.True(t, proto.Equal(&userv1.UpdateUserRequest{Id: user.Id, Password: "new-secret", RoleId: user.RoleId}, client.updates[0]), client.updates[0].String())
+	})
+
+	t.Run("Expect patch leaving out the password to fail before the update", func(t *testing.T) {
+		client.updates = nil
+		w := send(app, http.MethodPatch, UserBaseURL+"/"+user.Id, map[string]any{"roleId": uuid.NewString()}, admin)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, response.InvalidPatch, decodeError(t, w).Code)
+		assert.Empty(t, client.updates)
+	})
+}
@@ -10,45 +10,168 @@ import (
 
 	"github.com/golang-jwt/jwt"
 	"github.com/google/uuid"
+	driven "github.com/nullexp/finman-api-gateway/internal/port"
 	"github.com/nullexp/finman-api-gateway/internal/port/model"
 	"github.com/nullexp/finman-api-gateway/pkg/infrastructure/misc"
 )
 
+// claimsSkippingParser only verifies signatures. Registered claims are checked by the
+// gateway claims policy, which knows the accepted issuers, audiences and leeway.
+var claimsSkippingParser = &jwt.Parser{SkipClaimsValidation: true}
+
+const defaultImpersonationExpireAfter = 15 * time.Minute
+
 // TokenService is a struct that manages JWT tokens.
 type TokenService struct {
-	secret      string
+	secret      string // shared secret of tokens without kid, such as the ones of the auth service
 	expireAfter time.Duration
+	keys        *KeyRing
+	issuer      string
+	audience    []string
+
+	impersonationExpireAfter time.Duration
+
+	refreshStore       driven.RefreshTokenStore
+	refreshExpireAfter time.Duration
 }
 
 // NewTokenService creates a new TokenService with the provided secret.
 func NewTokenService(secret string, expireAfter time.Duration) *TokenService {
-	return &TokenService{secret: secret, expireAfter: expireAfter}
+	return &TokenService{secret: secret, expireAfter: expireAfter, keys: NewKeyRing(expireAfter), impersonationExpireAfter: defaultImpersonationExpireAfter}
+}
+
+// SetSigningKey makes the service sign new tokens with the given key and a kid header instead of the shared secret.
+// The extra keys are only used to verify tokens carrying their kid. Asymmetric keys without kid are rejected,
+// their tokens would be verified with the shared secret and fail.
+func (ts *TokenService) SetSigningKey(signer SigningKey, verifyOnly ...SigningKey) error {
+	for _, v := range append([]SigningKey{signer}, verifyOnly...) {
+		if _, asymmetric := v.ToJwk(); asymmetric && v.Id == "" {
+			return ErrMissingKeyId
+		}
+	}
+	for _, v := range verifyOnly {
+		if err := ts.keys.Add(v); err != nil {
+			return err
+		}
+	}
+	if err := ts.keys.Add(signer); err != nil {
+		return err
+	}
+	return ts.keys.Promote(signer.Id)
+}
+
+// SetIssuer stamps the iss and aud claims of the tokens created from now on.
+func (ts *TokenService) SetIssuer(issuer string, audience ...string) {
+	ts.issuer = issuer
+	ts.audience = audience
+}
+
+// SetImpersonationExpireAfter sets the lifetime of impersonation tokens, it should stay well below the lifetime of other tokens.
+func (ts *TokenService) SetImpersonationExpireAfter(expireAfter time.Duration) {
+	ts.impersonationExpireAfter = expireAfter
+}
+
+// KeyRing returns the keys tokens are signed and verified with, for rotation.
+func (ts TokenService) KeyRing() *KeyRing {
+	return ts.keys
+}
+
+// GetJwks returns the public part of every asymmetric key, so other services can verify our tokens.
+func (ts TokenService) GetJwks() model.Jwks {
+	return ts.keys.GetJwks()
 }
 
 // CreateToken generates a JWT token for the given subject.
 func (ts TokenService) CreateToken(sb model.Subject) (string, error) {
-	// Marshal the subject to JSON.
-	data, err := json.Marshal(sb)
+	enc, err := encodeSubject(sb)
 	if err != nil {
-		log.Printf("Error marshaling subject: %v", err)
 		return "", err
 	}
-
-	// Encode the JSON data to a base64 string.
-	enc := base64.RawStdEncoding.EncodeToString(data)
 	log.Printf("Encoded subject to base64: %s", enc)
 
 	// Create the token with the encoded subject.
-	return ts.createTokenWithText(enc, ts.expireAfter)
+	return ts.createTokenWithText(enc, "", ts.expireAfter)
+}
+
+// createSessionToken generates a JWT token of the login session for the given subject.
+func (ts TokenService) createSessionToken(sb model.Subject, session string) (string, error) {
+	enc, err := encodeSubject(sb)
+	if err != nil {
+		return "", err
+	}
+	claims := ts.newClaims(enc, ts.expireAfter)
+	claims.SessionId = session
+	return ts.sign(claims)
+}
+
+// CreateScopedToken generates a JWT token for the given subject that grants only the given scopes.
+func (ts TokenService) CreateScopedToken(sb model.Subject, scopes []string) (string, error) {
+	enc, err := encodeSubject(sb)
+	if err != nil {
+		return "", err
+	}
+	return ts.createTokenWithText(enc, strings.Join(scopes, " "), ts.expireAfter)
+}
+
+// CreateImpersonationToken generates a short lived JWT token for the target subject, its act claim names the admin.
+func (ts TokenService) CreateImpersonationToken(target model.Subject, actorId string) (string, time.Time, error) {
+	enc, err := encodeSubject(target)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	claims := ts.newClaims(enc, ts.impersonationExpireAfter)
+	claims.Actor = &model.Actor{Subject: actorId}
+	token, err := ts.sign(claims)
+	return token, time.Unix(claims.ExpiresAt, 0), err
+}
+
+// GetExpireAfter returns the lifetime of created tokens.
+func (ts TokenService) GetExpireAfter() time.Duration {
+	return ts.expireAfter
 }
 
 // CreateTokenWithText generates a JWT token with the provided text and expireTime.
-func (ts TokenService) createTokenWithText(sb string, expireAfter time.Duration) (string, error) {
-	t := jwt.New(jwt.GetSigningMethod("HS256"))
-	t.Claims = model.StandardClaims{Subject: sb, ExpiresAt: time.Now().Add(expireAfter).Unix(), Identity: uuid.NewString()}
+func (ts TokenService) createTokenWithText(sb, scope string, expireAfter time.Duration) (string, error) {
+	claims := ts.newClaims(sb, expireAfter)
+	claims.Scope = scope
+	return ts.sign(claims)
+}
+
+func (ts TokenService) newClaims(sb string, expireAfter time.Duration) model.StandardClaims {
+	// The jti is a version 7 uuid, it keeps the issue time to the millisecond for revocations
+	id, err := uuid.NewV7()
+	if err != nil {
+		id = uuid.New()
+	}
+	now := time.Now()
+	if id.Version() == 7 {
+		now = time.Unix(id.Time().UnixTime())
+	}
+	return model.StandardClaims{
+		Subject:   sb,
+		Issuer:    ts.issuer,
+		Audience:  ts.audience,
+		IssuedAt:  now.Unix(),
+		NotBefore: now.Unix(),
+		ExpiresAt: now.Add(expireAfter).Unix(),
+		Identity:  id.String(),
+	}
+}
 
-	// Sign the token with the secret.
-	tokenString, err := t.SignedString([]byte(ts.secret))
+// sign signs the claims with the active key, or with the shared secret when the ring is empty.
+func (ts TokenService) sign(claims model.StandardClaims) (string, error) {
+	signer, ok := ts.keys.Active()
+	if !ok {
+		signer = NewHMACKey("", ts.secret)
+	}
+
+	t := jwt.New(signer.Method)
+	if signer.Id != "" {
+		t.Header["kid"] = signer.Id
+	}
+	t.Claims = claims
+
+	tokenString, err := t.SignedString(signer.Private)
 	if err != nil {
 		log.Printf("Error signing token: %v", err)
 		return "", err
@@ -62,12 +185,7 @@ func (ts TokenService) GetToken(tokenString string) (model.StandardClaims, error
 	sc := model.StandardClaims{}
 
 	// Parse the token.
-	rawToken, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, errors.New("unexpected signing method")
-		}
-		return []byte(ts.secret), nil
-	})
+	rawToken, err := claimsSkippingParser.Parse(tokenString, ts.getVerifyKey)
 	if err != nil {
 		log.Printf("Error parsing token: %v", err)
 		return sc, err
@@ -103,13 +221,7 @@ func (ts TokenService) GetToken(tokenString string) (model.StandardClaims, error
 // CheckToken validates the given token string.
 func (ts TokenService) CheckToken(tokenString string) (bool, error) {
 	// Parse the token.
-	_, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			log.Printf("Unexpected signing method: %v", token.Header["alg"])
-			return nil, errors.New("unexpected signing method")
-		}
-		return []byte(ts.secret), nil
-	})
+	_, err := claimsSkippingParser.Parse(tokenString, ts.getVerifyKey)
 	// Check if there was an error parsing the token.
 	if err != nil {
 		log.Printf("Error checking token: %v", err)
@@ -120,6 +232,39 @@ func (ts TokenService) CheckToken(tokenString string) (bool, error) {
 	return true, nil
 }
 
+// getVerifyKey picks the verification key by the kid header, tokens without kid are checked against the shared secret.
+func (ts TokenService) getVerifyKey(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok || ts.secret == "" {
+			log.Printf("Unexpected signing method: %v", token.Header["alg"])
+			return nil, ErrUnexpectedSigningMethod
+		}
+		return []byte(ts.secret), nil
+	}
+
+	key, ok := ts.keys.Get(kid)
+	if !ok {
+		log.Printf("Unknown key id: %s", kid)
+		return nil, ErrUnknownKey
+	}
+	if key.Method.Alg() != token.Method.Alg() {
+		log.Printf("Unexpected signing method: %v", token.Header["alg"])
+		return nil, ErrUnexpectedSigningMethod
+	}
+	return key.Public, nil
+}
+
+// encodeSubject marshals the subject to JSON and encodes it to the base64 form kept in the sub claim.
+func encodeSubject(sb model.Subject) (string, error) {
+	data, err := json.Marshal(sb)
+	if err != nil {
+		log.Printf("Error marshaling subject: %v", err)
+		return "", err
+	}
+	return base64.RawStdEncoding.EncodeToString(data), nil
+}
+
 func (ts TokenService) GetSubject(subject string) (out model.Subject, err error) {
 	data, err := base64.RawStdEncoding.DecodeString(subject)
 	if err != nil {
@@ -139,7 +284,11 @@ func (ts TokenService) MustParseSubject(subject string) (out model.Subject) {
 }
 
 func (ts TokenService) GetModel(token string) (misc.JwtClaim, error) {
-	return ts.GetToken(token)
+	claims, err := ts.GetToken(token)
+	if err != nil || claims.Scope == "" {
+		return claims, err
+	}
+	return model.ScopedClaims{StandardClaims: claims, Scopes: strings.Fields(claims.Scope)}, nil
 }
 
 // NewValidJwtClaim creates a new valid JWT claim with the given expiration time.
@@ -8,6 +8,7 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/nullexp/finman-api-gateway/internal/port/model"
+	"github.com/nullexp/finman-api-gateway/pkg/infrastructure/misc"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -116,3 +117,69 @@ func TestTokenService_CheckTokenInvalidSecret(t *testing.T) {
 	assert.Error(t, err)
 	assert.False(t, valid)
 }
+
+func TestTokenServiceStampsRegisteredClaims(t *testing.T) {
+	ts := NewTokenService("testsecret", time.Hour)
+	ts.SetIssuer("gateway", "finman")
+
+	token, err := ts.CreateToken(model.Subject{UserId: uuid.New().String()})
+	assert.NoError(t, err)
+
+	claims, err := ts.GetToken(token)
+	assert.NoError(t, err)
+	assert.Equal(t, "gateway", claims.Issuer)
+	assert.Equal(t, []string{"finman"}, claims.Audience)
+	assert.NotZero(t, claims.NotBefore)
+	assert.NoError(t, misc.ClaimsPolicy{Issuers: []string{"gateway"}, Audiences: []string{"finman"}}.Validate(claims))
+	assert.ErrorIs(t, misc.ClaimsPolicy{Audiences: []string{"other"}}.Validate(claims), misc.ErrInvalidAudience)
+}
+
+func TestTokenServiceLeavesClaimsToPolicy(t *testing.T) {
+	ts := NewTokenService("testsecret", -time.Minute)
+
+	token, err := ts.CreateToken(model.Subject{UserId: uuid.New().String()})
+	assert.NoError(t, err)
+
+	// Expired tokens still parse, so the gateway can answer with the matching error code
+	claims, err := ts.GetToken(token)
+	assert.NoError(t, err)
+	assert.ErrorIs(t, claims.Valid(), misc.ErrTokenExpired)
+	assert.NoError(t, misc.ClaimsPolicy{Leeway: 2 * time.Minute}.Validate(claims))
+}
+
+func TestTokenServiceCreateImpersonationToken(t *testing.T) {
+	ts := NewTokenService("testsecret", time.Hour)
+	ts.SetImpersonationExpireAfter(5 * time.Minute)
+	target := model.Subject{UserId: uuid.New().String()}
+
+	token, expiresAt, err := ts.CreateImpersonationToken(target, "admin")
+	assert.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(5*time.Minute), expiresAt, time.Second)
+
+	claim, err := ts.GetModel(token)
+	assert.NoError(t, err)
+	acting, ok := claim.(misc.ActingClaim)
+	assert.True(t, ok)
+	assert.Equal(t, "admin", acting.GetActor())
+	assert.Equal(t, target, ts.MustParseSubject(claim.GetSubject()))
+
+	// Regular tokens carry no actor
+	token, err = ts.CreateToken(target)
+	assert.NoError(t, err)
+	claim, err = ts.GetModel(token)
+	assert.NoError(t, err)
+	assert.Empty(t, claim.(misc.ActingClaim).GetActor())
+}
+
+func TestTokenServiceCreateScopedToken(t *testing.T) {
+	ts := NewTokenService("testsecret", time.Hour)
+	scopes := []string{"ManageUsers", "GET:/users/me/permissions"}
+
+	token, err := ts.CreateScopedToken(model.Subject{UserId: uuid.New().String()}, scopes)
+	assert.NoError(t, err)
+	claim, err := ts.GetModel(token)
+	assert.NoError(t, err)
+	scoped, ok := claim.(misc.ScopedClaim)
+	assert.True(t, ok)
+	assert.Equal(t, scopes, scoped.GetScopes())
+}
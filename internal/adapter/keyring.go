@@ -0,0 +1,443 @@
+package adapter
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/google/uuid"
+	driven "github.com/nullexp/finman-api-gateway/internal/port"
+	"github.com/nullexp/finman-api-gateway/internal/port/model"
+)
+
+const rsaKeyBits = 2048
+
+// keyReloadInterval bounds how often a kid missing from the ring has it read the store again.
+const keyReloadInterval = 10 * time.Second
+
+type ringKey struct {
+	SigningKey
+	retireAt int64 // zero while the key is active or kept until retired by hand
+}
+
+// KeyRing holds one active signing key and any number of verify-only keys identified by kid.
+// A demoted key keeps verifying for the overlap window, so tokens signed before a rotation
+// stay valid until they expire. Every change is kept in the store of the ring, and a token
+// signed with a kid the ring does not know has it read the store again, so keys rotated by
+// another instance sharing the store are picked up.
+type KeyRing struct {
+	mu       sync.RWMutex
+	active   string
+	keys     map[string]ringKey
+	overlap  time.Duration
+	store    driven.SigningKeyStore
+	loadedAt time.Time
+}
+
+// NewKeyRing creates an empty key ring kept in memory until SetStore is called. overlap should be at
+// least the lifetime of access tokens.
+func NewKeyRing(overlap time.Duration) *KeyRing {
+	return &KeyRing{keys: map[string]ringKey{}, overlap: overlap, store: NewMemorySigningKeyStore()}
+}
+
+// SetStore keeps the ring in the store, the keys of the ring are replaced by the ones it holds.
+func (r *KeyRing) SetStore(store driven.SigningKeyStore) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.store = store
+	return r.load()
+}
+
+// load replaces the keys of the ring by the ones of the store. Caller must hold the lock.
+func (r *KeyRing) load() error {
+	r.loadedAt = time.Now()
+	stored, err := r.store.GetAll()
+	if err != nil {
+		return err
+	}
+	keys := map[string]ringKey{}
+	active := ""
+	for _, v := range stored {
+		key, err := storedSigningKey(v)
+		if err != nil {
+			return fmt.Errorf("signing key %s: %w", v.Id, err)
+		}
+		keys[v.Id] = ringKey{SigningKey: key, retireAt: v.RetireAt}
+		if v.Active {
+			active = v.Id
+		}
+	}
+	r.keys, r.active = keys, active
+	r.sweep()
+	return nil
+}
+
+// save keeps the key in the store. Caller must hold the lock.
+func (r *KeyRing) save(key ringKey, active bool) error {
+	stored, err := key.toStored()
+	if err != nil {
+		return err
+	}
+	stored.Active, stored.RetireAt = active, key.retireAt
+	return r.store.Save(stored)
+}
+
+// Add puts a verify-only key on the ring, replacing any key with the same kid.
+func (r *KeyRing) Add(key SigningKey) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.sweep()
+	added := ringKey{SigningKey: key}
+	if err := r.save(added, key.Id == r.active); err != nil {
+		return err
+	}
+	r.keys[key.Id] = added
+	return nil
+}
+
+// Promote makes the key with the given kid the signing key. The previously active key is
+// kept for verification until the overlap window passes.
+func (r *KeyRing) Promote(kid string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.sweep()
+	key, ok := r.keys[kid]
+	if !ok || key.Private == nil {
+		return driven.ErrSigningKeyNotFound
+	}
+	key.retireAt = 0
+	if err := r.save(key, true); err != nil {
+		return err
+	}
+	if previous, ok := r.keys[r.active]; ok && r.active != kid {
+		previous.retireAt = time.Now().Add(r.overlap).Unix()
+		if err := r.save(previous, false); err != nil {
+			return err
+		}
+		r.keys[r.active] = previous
+	}
+	r.keys[kid] = key
+	r.active = kid
+	log.Printf("Signing key %s is promoted", kid)
+	return nil
+}
+
+// Retire removes a verify-only key at once, tokens signed with it are rejected from now on.
+func (r *KeyRing) Retire(kid string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if kid == r.active {
+		return driven.ErrRetireActiveKey
+	}
+	if _, ok := r.keys[kid]; !ok {
+		return driven.ErrSigningKeyNotFound
+	}
+	if err := r.store.Delete(kid); err != nil {
+		return err
+	}
+	delete(r.keys, kid)
+	log.Printf("Signing key %s is retired", kid)
+	return nil
+}
+
+// Active returns the key new tokens are signed with.
+func (r *KeyRing) Active() (SigningKey, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	key, ok := r.keys[r.active]
+	return key.SigningKey, ok
+}
+
+// Get returns a key that may still verify tokens. A kid the ring does not know has it read the store
+// again, at most once every keyReloadInterval.
+func (r *KeyRing) Get(kid string) (SigningKey, bool) {
+	r.mu.RLock()
+	key, ok := r.keys[kid]
+	stale := time.Since(r.loadedAt) > keyReloadInterval
+	r.mu.RUnlock()
+
+	if !ok && stale {
+		r.mu.Lock()
+		if time.Since(r.loadedAt) > keyReloadInterval {
+			if err := r.load(); err != nil {
+				log.Printf("Error loading signing keys: %v", err)
+			}
+		}
+		key, ok = r.keys[kid]
+		r.mu.Unlock()
+	}
+	if !ok || key.isRetired(time.Now().Unix()) {
+		return SigningKey{}, false
+	}
+	return key.SigningKey, true
+}
+
+func (r *KeyRing) GetKeys() []model.SigningKeyInfo {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	now := time.Now().Unix()
+	out := []model.SigningKeyInfo{}
+	for _, v := range r.keys {
+		if v.isRetired(now) {
+			continue
+		}
+		out = append(out, model.SigningKeyInfo{Id: v.Id, Algorithm: v.Method.Alg(), Active: v.Id == r.active, RetireAt: v.retireAt})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Id < out[j].Id })
+	return out
+}
+
+func (r *KeyRing) GetJwks() model.Jwks {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	now := time.Now().Unix()
+	out := model.Jwks{Keys: []model.Jwk{}}
+	for _, v := range r.keys {
+		if v.isRetired(now) {
+			continue
+		}
+		if jwk, ok := v.ToJwk(); ok {
+			out.Keys = append(out.Keys, jwk)
+		}
+	}
+	sort.Slice(out.Keys, func(i, j int) bool { return out.Keys[i].KeyId < out.Keys[j].KeyId })
+	return out
+}
+
+// GenerateKey creates a fresh verify-only key. Publishing it before promotion lets verifiers
+// pick it up from the JWKS ahead of the first token signed with it.
+func (r *KeyRing) GenerateKey(alg string) (model.SigningKeyInfo, error) {
+	key, err := GenerateSigningKey(uuid.NewString(), alg)
+	if err != nil {
+		return model.SigningKeyInfo{}, err
+	}
+	if err := r.Add(key); err != nil {
+		return model.SigningKeyInfo{}, err
+	}
+	return model.SigningKeyInfo{Id: key.Id, Algorithm: key.Method.Alg()}, nil
+}
+
+// Rotate generates a new key and promotes it.
+func (r *KeyRing) Rotate(alg string) error {
+	info, err := r.GenerateKey(alg)
+	if err != nil {
+		return err
+	}
+	return r.Promote(info.Id)
+}
+
+// RunRotation rotates the signing key every interval until the context is done.
+func (r *KeyRing) RunRotation(ctx context.Context, every time.Duration, alg string) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.Rotate(alg); err != nil {
+				log.Printf("Error rotating signing key: %v", err)
+			}
+		}
+	}
+}
+
+// sweep drops keys whose overlap window has passed. Caller must hold the lock.
+func (r *KeyRing) sweep() {
+	now := time.Now().Unix()
+	for k, v := range r.keys {
+		if v.isRetired(now) {
+			if err := r.store.Delete(k); err != nil {
+				log.Printf("Error deleting signing key %s: %v", k, err)
+			}
+			delete(r.keys, k)
+		}
+	}
+}
+
+func (k ringKey) isRetired(now int64) bool {
+	return k.retireAt != 0 && k.retireAt < now
+}
+
+// GenerateSigningKey creates a random key for the given algorithm.
+func GenerateSigningKey(id, alg string) (SigningKey, error) {
+	method := jwt.GetSigningMethod(alg)
+	if method == nil {
+		return SigningKey{}, ErrUnsupportedAlgorithm
+	}
+
+	key := SigningKey{Id: id, Method: method}
+	switch m := method.(type) {
+	case *jwt.SigningMethodHMAC:
+		secret := make([]byte, m.Hash.Size())
+		if _, err := rand.Read(secret); err != nil {
+			return key, err
+		}
+		key.Private, key.Public = secret, secret
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+		private, err := rsa.GenerateKey(rand.Reader, rsaKeyBits)
+		if err != nil {
+			return key, err
+		}
+		key.Private, key.Public = private, private.Public()
+	case *jwt.SigningMethodECDSA:
+		curve, ok := map[int]elliptic.Curve{256: elliptic.P256(), 384: elliptic.P384(), 521: elliptic.P521()}[m.CurveBits]
+		if !ok {
+			return key, ErrUnsupportedAlgorithm
+		}
+		private, err := ecdsa.GenerateKey(curve, rand.Reader)
+		if err != nil {
+			return key, err
+		}
+		key.Private, key.Public = private, private.Public()
+	case *jwt.SigningMethodEd25519:
+		public, private, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return key, err
+		}
+		key.Private, key.Public = private, public
+	default:
+		return key, ErrUnsupportedAlgorithm
+	}
+	return key, nil
+}
+
+type memorySigningKeyStore struct {
+	mu   sync.RWMutex
+	keys map[string]model.StoredSigningKey
+}
+
+// NewMemorySigningKeyStore creates a process local signing key store, its keys are lost on restart.
+func NewMemorySigningKeyStore() driven.SigningKeyStore {
+	return &memorySigningKeyStore{keys: map[string]model.StoredSigningKey{}}
+}
+
+func (s *memorySigningKeyStore) Save(key model.StoredSigningKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.keys[key.Id] = key
+	return nil
+}
+
+func (s *memorySigningKeyStore) GetAll() ([]model.StoredSigningKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return sortedStoredKeys(s.keys), nil
+}
+
+func (s *memorySigningKeyStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.keys, id)
+	return nil
+}
+
+type fileSigningKeyStore struct {
+	mu   sync.Mutex
+	path string
+}
+
+// NewFileSigningKeyStore creates a signing key store kept in a JSON file only its owner can read. The
+// file is replaced as a whole on every change, a missing file holds no key.
+func NewFileSigningKeyStore(path string) driven.SigningKeyStore {
+	return &fileSigningKeyStore{path: path}
+}
+
+func (s *fileSigningKeyStore) Save(key model.StoredSigningKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys, err := s.read()
+	if err != nil {
+		return err
+	}
+	keys[key.Id] = key
+	return s.write(keys)
+}
+
+func (s *fileSigningKeyStore) GetAll() ([]model.StoredSigningKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+	return sortedStoredKeys(keys), nil
+}
+
+func (s *fileSigningKeyStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys, err := s.read()
+	if err != nil {
+		return err
+	}
+	delete(keys, id)
+	return s.write(keys)
+}
+
+func (s *fileSigningKeyStore) read() (map[string]model.StoredSigningKey, error) {
+	keys := map[string]model.StoredSigningKey{}
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return keys, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	stored := []model.StoredSigningKey{}
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return nil, err
+	}
+	for _, v := range stored {
+		keys[v.Id] = v
+	}
+	return keys, nil
+}
+
+// write replaces the file through a temporary one, readers never see it half written.
+func (s *fileSigningKeyStore) write(keys map[string]model.StoredSigningKey) error {
+	data, err := json.MarshalIndent(sortedStoredKeys(keys), "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+func sortedStoredKeys(keys map[string]model.StoredSigningKey) []model.StoredSigningKey {
+	out := make([]model.StoredSigningKey, 0, len(keys))
+	for _, v := range keys {
+		out = append(out, v)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Id < out[j].Id })
+	return out
+}
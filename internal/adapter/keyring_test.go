@@ -0,0 +1,160 @@
+package adapter
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	driven "github.com/nullexp/finman-api-gateway/internal/port"
+	"github.com/nullexp/finman-api-gateway/internal/port/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerateSigningKey(t *testing.T) {
+	for _, alg := range []string{"HS256", "RS256", "PS256", "ES256", "ES384", "EdDSA"} {
+		key, err := GenerateSigningKey(alg, alg)
+		assert.NoError(t, err, alg)
+		assert.Equal(t, alg, key.Method.Alg())
+		assert.NotNil(t, key.Private, alg)
+	}
+	_, err := GenerateSigningKey("none", "none")
+	assert.ErrorIs(t, err, ErrUnsupportedAlgorithm)
+}
+
+func TestKeyRotationKeepsOldTokensValid(t *testing.T) {
+	ts := NewTokenService("testsecret", time.Hour)
+	ring := ts.KeyRing()
+	assert.NoError(t, ring.Rotate("ES256"))
+	first, _ := ring.Active()
+
+	token, err := ts.CreateToken(model.Subject{UserId: uuid.NewString()})
+	assert.NoError(t, err)
+
+	assert.NoError(t, ring.Rotate("ES256"))
+	second, _ := ring.Active()
+	assert.NotEqual(t, first.Id, second.Id)
+
+	valid, err := ts.CheckToken(token)
+	assert.NoError(t, err)
+	assert.True(t, valid)
+	assert.Len(t, ts.GetJwks().Keys, 2)
+
+	keys := ring.GetKeys()
+	assert.Len(t, keys, 2)
+	for _, v := range keys {
+		if v.Id == first.Id {
+			assert.False(t, v.Active)
+			assert.NotZero(t, v.RetireAt)
+		} else {
+			assert.True(t, v.Active)
+			assert.Zero(t, v.RetireAt)
+		}
+	}
+
+	assert.NoError(t, ring.Retire(first.Id))
+	_, err = ts.CheckToken(token)
+	assert.Error(t, err)
+}
+
+func TestKeyRingOverlapEnds(t *testing.T) {
+	ring := NewKeyRing(-time.Second)
+	assert.NoError(t, ring.Rotate("HS256"))
+	first, _ := ring.Active()
+	assert.NoError(t, ring.Rotate("HS256"))
+
+	_, ok := ring.Get(first.Id)
+	assert.False(t, ok)
+	assert.Len(t, ring.GetKeys(), 1)
+}
+
+func TestKeyRingErrors(t *testing.T) {
+	ring := NewKeyRing(time.Hour)
+	assert.ErrorIs(t, ring.Promote("missing"), driven.ErrSigningKeyNotFound)
+	assert.ErrorIs(t, ring.Retire("missing"), driven.ErrSigningKeyNotFound)
+
+	info, err := ring.GenerateKey("RS256")
+	assert.NoError(t, err)
+	assert.False(t, info.Active)
+	assert.Len(t, ring.GetJwks().Keys, 1)
+
+	assert.NoError(t, ring.Promote(info.Id))
+	assert.ErrorIs(t, ring.Retire(info.Id), driven.ErrRetireActiveKey)
+
+	verifyOnly, err := GenerateSigningKey("public", "RS256")
+	assert.NoError(t, err)
+	verifyOnly.Private = nil
+	assert.NoError(t, ring.Add(verifyOnly))
+	assert.ErrorIs(t, ring.Promote("public"), driven.ErrSigningKeyNotFound)
+}
+
+func TestStoredSigningKey(t *testing.T) {
+	for _, alg := range []string{"HS256", "RS256", "PS256", "ES256", "ES384", "EdDSA"} {
+		key, err := GenerateSigningKey(alg, alg)
+		assert.NoError(t, err, alg)
+		stored, err := key.toStored()
+		assert.NoError(t, err, alg)
+		loaded, err := storedSigningKey(stored)
+		assert.NoError(t, err, alg)
+		assert.Equal(t, key, loaded, alg)
+
+		if alg == "HS256" {
+			continue
+		}
+		key.Private = nil
+		stored, err = key.toStored()
+		assert.NoError(t, err, alg)
+		loaded, err = storedSigningKey(stored)
+		assert.NoError(t, err, alg)
+		assert.Equal(t, key, loaded, alg)
+	}
+}
+
+func TestKeyRingSurvivesRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	ts := NewTokenService("testsecret", time.Hour)
+	assert.NoError(t, ts.KeyRing().SetStore(NewFileSigningKeyStore(path)))
+	assert.NoError(t, ts.KeyRing().Rotate("ES256"))
+	before, err := ts.CreateToken(model.Subject{UserId: uuid.NewString()})
+	assert.NoError(t, err)
+	assert.NoError(t, ts.KeyRing().Rotate("RS256"))
+	active, _ := ts.KeyRing().Active()
+
+	stat, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), stat.Mode().Perm())
+
+	restarted := NewTokenService("testsecret", time.Hour)
+	assert.NoError(t, restarted.KeyRing().SetStore(NewFileSigningKeyStore(path)))
+	assert.Equal(t, ts.KeyRing().GetKeys(), restarted.KeyRing().GetKeys())
+	valid, err := restarted.CheckToken(before)
+	assert.NoError(t, err)
+	assert.True(t, valid)
+	signer, _ := restarted.KeyRing().Active()
+	assert.Equal(t, active.Id, signer.Id)
+}
+
+func TestKeyRingPicksUpKeysOfOtherInstances(t *testing.T) {
+	store := NewMemorySigningKeyStore()
+	first := NewTokenService("testsecret", time.Hour)
+	second := NewTokenService("testsecret", time.Hour)
+	assert.NoError(t, first.KeyRing().SetStore(store))
+	assert.NoError(t, second.KeyRing().SetStore(store))
+
+	assert.NoError(t, first.KeyRing().Rotate("ES256"))
+	token, err := first.CreateToken(model.Subject{UserId: uuid.NewString()})
+	assert.NoError(t, err)
+
+	// the store was just read, the kid is not looked up again yet
+	_, err = second.CheckToken(token)
+	assert.Error(t, err)
+
+	second.KeyRing().loadedAt = time.Time{}
+	valid, err := second.CheckToken(token)
+	assert.NoError(t, err)
+	assert.True(t, valid)
+	signer, _ := second.KeyRing().Active()
+	active, _ := first.KeyRing().Active()
+	assert.Equal(t, active.Id, signer.Id)
+}
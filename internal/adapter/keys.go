@@ -0,0 +1,261 @@
+package adapter
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/nullexp/finman-api-gateway/internal/port/model"
+)
+
+var (
+	ErrUnknownKey              = errors.New("unknown signing key")
+	ErrUnexpectedSigningMethod = errors.New("unexpected signing method")
+	ErrUnsupportedAlgorithm    = errors.New("unsupported signing algorithm")
+	ErrMissingKeyId            = errors.New("asymmetric signing key needs a kid")
+)
+
+// SigningKey is a key identified by kid that tokens are signed or verified with.
+// Private is nil for keys which are only used for verification.
+type SigningKey struct {
+	Id      string
+	Method  jwt.SigningMethod
+	Private crypto.PrivateKey
+	Public  crypto.PublicKey
+}
+
+// NewHMACKey creates a symmetric HS256 key. HMAC keys are never published in the JWKS.
+func NewHMACKey(id, secret string) SigningKey {
+	return SigningKey{Id: id, Method: jwt.SigningMethodHS256, Private: []byte(secret), Public: []byte(secret)}
+}
+
+// LoadSigningKey reads a PEM encoded private key for the given algorithm (RS256, ES256, EdDSA, ...).
+// An empty id is replaced by the thumbprint of the key.
+func LoadSigningKey(id, alg, path string) (SigningKey, error) {
+	method := jwt.GetSigningMethod(alg)
+	if method == nil {
+		return SigningKey{}, ErrUnsupportedAlgorithm
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return SigningKey{}, err
+	}
+
+	key := SigningKey{Id: id, Method: method}
+	switch method.(type) {
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+		private, err := jwt.ParseRSAPrivateKeyFromPEM(data)
+		if err != nil {
+			return key, err
+		}
+		key.Private, key.Public = private, private.Public()
+	case *jwt.SigningMethodECDSA:
+		private, err := jwt.ParseECPrivateKeyFromPEM(data)
+		if err != nil {
+			return key, err
+		}
+		key.Private, key.Public = private, private.Public()
+	case *jwt.SigningMethodEd25519:
+		private, err := jwt.ParseEdPrivateKeyFromPEM(data)
+		if err != nil {
+			return key, err
+		}
+		key.Private, key.Public = private, private.(crypto.Signer).Public()
+	default:
+		return key, ErrUnsupportedAlgorithm
+	}
+	if key.Id == "" {
+		key.Id, _ = key.Thumbprint()
+	}
+	return key, nil
+}
+
+// LoadVerifyKey reads a PEM encoded public key for the given algorithm, an empty id is replaced by the
+// thumbprint of the key.
+func LoadVerifyKey(id, alg, path string) (SigningKey, error) {
+	method := jwt.GetSigningMethod(alg)
+	if method == nil {
+		return SigningKey{}, ErrUnsupportedAlgorithm
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return SigningKey{}, err
+	}
+
+	key := SigningKey{Id: id, Method: method}
+	switch method.(type) {
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+		key.Public, err = jwt.ParseRSAPublicKeyFromPEM(data)
+	case *jwt.SigningMethodECDSA:
+		key.Public, err = jwt.ParseECPublicKeyFromPEM(data)
+	case *jwt.SigningMethodEd25519:
+		key.Public, err = jwt.ParseEdPublicKeyFromPEM(data)
+	default:
+		err = ErrUnsupportedAlgorithm
+	}
+	if err == nil && key.Id == "" {
+		key.Id, _ = key.Thumbprint()
+	}
+	return key, err
+}
+
+// toStored encodes the key the way a SigningKeyStore keeps it.
+func (k SigningKey) toStored() (model.StoredSigningKey, error) {
+	out := model.StoredSigningKey{Id: k.Id, Algorithm: k.Method.Alg()}
+	var err error
+	switch private := k.Private.(type) {
+	case []byte:
+		out.Private = private
+	case nil:
+		out.Public, err = x509.MarshalPKIXPublicKey(k.Public)
+	default:
+		out.Private, err = x509.MarshalPKCS8PrivateKey(private)
+	}
+	return out, err
+}
+
+// storedSigningKey decodes a key kept by a SigningKeyStore.
+func storedSigningKey(stored model.StoredSigningKey) (SigningKey, error) {
+	method := jwt.GetSigningMethod(stored.Algorithm)
+	if method == nil {
+		return SigningKey{}, ErrUnsupportedAlgorithm
+	}
+
+	key := SigningKey{Id: stored.Id, Method: method}
+	if _, ok := method.(*jwt.SigningMethodHMAC); ok {
+		key.Private, key.Public = stored.Private, stored.Private
+		return key, nil
+	}
+	if stored.Private == nil {
+		public, err := x509.ParsePKIXPublicKey(stored.Public)
+		key.Public = public
+		return key, err
+	}
+	private, err := x509.ParsePKCS8PrivateKey(stored.Private)
+	if err != nil {
+		return key, err
+	}
+	signer, ok := private.(crypto.Signer)
+	if !ok {
+		return key, ErrUnsupportedAlgorithm
+	}
+	key.Private, key.Public = private, signer.Public()
+	return key, nil
+}
+
+// Thumbprint returns the RFC 7638 thumbprint of an asymmetric key, HMAC keys have none.
+func (k SigningKey) Thumbprint() (string, bool) {
+	jwk, ok := k.ToJwk()
+	if !ok {
+		return "", false
+	}
+	// the required members only, in lexicographic order and without whitespace
+	var members string
+	switch jwk.KeyType {
+	case "RSA":
+		members = fmt.Sprintf(`{"e":%q,"kty":%q,"n":%q}`, jwk.E, jwk.KeyType, jwk.N)
+	case "EC":
+		members = fmt.Sprintf(`{"crv":%q,"kty":%q,"x":%q,"y":%q}`, jwk.Curve, jwk.KeyType, jwk.X, jwk.Y)
+	default:
+		members = fmt.Sprintf(`{"crv":%q,"kty":%q,"x":%q}`, jwk.Curve, jwk.KeyType, jwk.X)
+	}
+	sum := sha256.Sum256([]byte(members))
+	return base64.RawURLEncoding.EncodeToString(sum[:]), true
+}
+
+// ToJwk converts the public part of an asymmetric key, HMAC keys are not convertible.
+func (k SigningKey) ToJwk() (model.Jwk, bool) {
+	jwk := model.Jwk{KeyId: k.Id, Algorithm: k.Method.Alg(), Use: "sig"}
+	enc := base64.RawURLEncoding
+
+	switch pub := k.Public.(type) {
+	case *rsa.PublicKey:
+		jwk.KeyType = "RSA"
+		jwk.N = enc.EncodeToString(pub.N.Bytes())
+		jwk.E = enc.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+	case *ecdsa.PublicKey:
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		jwk.KeyType = "EC"
+		jwk.Curve = pub.Curve.Params().Name
+		jwk.X = enc.EncodeToString(pub.X.FillBytes(make([]byte, size)))
+		jwk.Y = enc.EncodeToString(pub.Y.FillBytes(make([]byte, size)))
+	case ed25519.PublicKey:
+		jwk.KeyType = "OKP"
+		jwk.Curve = "Ed25519"
+		jwk.X = enc.EncodeToString(pub)
+	default:
+		return jwk, false
+	}
+	return jwk, true
+}
+
+// KeyFromJwk converts a published public key to a verify-only key. Keys without alg get the
+// usual algorithm of their type.
+func KeyFromJwk(jwk model.Jwk) (SigningKey, error) {
+	enc := base64.RawURLEncoding
+	key := SigningKey{Id: jwk.KeyId}
+	alg := jwk.Algorithm
+
+	switch jwk.KeyType {
+	case "RSA":
+		n, err := enc.DecodeString(jwk.N)
+		if err != nil {
+			return key, err
+		}
+		e, err := enc.DecodeString(jwk.E)
+		if err != nil {
+			return key, err
+		}
+		key.Public = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		if alg == "" {
+			alg = "RS256"
+		}
+	case "EC":
+		curve, ok := map[string]elliptic.Curve{"P-256": elliptic.P256(), "P-384": elliptic.P384(), "P-521": elliptic.P521()}[jwk.Curve]
+		if !ok {
+			return key, ErrUnsupportedAlgorithm
+		}
+		x, err := enc.DecodeString(jwk.X)
+		if err != nil {
+			return key, err
+		}
+		y, err := enc.DecodeString(jwk.Y)
+		if err != nil {
+			return key, err
+		}
+		key.Public = &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if alg == "" {
+			alg = map[string]string{"P-256": "ES256", "P-384": "ES384", "P-521": "ES512"}[jwk.Curve]
+		}
+	case "OKP":
+		x, err := enc.DecodeString(jwk.X)
+		if err != nil {
+			return key, err
+		}
+		if jwk.Curve != "Ed25519" || len(x) != ed25519.PublicKeySize {
+			return key, ErrUnsupportedAlgorithm
+		}
+		key.Public = ed25519.PublicKey(x)
+		if alg == "" {
+			alg = "EdDSA"
+		}
+	default:
+		return key, ErrUnsupportedAlgorithm
+	}
+
+	key.Method = jwt.GetSigningMethod(alg)
+	if key.Method == nil {
+		return key, ErrUnsupportedAlgorithm
+	}
+	return key, nil
+}
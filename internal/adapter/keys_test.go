@@ -0,0 +1,149 @@
+package adapter
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nullexp/finman-api-gateway/internal/port/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func writePrivateKey(t *testing.T, key crypto.PrivateKey) string {
+	data, err := x509.MarshalPKCS8PrivateKey(key)
+	assert.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "key.pem")
+	err = os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: data}), 0o600)
+	assert.NoError(t, err)
+	return path
+}
+
+func TestAsymmetricSigningKeys(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+
+	cases := []struct {
+		alg string
+		kty string
+		key crypto.PrivateKey
+	}{
+		{"RS256", "RSA", rsaKey},
+		{"ES256", "EC", ecKey},
+		{"EdDSA", "OKP", edKey},
+	}
+
+	for _, c := range cases {
+		t.Run(c.alg, func(t *testing.T) {
+			key, err := LoadSigningKey("key-"+c.alg, c.alg, writePrivateKey(t, c.key))
+			assert.NoError(t, err)
+
+			ts := NewTokenService("testsecret", time.Hour)
+			assert.NoError(t, ts.SetSigningKey(key))
+			subject := model.Subject{UserId: uuid.NewString()}
+			token, err := ts.CreateToken(subject)
+			assert.NoError(t, err)
+
+			valid, err := ts.CheckToken(token)
+			assert.NoError(t, err)
+			assert.True(t, valid)
+
+			claims, err := ts.GetToken(token)
+			assert.NoError(t, err)
+			assert.Equal(t, subject, ts.MustParseSubject(claims.Subject))
+
+			jwks := ts.GetJwks()
+			assert.Len(t, jwks.Keys, 1)
+			assert.Equal(t, c.kty, jwks.Keys[0].KeyType)
+			assert.Equal(t, key.Id, jwks.Keys[0].KeyId)
+
+			// A service holding only the shared secret cannot verify it
+			_, err = NewTokenService("testsecret", time.Hour).CheckToken(token)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestSecretTokensStillVerify(t *testing.T) {
+	legacy := NewTokenService("testsecret", time.Hour)
+	token, err := legacy.CreateToken(model.Subject{UserId: uuid.NewString()})
+	assert.NoError(t, err)
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	key, err := LoadSigningKey("ec", "ES256", writePrivateKey(t, ecKey))
+	assert.NoError(t, err)
+
+	ts := NewTokenService("testsecret", time.Hour)
+	assert.NoError(t, ts.SetSigningKey(key))
+	valid, err := ts.CheckToken(token)
+	assert.NoError(t, err)
+	assert.True(t, valid)
+	assert.Empty(t, NewTokenService("testsecret", time.Hour).GetJwks().Keys)
+}
+
+func TestKeyFromJwk(t *testing.T) {
+	for _, alg := range []string{"RS256", "ES384", "EdDSA"} {
+		key, err := GenerateSigningKey("kid-"+alg, alg)
+		assert.NoError(t, err)
+		jwk, ok := key.ToJwk()
+		assert.True(t, ok)
+
+		jwk.Algorithm = ""
+		parsed, err := KeyFromJwk(jwk)
+		assert.NoError(t, err, alg)
+		assert.Equal(t, key.Id, parsed.Id)
+		assert.Equal(t, alg, parsed.Method.Alg())
+		assert.Equal(t, key.Public, parsed.Public)
+	}
+}
+
+func TestSigningKeyWithoutId(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	key, err := LoadSigningKey("", "ES256", writePrivateKey(t, ecKey))
+	assert.NoError(t, err)
+	thumbprint, ok := key.Thumbprint()
+	assert.True(t, ok)
+	assert.Equal(t, thumbprint, key.Id)
+
+	ts := NewTokenService("testsecret", time.Hour)
+	assert.NoError(t, ts.SetSigningKey(key))
+	token, err := ts.CreateToken(model.Subject{UserId: uuid.NewString()})
+	assert.NoError(t, err)
+	valid, err := ts.CheckToken(token)
+	assert.NoError(t, err)
+	assert.True(t, valid)
+
+	key.Id = ""
+	assert.ErrorIs(t, NewTokenService("testsecret", time.Hour).SetSigningKey(key), ErrMissingKeyId)
+}
+
+func TestThumbprint(t *testing.T) {
+	// the example of RFC 7638 section 3.1
+	key, err := KeyFromJwk(model.Jwk{
+		KeyType: "RSA",
+		N:       "0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw",
+		E:       "AQAB",
+	})
+	assert.NoError(t, err)
+	thumbprint, ok := key.Thumbprint()
+	assert.True(t, ok)
+	assert.Equal(t, "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs", thumbprint)
+
+	_, ok = NewHMACKey("hmac", "secret").Thumbprint()
+	assert.False(t, ok)
+}
@@ -0,0 +1,176 @@
+package adapter
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	driven "github.com/nullexp/finman-api-gateway/internal/port"
+	"github.com/nullexp/finman-api-gateway/internal/port/model"
+)
+
+const (
+	userAttemptPrefix = "user:"
+	ipAttemptPrefix   = "ip:"
+)
+
+// LockoutPolicy describes when failed logins lock a username or an ip out.
+type LockoutPolicy struct {
+	MaxFailures   int           // failures of a username before it is locked out
+	IpMaxFailures int           // failures from an ip before it is locked out, higher since clients may share an ip
+	Lockout       time.Duration // the first lockout, doubled by every failure after it
+	MaxLockout    time.Duration
+	ResetAfter    time.Duration // failures are forgotten this long after the last lockout ends
+}
+
+func DefaultLockoutPolicy() LockoutPolicy {
+	return LockoutPolicy{
+		MaxFailures:   5,
+		IpMaxFailures: 20,
+		Lockout:       time.Minute,
+		MaxLockout:    time.Hour,
+		ResetAfter:    15 * time.Minute,
+	}
+}
+
+// LoginGuard counts failed logins per username and per ip and locks them out exponentially.
+type LoginGuard struct {
+	store  driven.LoginAttemptStore
+	policy LockoutPolicy
+}
+
+func NewLoginGuard(store driven.LoginAttemptStore, policy LockoutPolicy) *LoginGuard {
+	return &LoginGuard{store: store, policy: policy}
+}
+
+func (g *LoginGuard) Check(username, ip string) (time.Duration, error) {
+	now := time.Now()
+	var wait time.Duration
+	for _, key := range g.keys(username, ip) {
+		attempts, ok, err := g.store.Get(key)
+		if err != nil {
+			return 0, err
+		}
+		if !ok {
+			continue
+		}
+		if left := time.Unix(attempts.LockedUntil, 0).Sub(now); left > wait {
+			wait = left
+		}
+	}
+	if wait > 0 {
+		return wait, driven.ErrTooManyAttempts
+	}
+	return 0, nil
+}
+
+func (g *LoginGuard) Fail(username, ip string) error {
+	if err := g.fail(userAttemptPrefix+normalizeUsername(username), g.policy.MaxFailures); err != nil {
+		return err
+	}
+	if ip == "" {
+		return nil
+	}
+	return g.fail(ipAttemptPrefix+ip, g.policy.IpMaxFailures)
+}
+
+func (g *LoginGuard) Succeed(username string) error {
+	return g.store.Delete(userAttemptPrefix + normalizeUsername(username))
+}
+
+func (g *LoginGuard) Clear(usernameOrIp string) error {
+	if err := g.store.Delete(userAttemptPrefix + normalizeUsername(usernameOrIp)); err != nil {
+		return err
+	}
+	return g.store.Delete(ipAttemptPrefix + usernameOrIp)
+}
+
+func (g *LoginGuard) fail(key string, maxFailures int) error {
+	now := time.Now()
+	attempts, ok, err := g.store.Get(key)
+	if err != nil {
+		return err
+	}
+	if !ok || attempts.ExpiresAt < now.Unix() {
+		attempts = model.LoginAttempts{Key: key}
+	}
+
+	attempts.Failures++
+	attempts.LastFailure = now.Unix()
+	lockedUntil := now
+	if attempts.Failures >= maxFailures {
+		lockedUntil = now.Add(g.lockout(attempts.Failures - maxFailures))
+		attempts.LockedUntil = lockedUntil.Unix()
+	}
+	attempts.ExpiresAt = lockedUntil.Add(g.policy.ResetAfter).Unix()
+	return g.store.Save(attempts)
+}
+
+// lockout doubles the first lockout for every failure past the limit, up to MaxLockout.
+func (g *LoginGuard) lockout(extraFailures int) time.Duration {
+	d := g.policy.Lockout
+	for i := 0; i < extraFailures && d < g.policy.MaxLockout; i++ {
+		d *= 2
+	}
+	return min(d, g.policy.MaxLockout)
+}
+
+func (g *LoginGuard) keys(username, ip string) []string {
+	keys := []string{userAttemptPrefix + normalizeUsername(username)}
+	if ip != "" {
+		keys = append(keys, ipAttemptPrefix+ip)
+	}
+	return keys
+}
+
+func normalizeUsername(username string) string {
+	return strings.ToLower(strings.TrimSpace(username))
+}
+
+type memoryLoginAttemptStore struct {
+	mu       sync.Mutex
+	attempts map[string]model.LoginAttempts
+}
+
+// NewMemoryLoginAttemptStore creates a process local store, counters are not shared between gateway instances.
+func NewMemoryLoginAttemptStore() driven.LoginAttemptStore {
+	return &memoryLoginAttemptStore{attempts: map[string]model.LoginAttempts{}}
+}
+
+func (s *memoryLoginAttemptStore) Get(key string) (model.LoginAttempts, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	attempts, ok := s.attempts[key]
+	if ok && attempts.ExpiresAt < time.Now().Unix() {
+		delete(s.attempts, key)
+		return model.LoginAttempts{}, false, nil
+	}
+	return attempts, ok, nil
+}
+
+func (s *memoryLoginAttemptStore) Save(attempts model.LoginAttempts) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sweep()
+	s.attempts[attempts.Key] = attempts
+	return nil
+}
+
+func (s *memoryLoginAttemptStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.attempts, key)
+	return nil
+}
+
+func (s *memoryLoginAttemptStore) sweep() {
+	now := time.Now().Unix()
+	for k, v := range s.attempts {
+		if v.ExpiresAt < now {
+			delete(s.attempts, k)
+		}
+	}
+}
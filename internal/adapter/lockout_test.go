@@ -0,0 +1,79 @@
+package adapter
+
+import (
+	"testing"
+	"time"
+
+	driven "github.com/nullexp/finman-api-gateway/internal/port"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestLoginGuard() *LoginGuard {
+	return NewLoginGuard(NewMemoryLoginAttemptStore(), LockoutPolicy{
+		MaxFailures:   3,
+		IpMaxFailures: 5,
+		Lockout:       time.Minute,
+		MaxLockout:    5 * time.Minute,
+		ResetAfter:    time.Hour,
+	})
+}
+
+func TestLoginGuardLocksUsername(t *testing.T) {
+	g := newTestLoginGuard()
+
+	for i := 0; i < 2; i++ {
+		assert.NoError(t, g.Fail("Alice", "10.0.0.1"))
+		_, err := g.Check("alice", "10.0.0.2")
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, g.Fail("alice", "10.0.0.1"))
+
+	wait, err := g.Check("ALICE", "10.0.0.2")
+	assert.ErrorIs(t, err, driven.ErrTooManyAttempts)
+	assert.InDelta(t, time.Minute.Seconds(), wait.Seconds(), 2)
+
+	_, err = g.Check("bob", "10.0.0.2")
+	assert.NoError(t, err)
+}
+
+func TestLoginGuardLocksIp(t *testing.T) {
+	g := newTestLoginGuard()
+
+	for _, v := range []string{"a", "b", "c", "d", "e"} {
+		assert.NoError(t, g.Fail(v, "10.0.0.1"))
+	}
+	_, err := g.Check("f", "10.0.0.1")
+	assert.ErrorIs(t, err, driven.ErrTooManyAttempts)
+	_, err = g.Check("f", "10.0.0.2")
+	assert.NoError(t, err)
+}
+
+func TestLoginGuardLockoutGrows(t *testing.T) {
+	g := newTestLoginGuard()
+	assert.Equal(t, time.Minute, g.lockout(0))
+	assert.Equal(t, 2*time.Minute, g.lockout(1))
+	assert.Equal(t, 4*time.Minute, g.lockout(2))
+	assert.Equal(t, 5*time.Minute, g.lockout(3))
+	assert.Equal(t, 5*time.Minute, g.lockout(100))
+}
+
+func TestLoginGuardSucceedAndClear(t *testing.T) {
+	g := newTestLoginGuard()
+
+	assert.NoError(t, g.Fail("alice", ""))
+	assert.NoError(t, g.Fail("alice", ""))
+	assert.NoError(t, g.Succeed("alice"))
+	assert.NoError(t, g.Fail("alice", ""))
+	_, err := g.Check("alice", "")
+	assert.NoError(t, err, "a successful login forgets earlier failures")
+
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, g.Fail("alice", ""))
+	}
+	_, err = g.Check("alice", "")
+	assert.ErrorIs(t, err, driven.ErrTooManyAttempts)
+
+	assert.NoError(t, g.Clear("alice"))
+	_, err = g.Check("alice", "")
+	assert.NoError(t, err)
+}
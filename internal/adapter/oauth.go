@@ -0,0 +1,150 @@
+package adapter
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	driven "github.com/nullexp/finman-api-gateway/internal/port"
+	"github.com/nullexp/finman-api-gateway/internal/port/model"
+	"github.com/nullexp/finman-api-gateway/pkg/infrastructure/http/protocol"
+	"github.com/nullexp/finman-api-gateway/pkg/infrastructure/misc"
+)
+
+const TokenTypeBearer = "Bearer"
+
+// OAuthServer issues client credentials tokens through the TokenService and introspects tokens.
+type OAuthServer struct {
+	clients     driven.OAuthClientStore
+	secrets     misc.Password
+	tokens      *TokenService
+	policy      misc.ClaimsPolicy
+	revocations protocol.RevocationList
+}
+
+// NewOAuthServer creates an oauth server. Introspection reports tokens failing the policy or
+// revoked by the list as inactive, revocations may be nil.
+func NewOAuthServer(clients driven.OAuthClientStore, secrets misc.Password, tokens *TokenService, policy misc.ClaimsPolicy, revocations protocol.RevocationList) *OAuthServer {
+	return &OAuthServer{clients: clients, secrets: secrets, tokens: tokens, policy: policy, revocations: revocations}
+}
+
+// IssueClientToken grants the requested scopes, or every scope of the client when none is requested.
+func (s *OAuthServer) IssueClientToken(clientId, clientSecret string, scopes []string) (model.OAuthToken, error) {
+	client, err := s.authenticate(clientId, clientSecret)
+	if err != nil {
+		return model.OAuthToken{}, err
+	}
+
+	if len(scopes) == 0 {
+		scopes = client.Scopes
+	}
+	for _, v := range scopes {
+		if !slices.Contains(client.Scopes, v) {
+			return model.OAuthToken{}, driven.ErrInvalidScope
+		}
+	}
+
+	token, err := s.tokens.CreateScopedToken(model.Subject{ClientId: client.Id}, scopes)
+	if err != nil {
+		return model.OAuthToken{}, err
+	}
+	return model.OAuthToken{
+		AccessToken: token,
+		TokenType:   TokenTypeBearer,
+		ExpiresIn:   int64(s.tokens.GetExpireAfter() / time.Second),
+		Scope:       strings.Join(scopes, " "),
+	}, nil
+}
+
+// Introspect reports whether the token is active. Any problem with the token itself makes it inactive,
+// only a failed client authentication is an error.
+func (s *OAuthServer) Introspect(clientId, clientSecret, token string) (model.Introspection, error) {
+	if _, err := s.authenticate(clientId, clientSecret); err != nil {
+		return model.Introspection{}, err
+	}
+
+	inactive := model.Introspection{Active: false}
+	if valid, err := s.tokens.CheckToken(token); err != nil || !valid {
+		return inactive, nil
+	}
+	claims, err := s.tokens.GetToken(token)
+	if err != nil || s.policy.Validate(claims) != nil {
+		return inactive, nil
+	}
+	if s.revocations != nil {
+		revoked, err := s.revocations.IsRevoked(claims)
+		if err != nil {
+			return model.Introspection{}, err
+		}
+		if revoked {
+			return inactive, nil
+		}
+	}
+
+	out := model.Introspection{
+		Active:    true,
+		Scope:     claims.Scope,
+		TokenType: TokenTypeBearer,
+		ExpiresAt: claims.ExpiresAt,
+		IssuedAt:  claims.IssuedAt,
+		NotBefore: claims.NotBefore,
+		Subject:   claims.Subject,
+		Audience:  claims.Audience,
+		Issuer:    claims.Issuer,
+		Identity:  claims.Identity,
+	}
+	if sub, err := model.ToSubject(claims.Subject); err == nil {
+		out.User = &sub
+		out.ClientId = sub.ClientId
+	}
+	return out, nil
+}
+
+func (s *OAuthServer) authenticate(clientId, clientSecret string) (model.OAuthClient, error) {
+	client, err := s.clients.GetClient(clientId)
+	if err != nil {
+		return client, driven.ErrInvalidClient
+	}
+	if !s.secrets.ComparePasswords(client.SecretHash, clientSecret) {
+		log.Printf("Invalid secret for oauth client %s", clientId)
+		return client, driven.ErrInvalidClient
+	}
+	return client, nil
+}
+
+type memoryOAuthClientStore struct {
+	clients map[string]model.OAuthClient
+}
+
+// NewMemoryOAuthClientStore creates a fixed client registry.
+func NewMemoryOAuthClientStore(clients ...model.OAuthClient) driven.OAuthClientStore {
+	s := memoryOAuthClientStore{clients: map[string]model.OAuthClient{}}
+	for _, v := range clients {
+		s.clients[v.Id] = v
+	}
+	return s
+}
+
+// LoadOAuthClients reads a JSON array of clients, secrets must be hashed with the password hasher of the server.
+func LoadOAuthClients(path string) (driven.OAuthClientStore, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	clients := []model.OAuthClient{}
+	if err := json.Unmarshal(data, &clients); err != nil {
+		return nil, err
+	}
+	return NewMemoryOAuthClientStore(clients...), nil
+}
+
+func (s memoryOAuthClientStore) GetClient(id string) (model.OAuthClient, error) {
+	client, ok := s.clients[id]
+	if !ok {
+		return client, driven.ErrInvalidClient
+	}
+	return client, nil
+}
@@ -0,0 +1,76 @@
+package adapter
+
+import (
+	"testing"
+	"time"
+
+	driven "github.com/nullexp/finman-api-gateway/internal/port"
+	"github.com/nullexp/finman-api-gateway/internal/port/model"
+	"github.com/nullexp/finman-api-gateway/pkg/infrastructure/misc"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestOAuthServer() (*OAuthServer, *MemoryRevocationList) {
+	secrets := misc.NewSha256Password("pepper")
+	clients := NewMemoryOAuthClientStore(model.OAuthClient{
+		Id:         "reports",
+		SecretHash: secrets.HashAndSalt("secret"),
+		Scopes:     []string{"ReadTransactions", "ReadUsers"},
+	})
+	revocations := NewMemoryRevocationList(nil, time.Hour)
+	return NewOAuthServer(clients, secrets, NewTokenService("testsecret", time.Hour), misc.ClaimsPolicy{}, revocations), revocations
+}
+
+func TestOAuthClientCredentials(t *testing.T) {
+	s, _ := newTestOAuthServer()
+
+	token, err := s.IssueClientToken("reports", "secret", []string{"ReadUsers"})
+	assert.NoError(t, err)
+	assert.Equal(t, TokenTypeBearer, token.TokenType)
+	assert.Equal(t, "ReadUsers", token.Scope)
+	assert.Equal(t, int64(3600), token.ExpiresIn)
+
+	claim, err := s.tokens.GetModel(token.AccessToken)
+	assert.NoError(t, err)
+	scoped, ok := claim.(misc.ScopedClaim)
+	assert.True(t, ok)
+	assert.Equal(t, []string{"ReadUsers"}, scoped.GetScopes())
+
+	token, err = s.IssueClientToken("reports", "secret", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "ReadTransactions ReadUsers", token.Scope)
+
+	_, err = s.IssueClientToken("reports", "secret", []string{"ManageUsers"})
+	assert.ErrorIs(t, err, driven.ErrInvalidScope)
+	_, err = s.IssueClientToken("reports", "wrong", nil)
+	assert.ErrorIs(t, err, driven.ErrInvalidClient)
+	_, err = s.IssueClientToken("unknown", "secret", nil)
+	assert.ErrorIs(t, err, driven.ErrInvalidClient)
+}
+
+func TestOAuthIntrospection(t *testing.T) {
+	s, revocations := newTestOAuthServer()
+	token, err := s.IssueClientToken("reports", "secret", nil)
+	assert.NoError(t, err)
+
+	out, err := s.Introspect("reports", "secret", token.AccessToken)
+	assert.NoError(t, err)
+	assert.True(t, out.Active)
+	assert.Equal(t, "reports", out.ClientId)
+	assert.Equal(t, token.Scope, out.Scope)
+	assert.Equal(t, &model.Subject{ClientId: "reports"}, out.User)
+
+	out, err = s.Introspect("reports", "secret", "not a token")
+	assert.NoError(t, err)
+	assert.Equal(t, model.Introspection{Active: false}, out)
+
+	claims, err := s.tokens.GetToken(token.AccessToken)
+	assert.NoError(t, err)
+	assert.NoError(t, revocations.Revoke(claims.Identity, claims.ExpiresAt))
+	out, err = s.Introspect("reports", "secret", token.AccessToken)
+	assert.NoError(t, err)
+	assert.False(t, out.Active)
+
+	_, err = s.Introspect("reports", "wrong", token.AccessToken)
+	assert.ErrorIs(t, err, driven.ErrInvalidClient)
+}
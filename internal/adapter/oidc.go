@@ -0,0 +1,336 @@
+package adapter
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/nullexp/finman-api-gateway/internal/port/model"
+	"github.com/nullexp/finman-api-gateway/pkg/infrastructure/http/protocol"
+	"github.com/nullexp/finman-api-gateway/pkg/infrastructure/misc"
+)
+
+var (
+	ErrOidcIssuerMismatch = errors.New("oidc token is issued by another issuer")
+	ErrOidcAudience       = errors.New("oidc token is minted for another client")
+	ErrOidcUnmappedUser   = errors.New("oidc user has no finman mapping")
+	ErrOidcInvalidToken   = errors.New("oidc token is malformed")
+	ErrOidcInvalidMapping = errors.New("oidc mapping row needs a sub or a group and a userId")
+)
+
+const (
+	oidcDiscoveryPath = "/.well-known/openid-configuration"
+	oidcFetchTimeout  = 10 * time.Second
+	// oidcRefreshInterval limits how often an unknown kid makes us fetch the JWKS again
+	oidcRefreshInterval = time.Minute
+)
+
+// OidcConfig describes an external OpenID provider the gateway trusts.
+type OidcConfig struct {
+	Issuer      string              // expected iss claim
+	Discovery   string              // URL or file of the discovery document, defaults to the well-known URL of the issuer
+	Jwks        string              // URL or file of the JWKS, overrides jwks_uri of the discovery document
+	Audiences   []string            // accepted client ids, empty accepts any
+	GroupsClaim string              // defaults to groups
+	Mapping     []model.OidcMapping // first matching row wins
+}
+
+// OidcAuthenticator validates ID tokens of an external issuer and maps their users to FinMan subjects.
+type OidcAuthenticator struct {
+	config OidcConfig
+
+	mu        sync.RWMutex
+	jwks      string
+	keys      map[string]SigningKey
+	fetchedAt time.Time
+}
+
+// NewOidcAuthenticator loads the discovery document and the key set of the issuer.
+func NewOidcAuthenticator(config OidcConfig) (*OidcAuthenticator, error) {
+	if err := validateOidcMapping(config.Mapping); err != nil {
+		return nil, err
+	}
+	if config.GroupsClaim == "" {
+		config.GroupsClaim = "groups"
+	}
+	a := &OidcAuthenticator{config: config, jwks: config.Jwks, keys: map[string]SigningKey{}}
+
+	if a.jwks == "" {
+		location := config.Discovery
+		if location == "" {
+			location = strings.TrimSuffix(config.Issuer, "/") + oidcDiscoveryPath
+		}
+		discovery := model.OidcDiscovery{}
+		if err := loadDocument(location, &discovery); err != nil {
+			return nil, err
+		}
+		if discovery.Issuer != config.Issuer {
+			return nil, ErrOidcIssuerMismatch
+		}
+		a.jwks = discovery.JwksUri
+	}
+
+	if err := a.refresh(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (a *OidcAuthenticator) GetIssuer() string {
+	return a.config.Issuer
+}
+
+func (a *OidcAuthenticator) GetModel(token string) (misc.JwtClaim, error) {
+	raw, err := claimsSkippingParser.Parse(token, a.getVerifyKey)
+	if err != nil {
+		return nil, err
+	}
+	claims, ok := raw.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, ErrOidcInvalidToken
+	}
+
+	if iss, _ := claims["iss"].(string); iss != a.config.Issuer {
+		return nil, ErrOidcIssuerMismatch
+	}
+	audience := toStrings(claims["aud"])
+	if len(a.config.Audiences) != 0 && !slices.ContainsFunc(audience, func(v string) bool { return slices.Contains(a.config.Audiences, v) }) {
+		return nil, ErrOidcAudience
+	}
+
+	externalSubject, _ := claims["sub"].(string)
+	subject, ok := a.mapSubject(externalSubject, toStrings(claims[a.config.GroupsClaim]))
+	if !ok {
+		return nil, ErrOidcUnmappedUser
+	}
+	sub, err := encodeSubject(subject)
+	if err != nil {
+		return nil, err
+	}
+
+	identity, _ := claims["jti"].(string)
+	if identity == "" {
+		// ID tokens rarely carry jti, the hash still lets a logout revoke exactly this token
+		identity = hashToken(token)
+	}
+	return model.StandardClaims{
+		Subject:   sub,
+		Issuer:    a.config.Issuer,
+		Audience:  audience,
+		Identity:  identity,
+		ExpiresAt: toUnix(claims["exp"]),
+		IssuedAt:  toUnix(claims["iat"]),
+		NotBefore: toUnix(claims["nbf"]),
+	}, nil
+}
+
+func (a *OidcAuthenticator) CheckToken(token string) (bool, error) {
+	_, err := claimsSkippingParser.Parse(token, a.getVerifyKey)
+	return err == nil, nil
+}
+
+func (a *OidcAuthenticator) mapSubject(externalSubject string, groups []string) (model.Subject, bool) {
+	for _, v := range a.config.Mapping {
+		if (v.Subject != "" && v.Subject == externalSubject) || (v.Group != "" && slices.Contains(groups, v.Group)) {
+			return model.Subject{UserId: v.UserId, IsAdmin: v.IsAdmin}, true
+		}
+	}
+	return model.Subject{}, false
+}
+
+func (a *OidcAuthenticator) getVerifyKey(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := a.getKey(kid)
+	if !ok && a.claimRefresh() {
+		if err := a.refresh(); err != nil {
+			log.Printf("Error refreshing oidc keys: %v", err)
+		}
+		key, ok = a.getKey(kid)
+	}
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	if key.Method.Alg() != token.Method.Alg() {
+		return nil, ErrUnexpectedSigningMethod
+	}
+	return key.Public, nil
+}
+
+// getKey finds the key by kid, a token without kid is accepted when the issuer has a single key.
+func (a *OidcAuthenticator) getKey(kid string) (SigningKey, bool) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	if kid == "" && len(a.keys) == 1 {
+		for _, v := range a.keys {
+			return v, true
+		}
+	}
+	key, ok := a.keys[kid]
+	return key, ok
+}
+
+// claimRefresh reports whether the caller should fetch the keys, at most one caller per interval does.
+func (a *OidcAuthenticator) claimRefresh() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if time.Since(a.fetchedAt) < oidcRefreshInterval {
+		return false
+	}
+	a.fetchedAt = time.Now()
+	return true
+}
+
+func (a *OidcAuthenticator) refresh() error {
+	jwks := model.Jwks{}
+	if err := loadDocument(a.jwks, &jwks); err != nil {
+		return err
+	}
+	keys := map[string]SigningKey{}
+	for _, v := range jwks.Keys {
+		if v.Use != "" && v.Use != "sig" {
+			continue
+		}
+		key, err := KeyFromJwk(v)
+		if err != nil {
+			log.Printf("Skipping oidc key %s: %v", v.KeyId, err)
+			continue
+		}
+		keys[key.Id] = key
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.keys = keys
+	a.fetchedAt = time.Now()
+	return nil
+}
+
+// LoadOidcMapping reads the JSON mapping table from a file or URL.
+func LoadOidcMapping(location string) ([]model.OidcMapping, error) {
+	mapping := []model.OidcMapping{}
+	if err := loadDocument(location, &mapping); err != nil {
+		return nil, err
+	}
+	return mapping, validateOidcMapping(mapping)
+}
+
+// validateOidcMapping requires the FinMan user of every row, the subject of another issuer is never
+// taken for a FinMan user id.
+func validateOidcMapping(mapping []model.OidcMapping) error {
+	for i, v := range mapping {
+		if (v.Subject == "" && v.Group == "") || v.UserId == "" {
+			return fmt.Errorf("row %d: %w", i, ErrOidcInvalidMapping)
+		}
+	}
+	return nil
+}
+
+// loadDocument reads a JSON document from an http(s) URL or a file path.
+func loadDocument(location string, out interface{}) error {
+	var data []byte
+	var err error
+	if strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://") {
+		client := http.Client{Timeout: oidcFetchTimeout}
+		var rs *http.Response
+		rs, err = client.Get(location)
+		if err != nil {
+			return err
+		}
+		defer rs.Body.Close()
+		if rs.StatusCode != http.StatusOK {
+			return fmt.Errorf("fetching %s: unexpected status %d", location, rs.StatusCode)
+		}
+		data, err = io.ReadAll(rs.Body)
+	} else {
+		data, err = os.ReadFile(strings.TrimPrefix(location, "file://"))
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
+
+// toStrings reads a claim that may be a single string or an array of strings.
+func toStrings(claim interface{}) []string {
+	switch v := claim.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		out := []string{}
+		for _, s := range v {
+			if s, ok := s.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+func toUnix(claim interface{}) int64 {
+	switch v := claim.(type) {
+	case float64:
+		return int64(v)
+	case json.Number:
+		n, _ := v.Int64()
+		return n
+	}
+	return 0
+}
+
+// IssuerAuthenticator routes Bearer tokens to the authenticator of their issuer. The issuer is read
+// without verification, each authenticator verifies the token itself.
+type IssuerAuthenticator struct {
+	fallback protocol.Authenticator
+	issuers  map[string]protocol.Authenticator
+}
+
+// NewIssuerAuthenticator uses fallback for tokens of any issuer not registered with AppendIssuer.
+func NewIssuerAuthenticator(fallback protocol.Authenticator) *IssuerAuthenticator {
+	return &IssuerAuthenticator{fallback: fallback, issuers: map[string]protocol.Authenticator{}}
+}
+
+func (a *IssuerAuthenticator) AppendIssuer(issuer string, authenticator protocol.Authenticator) {
+	a.issuers[issuer] = authenticator
+}
+
+func (a *IssuerAuthenticator) GetModel(token string) (misc.JwtClaim, error) {
+	return a.pick(token).GetModel(token)
+}
+
+func (a *IssuerAuthenticator) CheckToken(token string) (bool, error) {
+	return a.pick(token).CheckToken(token)
+}
+
+func (a *IssuerAuthenticator) pick(token string) protocol.Authenticator {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return a.fallback
+	}
+	data, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return a.fallback
+	}
+	claims := struct {
+		Issuer string `json:"iss"`
+	}{}
+	if json.Unmarshal(data, &claims) != nil {
+		return a.fallback
+	}
+	if authenticator, ok := a.issuers[claims.Issuer]; ok {
+		return authenticator
+	}
+	return a.fallback
+}
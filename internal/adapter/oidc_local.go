@@ -0,0 +1,60 @@
+package adapter
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/google/uuid"
+	"github.com/nullexp/finman-api-gateway/internal/port/model"
+)
+
+const localOidcJwksPath = "/jwks.json"
+
+// LocalOidcProvider is a stand-in for the company SSO in tests and local runs. It serves a discovery
+// document and a JWKS over http and signs ID tokens with a key generated at start.
+type LocalOidcProvider struct {
+	issuer string
+	key    SigningKey
+}
+
+func NewLocalOidcProvider(issuer string) (*LocalOidcProvider, error) {
+	key, err := GenerateSigningKey(uuid.NewString(), "ES256")
+	if err != nil {
+		return nil, err
+	}
+	return &LocalOidcProvider{issuer: issuer, key: key}, nil
+}
+
+// IssueIdToken signs an ID token for the external subject with the given groups.
+func (p *LocalOidcProvider) IssueIdToken(sub string, groups []string, audience string, expireAfter time.Duration) (string, error) {
+	now := time.Now()
+	t := jwt.NewWithClaims(p.key.Method, jwt.MapClaims{
+		"iss":    p.issuer,
+		"sub":    sub,
+		"aud":    audience,
+		"groups": groups,
+		"iat":    now.Unix(),
+		"exp":    now.Add(expireAfter).Unix(),
+	})
+	t.Header["kid"] = p.key.Id
+	return t.SignedString(p.key.Private)
+}
+
+// ServeHTTP answers the discovery document, pointing jwks_uri at the host the request came to, and the JWKS.
+func (p *LocalOidcProvider) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var body interface{}
+	switch r.URL.Path {
+	case oidcDiscoveryPath:
+		body = model.OidcDiscovery{Issuer: p.issuer, JwksUri: "http://" + r.Host + localOidcJwksPath}
+	case localOidcJwksPath:
+		jwk, _ := p.key.ToJwk()
+		body = model.Jwks{Keys: []model.Jwk{jwk}}
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,140 @@
+package adapter
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nullexp/finman-api-gateway/internal/port/model"
+	"github.com/nullexp/finman-api-gateway/pkg/infrastructure/misc"
+	"github.com/stretchr/testify/assert"
+)
+
+const testOidcIssuer = "https://sso.test"
+
+func newTestOidc(t *testing.T) (*LocalOidcProvider, *OidcAuthenticator) {
+	provider, err := NewLocalOidcProvider(testOidcIssuer)
+	assert.NoError(t, err)
+	server := httptest.NewServer(provider)
+	t.Cleanup(server.Close)
+
+	a, err := NewOidcAuthenticator(OidcConfig{
+		Issuer:    testOidcIssuer,
+		Discovery: server.URL + oidcDiscoveryPath,
+		Audiences: []string{"finman"},
+		Mapping: []model.OidcMapping{
+			{Subject: "alice", UserId: "00000000-0000-0000-0000-000000000001"},
+			{Group: "finance-admins", UserId: "00000000-0000-0000-0000-000000000002", IsAdmin: true},
+		},
+	})
+	assert.NoError(t, err)
+	return provider, a
+}
+
+func TestOidcAuthenticatorMapsUsers(t *testing.T) {
+	provider, a := newTestOidc(t)
+
+	token, err := provider.IssueIdToken("alice", nil, "finman", time.Hour)
+	assert.NoError(t, err)
+	valid, err := a.CheckToken(token)
+	assert.NoError(t, err)
+	assert.True(t, valid)
+	claim, err := a.GetModel(token)
+	assert.NoError(t, err)
+	assert.NoError(t, misc.ClaimsPolicy{Issuers: []string{testOidcIssuer}}.Validate(claim))
+	assert.NotEmpty(t, claim.GetIdentity())
+	sub, err := model.ToSubject(claim.GetSubject())
+	assert.NoError(t, err)
+	assert.Equal(t, model.Subject{UserId: "00000000-0000-0000-0000-000000000001"}, sub)
+
+	token, err = provider.IssueIdToken("bob", []string{"staff", "finance-admins"}, "finman", time.Hour)
+	assert.NoError(t, err)
+	claim, err = a.GetModel(token)
+	assert.NoError(t, err)
+	sub, err = model.ToSubject(claim.GetSubject())
+	assert.NoError(t, err)
+	assert.Equal(t, model.Subject{UserId: "00000000-0000-0000-0000-000000000002", IsAdmin: true}, sub)
+}
+
+func TestOidcMappingRequiresUser(t *testing.T) {
+	for _, mapping := range [][]model.OidcMapping{
+		{{Group: "finance-admins", IsAdmin: true}},
+		{{Subject: "alice"}},
+		{{UserId: "00000000-0000-0000-0000-000000000001"}},
+	} {
+		_, err := NewOidcAuthenticator(OidcConfig{Issuer: testOidcIssuer, Mapping: mapping})
+		assert.ErrorIs(t, err, ErrOidcInvalidMapping)
+
+		data, err := json.Marshal(mapping)
+		assert.NoError(t, err)
+		path := filepath.Join(t.TempDir(), "mapping.json")
+		assert.NoError(t, os.WriteFile(path, data, 0o600))
+		_, err = LoadOidcMapping(path)
+		assert.ErrorIs(t, err, ErrOidcInvalidMapping)
+	}
+}
+
+func TestOidcAuthenticatorRejects(t *testing.T) {
+	provider, a := newTestOidc(t)
+
+	token, err := provider.IssueIdToken("mallory", []string{"staff"}, "finman", time.Hour)
+	assert.NoError(t, err)
+	_, err = a.GetModel(token)
+	assert.ErrorIs(t, err, ErrOidcUnmappedUser)
+
+	token, err = provider.IssueIdToken("alice", nil, "other-app", time.Hour)
+	assert.NoError(t, err)
+	_, err = a.GetModel(token)
+	assert.ErrorIs(t, err, ErrOidcAudience)
+
+	// A token of another provider claiming the same issuer fails the signature
+	impostor, err := NewLocalOidcProvider(testOidcIssuer)
+	assert.NoError(t, err)
+	token, err = impostor.IssueIdToken("alice", nil, "finman", time.Hour)
+	assert.NoError(t, err)
+	_, err = a.GetModel(token)
+	assert.Error(t, err)
+	valid, err := a.CheckToken(token)
+	assert.NoError(t, err)
+	assert.False(t, valid)
+}
+
+func TestOidcAuthenticatorFromFile(t *testing.T) {
+	provider, err := NewLocalOidcProvider(testOidcIssuer)
+	assert.NoError(t, err)
+	jwk, _ := provider.key.ToJwk()
+	data, err := json.Marshal(model.Jwks{Keys: []model.Jwk{jwk}})
+	assert.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	assert.NoError(t, os.WriteFile(path, data, 0o600))
+
+	a, err := NewOidcAuthenticator(OidcConfig{Issuer: testOidcIssuer, Jwks: path, Mapping: []model.OidcMapping{{Subject: "alice", UserId: "00000000-0000-0000-0000-000000000001"}}})
+	assert.NoError(t, err)
+	token, err := provider.IssueIdToken("alice", nil, "finman", time.Hour)
+	assert.NoError(t, err)
+	_, err = a.GetModel(token)
+	assert.NoError(t, err)
+}
+
+func TestIssuerAuthenticator(t *testing.T) {
+	provider, oidc := newTestOidc(t)
+	ts := NewTokenService("testsecret", time.Hour)
+	a := NewIssuerAuthenticator(ts)
+	a.AppendIssuer(testOidcIssuer, oidc)
+
+	own, err := ts.CreateToken(model.Subject{UserId: uuid.NewString()})
+	assert.NoError(t, err)
+	valid, err := a.CheckToken(own)
+	assert.NoError(t, err)
+	assert.True(t, valid)
+
+	external, err := provider.IssueIdToken("alice", nil, "finman", time.Hour)
+	assert.NoError(t, err)
+	claim, err := a.GetModel(external)
+	assert.NoError(t, err)
+	assert.Equal(t, testOidcIssuer, claim.GetIssuer())
+}
@@ -0,0 +1,168 @@
+package adapter
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+type decisionKey struct {
+	userId     string
+	permission string
+}
+
+type decision struct {
+	key       decisionKey
+	allowed   bool
+	expiresAt time.Time
+}
+
+// decisionCall is a lookup in flight, concurrent misses of the same key wait for it instead of calling again.
+type decisionCall struct {
+	done    chan struct{}
+	allowed bool
+	err     error
+	// canceled tells the lookup failed with the context of the caller that ran it ended, the other
+	// callers look up again rather than fail with it
+	canceled bool
+}
+
+// PermissionCache keeps the decisions of the role service for a while. Grants live for ttl and
+// denials for negativeTTL, the least recently used decision is evicted once capacity is reached.
+// Failed lookups are never cached.
+type PermissionCache struct {
+	capacity    int
+	ttl         time.Duration
+	negativeTTL time.Duration
+
+	mu         sync.Mutex
+	entries    map[decisionKey]*list.Element
+	order      *list.List // most recently used first
+	calls      map[decisionKey]*decisionCall
+	generation uint64 // bumped by every invalidation, lookups started before one are not cached
+}
+
+func NewPermissionCache(capacity int, ttl, negativeTTL time.Duration) *PermissionCache {
+	return &PermissionCache{
+		capacity:    capacity,
+		ttl:         ttl,
+		negativeTTL: negativeTTL,
+		entries:     map[decisionKey]*list.Element{},
+		order:       list.New(),
+		calls:       map[decisionKey]*decisionCall{},
+	}
+}
+
+// Decide returns the cached decision or runs lookup, once for all concurrent callers of the same key.
+// lookup runs with ctx, the context of the caller, and the callers waiting for it stop waiting when
+// theirs ends.
+func (c *PermissionCache) Decide(ctx context.Context, userId, permission string, lookup func() (bool, error)) (bool, error) {
+	key := decisionKey{userId: userId, permission: permission}
+
+	for {
+		c.mu.Lock()
+		if allowed, ok := c.get(key); ok {
+			c.mu.Unlock()
+			return allowed, nil
+		}
+		call, ok := c.calls[key]
+		if !ok {
+			break
+		}
+		c.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return false, ctx.Err()
+		case <-call.done:
+		}
+		if !call.canceled {
+			return call.allowed, call.err
+		}
+	}
+	call := &decisionCall{done: make(chan struct{})}
+	c.calls[key] = call
+	generation := c.generation
+	c.mu.Unlock()
+
+	call.allowed, call.err = lookup()
+	call.canceled = call.err != nil && ctx.Err() != nil
+
+	c.mu.Lock()
+	delete(c.calls, key)
+	if call.err == nil && generation == c.generation {
+		c.put(key, call.allowed)
+	}
+	c.mu.Unlock()
+	close(call.done)
+
+	return call.allowed, call.err
+}
+
+func (c *PermissionCache) InvalidateUser(userId string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	for k, e := range c.entries {
+		if k.userId == userId {
+			c.order.Remove(e)
+			delete(c.entries, k)
+		}
+	}
+}
+
+func (c *PermissionCache) InvalidateAll() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	c.entries = map[decisionKey]*list.Element{}
+	c.order.Init()
+}
+
+// Len returns the number of cached decisions, expired ones included until they are touched or evicted.
+func (c *PermissionCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+func (c *PermissionCache) get(key decisionKey) (bool, bool) {
+	e, ok := c.entries[key]
+	if !ok {
+		return false, false
+	}
+	d := e.Value.(*decision)
+	if time.Now().After(d.expiresAt) {
+		c.order.Remove(e)
+		delete(c.entries, key)
+		return false, false
+	}
+	c.order.MoveToFront(e)
+	return d.allowed, true
+}
+
+func (c *PermissionCache) put(key decisionKey, allowed bool) {
+	ttl := c.ttl
+	if !allowed {
+		ttl = c.negativeTTL
+	}
+	if ttl <= 0 || c.capacity <= 0 {
+		return
+	}
+
+	d := &decision{key: key, allowed: allowed, expiresAt: time.Now().Add(ttl)}
+	if e, ok := c.entries[key]; ok {
+		e.Value = d
+		c.order.MoveToFront(e)
+		return
+	}
+	c.entries[key] = c.order.PushFront(d)
+	for c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*decision).key)
+	}
+}
@@ -0,0 +1,182 @@
+package adapter
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func countingLookup(calls *int32, allowed bool) func() (bool, error) {
+	return func() (bool, error) {
+		atomic.AddInt32(calls, 1)
+		return allowed, nil
+	}
+}
+
+func TestPermissionCacheKeepsDecisions(t *testing.T) {
+	cache := NewPermissionCache(10, time.Hour, time.Hour)
+	var calls int32
+
+	for i := 0; i < 3; i++ {
+		allowed, err := cache.Decide(context.Background(), "user", "Read", countingLookup(&calls, true))
+		assert.NoError(t, err)
+		assert.True(t, allowed)
+		allowed, err = cache.Decide(context.Background(), "user", "Write", countingLookup(&calls, false))
+		assert.NoError(t, err)
+		assert.False(t, allowed)
+	}
+	assert.Equal(t, int32(2), calls, "grants and denials are both cached")
+}
+
+func TestPermissionCacheExpires(t *testing.T) {
+	cache := NewPermissionCache(10, time.Hour, time.Millisecond)
+	var calls int32
+
+	_, _ = cache.Decide(context.Background(), "user", "Write", countingLookup(&calls, false))
+	time.Sleep(5 * time.Millisecond)
+	_, _ = cache.Decide(context.Background(), "user", "Write", countingLookup(&calls, false))
+	assert.Equal(t, int32(2), calls, "denials live for the negative ttl only")
+}
+
+func TestPermissionCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	cache := NewPermissionCache(2, time.Hour, time.Hour)
+	var calls int32
+
+	_, _ = cache.Decide(context.Background(), "a", "Read", countingLookup(&calls, true))
+	_, _ = cache.Decide(context.Background(), "b", "Read", countingLookup(&calls, true))
+	_, _ = cache.Decide(context.Background(), "a", "Read", countingLookup(&calls, true))
+	_, _ = cache.Decide(context.Background(), "c", "Read", countingLookup(&calls, true))
+	assert.Equal(t, 2, cache.Len())
+	assert.Equal(t, int32(3), calls)
+
+	_, _ = cache.Decide(context.Background(), "a", "Read", countingLookup(&calls, true))
+	assert.Equal(t, int32(3), calls, "a was used recently and kept")
+	_, _ = cache.Decide(context.Background(), "b", "Read", countingLookup(&calls, true))
+	assert.Equal(t, int32(4), calls, "b was evicted")
+}
+
+func TestPermissionCacheSkipsErrors(t *testing.T) {
+	cache := NewPermissionCache(10, time.Hour, time.Hour)
+	var calls int32
+	failing := func() (bool, error) {
+		atomic.AddInt32(&calls, 1)
+		return false, errors.New("unavailable")
+	}
+
+	_, err := cache.Decide(context.Background(), "user", "Read", failing)
+	assert.Error(t, err)
+	_, err = cache.Decide(context.Background(), "user", "Read", failing)
+	assert.Error(t, err)
+	assert.Equal(t, int32(2), calls)
+}
+
+func TestPermissionCacheSharesConcurrentMisses(t *testing.T) {
+	cache := NewPermissionCache(10, time.Hour, time.Hour)
+	var calls int32
+	release := make(chan struct{})
+	lookup := func() (bool, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return true, nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			allowed, err := cache.Decide(context.Background(), "user", "Read", lookup)
+			assert.NoError(t, err)
+			assert.True(t, allowed)
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	assert.Equal(t, int32(1), calls)
+}
+
+func TestPermissionCacheOutlivesCanceledCaller(t *testing.T) {
+	cache := NewPermissionCache(10, time.Hour, time.Hour)
+	first, cancel := context.WithCancel(context.Background())
+	started := make(chan struct{})
+
+	done := make(chan error)
+	go func() {
+		_, err := cache.Decide(first, "user", "Read", func() (bool, error) {
+			close(started)
+			<-first.Done()
+			return false, first.Err()
+		})
+		done <- err
+	}()
+	<-started
+
+	var calls int32
+	second := make(chan error)
+	go func() {
+		allowed, err := cache.Decide(context.Background(), "user", "Read", countingLookup(&calls, true))
+		assert.True(t, allowed)
+		second <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+
+	assert.ErrorIs(t, <-done, context.Canceled)
+	assert.NoError(t, <-second)
+	assert.Equal(t, int32(1), calls)
+}
+
+func TestPermissionCacheStopsWaitingWithCaller(t *testing.T) {
+	cache := NewPermissionCache(10, time.Hour, time.Hour)
+	release := make(chan struct{})
+	defer close(release)
+	started := make(chan struct{})
+	go func() {
+		_, _ = cache.Decide(context.Background(), "user", "Read", func() (bool, error) {
+			close(started)
+			<-release
+			return true, nil
+		})
+	}()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := cache.Decide(ctx, "user", "Read", countingLookup(new(int32), true))
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestPermissionCacheInvalidate(t *testing.T) {
+	cache := NewPermissionCache(10, time.Hour, time.Hour)
+	var calls int32
+
+	_, _ = cache.Decide(context.Background(), "a", "Read", countingLookup(&calls, true))
+	_, _ = cache.Decide(context.Background(), "b", "Read", countingLookup(&calls, true))
+	cache.InvalidateUser("a")
+	_, _ = cache.Decide(context.Background(), "a", "Read", countingLookup(&calls, true))
+	_, _ = cache.Decide(context.Background(), "b", "Read", countingLookup(&calls, true))
+	assert.Equal(t, int32(3), calls)
+
+	cache.InvalidateAll()
+	assert.Equal(t, 0, cache.Len())
+}
+
+func TestPermissionCacheDropsLookupRacingInvalidation(t *testing.T) {
+	cache := NewPermissionCache(10, time.Hour, time.Hour)
+	var calls int32
+
+	_, _ = cache.Decide(context.Background(), "user", "Read", func() (bool, error) {
+		atomic.AddInt32(&calls, 1)
+		// The role changes while the old decision is on its way back
+		cache.InvalidateAll()
+		return true, nil
+	})
+	_, _ = cache.Decide(context.Background(), "user", "Read", countingLookup(&calls, false))
+	assert.Equal(t, int32(2), calls)
+}
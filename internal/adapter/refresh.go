@@ -0,0 +1,200 @@
+package adapter
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	driven "github.com/nullexp/finman-api-gateway/internal/port"
+	"github.com/nullexp/finman-api-gateway/internal/port/model"
+)
+
+var ErrRefreshNotConfigured = errors.New("refresh tokens are not configured")
+
+const refreshTokenSize = 32
+
+// SetRefreshStore enables refresh tokens, storing them in the given store and
+// keeping them valid for expireAfter.
+func (ts *TokenService) SetRefreshStore(store driven.RefreshTokenStore, expireAfter time.Duration) {
+	ts.refreshStore = store
+	ts.refreshExpireAfter = expireAfter
+}
+
+// CreateRefreshToken starts a new token family for the given subject and returns its first refresh token.
+func (ts TokenService) CreateRefreshToken(sb model.Subject) (string, error) {
+	return ts.issueRefreshToken(sb, uuid.NewString())
+}
+
+// CreateSession starts a login session for the given subject and returns its token and first refresh
+// token. The session is the family of the refresh tokens, the token names it in its sid claim so a
+// logout can revoke the family too.
+func (ts TokenService) CreateSession(sb model.Subject) (string, string, error) {
+	session := uuid.NewString()
+	token, err := ts.createSessionToken(sb, session)
+	if err != nil {
+		return "", "", err
+	}
+	refreshToken, err := ts.issueRefreshToken(sb, session)
+	if err != nil {
+		return "", "", err
+	}
+	return token, refreshToken, nil
+}
+
+// Refresh exchanges a refresh token for a new access token and a rotated refresh token.
+// Presenting an already used refresh token is treated as theft and revokes the whole family.
+func (ts TokenService) Refresh(refreshToken string) (string, string, error) {
+	if ts.refreshStore == nil {
+		return "", "", ErrRefreshNotConfigured
+	}
+
+	rt, err := ts.refreshStore.Consume(hashToken(refreshToken))
+	if errors.Is(err, driven.ErrRefreshTokenReused) {
+		log.Printf("Refresh token reuse detected, revoking family %s", rt.Family)
+		if rerr := ts.refreshStore.RevokeFamily(rt.Family); rerr != nil {
+			log.Printf("Error revoking refresh token family: %v", rerr)
+		}
+		return "", "", err
+	}
+	if err != nil {
+		return "", "", err
+	}
+
+	if time.Now().Unix() > rt.ExpiresAt {
+		return "", "", driven.ErrRefreshTokenExpired
+	}
+
+	token, err := ts.createSessionToken(rt.Subject, rt.Family)
+	if err != nil {
+		return "", "", err
+	}
+
+	rotated, err := ts.issueRefreshToken(rt.Subject, rt.Family)
+	if err != nil {
+		return "", "", err
+	}
+	return token, rotated, nil
+}
+
+func (ts TokenService) issueRefreshToken(sb model.Subject, family string) (string, error) {
+	if ts.refreshStore == nil {
+		return "", ErrRefreshNotConfigured
+	}
+
+	raw := make([]byte, refreshTokenSize)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+
+	err := ts.refreshStore.Save(model.RefreshToken{
+		Id:        hashToken(token),
+		Family:    family,
+		Subject:   sb,
+		ExpiresAt: time.Now().Add(ts.refreshExpireAfter).Unix(),
+	})
+	if err != nil {
+		log.Printf("Error saving refresh token: %v", err)
+		return "", err
+	}
+	return token, nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+type memoryRefreshTokenStore struct {
+	mu       sync.Mutex
+	tokens   map[string]model.RefreshToken
+	families map[string][]string
+}
+
+// NewMemoryRefreshTokenStore creates a process local refresh token store.
+func NewMemoryRefreshTokenStore() driven.RefreshTokenStore {
+	return &memoryRefreshTokenStore{
+		tokens:   map[string]model.RefreshToken{},
+		families: map[string][]string{},
+	}
+}
+
+func (s *memoryRefreshTokenStore) Save(token model.RefreshToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sweep()
+	s.tokens[token.Id] = token
+	s.families[token.Family] = append(s.families[token.Family], token.Id)
+	return nil
+}
+
+func (s *memoryRefreshTokenStore) Consume(id string) (model.RefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rt, ok := s.tokens[id]
+	if !ok {
+		return rt, driven.ErrRefreshTokenNotFound
+	}
+	if rt.Used {
+		return rt, driven.ErrRefreshTokenReused
+	}
+	rt.Used = true
+	s.tokens[id] = rt
+	return rt, nil
+}
+
+func (s *memoryRefreshTokenStore) RevokeFamily(family string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, id := range s.families[family] {
+		delete(s.tokens, id)
+	}
+	delete(s.families, family)
+	return nil
+}
+
+func (s *memoryRefreshTokenStore) RevokeUser(userId string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for family, ids := range s.families {
+		if len(ids) == 0 || s.tokens[ids[0]].Subject.UserId != userId {
+			continue
+		}
+		for _, id := range ids {
+			delete(s.tokens, id)
+		}
+		delete(s.families, family)
+	}
+	return nil
+}
+
+// sweep drops families whose tokens are all expired. Caller must hold the lock.
+func (s *memoryRefreshTokenStore) sweep() {
+	now := time.Now().Unix()
+	for family, ids := range s.families {
+		alive := false
+		for _, id := range ids {
+			if rt, ok := s.tokens[id]; ok && rt.ExpiresAt >= now {
+				alive = true
+				break
+			}
+		}
+		if alive {
+			continue
+		}
+		for _, id := range ids {
+			delete(s.tokens, id)
+		}
+		delete(s.families, family)
+	}
+}
@@ -0,0 +1,72 @@
+package adapter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	driven "github.com/nullexp/finman-api-gateway/internal/port"
+	"github.com/nullexp/finman-api-gateway/internal/port/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func newRefreshTokenService() *TokenService {
+	ts := NewTokenService("testsecret", time.Hour)
+	ts.SetRefreshStore(NewMemoryRefreshTokenStore(), time.Hour)
+	return ts
+}
+
+func TestTokenServiceRefresh(t *testing.T) {
+	ts := newRefreshTokenService()
+	subject := model.Subject{UserId: uuid.New().String()}
+
+	refreshToken, err := ts.CreateRefreshToken(subject)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, refreshToken)
+
+	token, rotated, err := ts.Refresh(refreshToken)
+	assert.NoError(t, err)
+	assert.NotEqual(t, refreshToken, rotated)
+
+	claims, err := ts.GetToken(token)
+	assert.NoError(t, err)
+	sub, err := ts.GetSubject(claims.Subject)
+	assert.NoError(t, err)
+	assert.Equal(t, subject.UserId, sub.UserId)
+}
+
+func TestTokenServiceRefreshReuseRevokesFamily(t *testing.T) {
+	ts := newRefreshTokenService()
+	subject := model.Subject{UserId: uuid.New().String()}
+
+	refreshToken, err := ts.CreateRefreshToken(subject)
+	assert.NoError(t, err)
+
+	_, rotated, err := ts.Refresh(refreshToken)
+	assert.NoError(t, err)
+
+	_, _, err = ts.Refresh(refreshToken)
+	assert.ErrorIs(t, err, driven.ErrRefreshTokenReused)
+
+	// The legitimate holder loses the rotated token too
+	_, _, err = ts.Refresh(rotated)
+	assert.ErrorIs(t, err, driven.ErrRefreshTokenNotFound)
+}
+
+func TestTokenServiceRefreshExpired(t *testing.T) {
+	ts := NewTokenService("testsecret", time.Hour)
+	ts.SetRefreshStore(NewMemoryRefreshTokenStore(), -time.Minute)
+
+	refreshToken, err := ts.CreateRefreshToken(model.Subject{UserId: uuid.New().String()})
+	assert.NoError(t, err)
+
+	_, _, err = ts.Refresh(refreshToken)
+	assert.ErrorIs(t, err, driven.ErrRefreshTokenExpired)
+}
+
+func TestTokenServiceRefreshNotConfigured(t *testing.T) {
+	ts := NewTokenService("testsecret", time.Hour)
+
+	_, err := ts.CreateRefreshToken(model.Subject{UserId: uuid.New().String()})
+	assert.ErrorIs(t, err, ErrRefreshNotConfigured)
+}
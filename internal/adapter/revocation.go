@@ -0,0 +1,136 @@
+package adapter
+
+import (
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	driven "github.com/nullexp/finman-api-gateway/internal/port"
+	"github.com/nullexp/finman-api-gateway/internal/port/model"
+	"github.com/nullexp/finman-api-gateway/pkg/infrastructure/misc"
+)
+
+type userRevocation struct {
+	before int64 // tokens issued at or before this unix millisecond are revoked
+	until  int64 // the entry is useless after every affected token expired
+}
+
+// MemoryRevocationList keeps revoked token identities until the tokens expire.
+// Revoking a user records a cut-off time instead, since the gateway does not
+// know every token the auth service has issued.
+type MemoryRevocationList struct {
+	mu          sync.Mutex
+	identities  map[string]int64
+	users       map[string]userRevocation
+	sessions    map[string]int64 // revoked session to the time its last token expires
+	refresh     driven.RefreshTokenStore
+	maxTokenAge time.Duration
+}
+
+// NewMemoryRevocationList creates a process local revocation list. maxTokenAge must be the
+// lifetime of access tokens. refresh may be nil when refresh tokens are disabled.
+func NewMemoryRevocationList(refresh driven.RefreshTokenStore, maxTokenAge time.Duration) *MemoryRevocationList {
+	return &MemoryRevocationList{
+		identities:  map[string]int64{},
+		users:       map[string]userRevocation{},
+		sessions:    map[string]int64{},
+		refresh:     refresh,
+		maxTokenAge: maxTokenAge,
+	}
+}
+
+func (l *MemoryRevocationList) Revoke(identity string, expiresAt int64) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweep()
+	l.identities[identity] = expiresAt
+	return nil
+}
+
+func (l *MemoryRevocationList) RevokeUser(userId string) error {
+	l.mu.Lock()
+	now := time.Now()
+	l.sweep()
+	l.users[userId] = userRevocation{before: now.UnixMilli(), until: now.Add(l.maxTokenAge).Unix()}
+	l.mu.Unlock()
+
+	if l.refresh == nil {
+		return nil
+	}
+	return l.refresh.RevokeUser(userId)
+}
+
+func (l *MemoryRevocationList) RevokeSession(sessionId string) error {
+	l.mu.Lock()
+	l.sweep()
+	l.sessions[sessionId] = time.Now().Add(l.maxTokenAge).Unix()
+	l.mu.Unlock()
+
+	if l.refresh == nil {
+		return nil
+	}
+	return l.refresh.RevokeFamily(sessionId)
+}
+
+func (l *MemoryRevocationList) IsRevoked(claim misc.JwtClaim) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now().Unix()
+	if expiresAt, ok := l.identities[claim.GetIdentity()]; ok && expiresAt >= now {
+		return true, nil
+	}
+	if claim, ok := claim.(misc.SessionClaim); ok && claim.GetSessionId() != "" {
+		if until, ok := l.sessions[claim.GetSessionId()]; ok && until >= now {
+			return true, nil
+		}
+	}
+
+	sub, err := model.ToSubject(claim.GetSubject())
+	if err != nil {
+		return false, err
+	}
+	ur, ok := l.users[sub.UserId]
+	if !ok || ur.until < now {
+		return false, nil
+	}
+	issuedAt := claim.GetIssuedAt()
+	if issuedAt == 0 {
+		// Tokens of the auth service carry no issue time, estimate it from the expiry
+		issuedAt = claim.GetExpireTime() - int64(l.maxTokenAge/time.Second)
+	}
+	return issuedAtMilli(claim.GetIdentity(), issuedAt) <= ur.before, nil
+}
+
+// issuedAtMilli returns the issue time of a token to the millisecond. The jti of the tokens of the
+// gateway is a version 7 uuid holding it, other tokens are taken as issued at the end of their iat
+// second so a token of the second a user is revoked in stays revoked.
+func issuedAtMilli(identity string, issuedAt int64) int64 {
+	if id, err := uuid.Parse(identity); err == nil && id.Version() == 7 {
+		if at := time.Unix(id.Time().UnixTime()); at.Unix() == issuedAt {
+			return at.UnixMilli()
+		}
+	}
+	return issuedAt*1000 + 999
+}
+
+// sweep drops entries that can no longer match a live token. Caller must hold the lock.
+func (l *MemoryRevocationList) sweep() {
+	now := time.Now().Unix()
+	for k, v := range l.identities {
+		if v < now {
+			delete(l.identities, k)
+		}
+	}
+	for k, v := range l.users {
+		if v.until < now {
+			delete(l.users, k)
+		}
+	}
+	for k, v := range l.sessions {
+		if v < now {
+			delete(l.sessions, k)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package adapter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nullexp/finman-api-gateway/internal/port/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryRevocationListRevoke(t *testing.T) {
+	ts := NewTokenService("testsecret", time.Hour)
+	list := NewMemoryRevocationList(nil, time.Hour)
+
+	token, err := ts.CreateToken(model.Subject{UserId: uuid.New().String()})
+	assert.NoError(t, err)
+	claims, err := ts.GetToken(token)
+	assert.NoError(t, err)
+
+	revoked, err := list.IsRevoked(claims)
+	assert.NoError(t, err)
+	assert.False(t, revoked)
+
+	assert.NoError(t, list.Revoke(claims.Identity, claims.ExpiresAt))
+
+	revoked, err = list.IsRevoked(claims)
+	assert.NoError(t, err)
+	assert.True(t, revoked)
+}
+
+func TestMemoryRevocationListRevokeUser(t *testing.T) {
+	ts := NewTokenService("testsecret", time.Hour)
+	store := NewMemoryRefreshTokenStore()
+	ts.SetRefreshStore(store, time.Hour)
+	list := NewMemoryRevocationList(store, time.Hour)
+
+	subject := model.Subject{UserId: uuid.New().String()}
+	token, err := ts.CreateToken(subject)
+	assert.NoError(t, err)
+	claims, err := ts.GetToken(token)
+	assert.NoError(t, err)
+	refreshToken, err := ts.CreateRefreshToken(subject)
+	assert.NoError(t, err)
+
+	other, err := ts.CreateToken(model.Subject{UserId: uuid.New().String()})
+	assert.NoError(t, err)
+	otherClaims, err := ts.GetToken(other)
+	assert.NoError(t, err)
+
+	assert.NoError(t, list.RevokeUser(subject.UserId))
+
+	revoked, err := list.IsRevoked(claims)
+	assert.NoError(t, err)
+	assert.True(t, revoked)
+
+	revoked, err = list.IsRevoked(otherClaims)
+	assert.NoError(t, err)
+	assert.False(t, revoked)
+
+	_, _, err = ts.Refresh(refreshToken)
+	assert.Error(t, err)
+
+	// Tokens issued after the cut-off are accepted again
+	claims.IssuedAt = time.Now().Add(time.Minute).Unix()
+	revoked, err = list.IsRevoked(claims)
+	assert.NoError(t, err)
+	assert.False(t, revoked)
+
+	// even in the second of the cut-off, when the token tells the millisecond it was issued at
+	time.Sleep(2 * time.Millisecond)
+	relogin, err := ts.CreateToken(subject)
+	assert.NoError(t, err)
+	reloginClaims, err := ts.GetToken(relogin)
+	assert.NoError(t, err)
+	revoked, err = list.IsRevoked(reloginClaims)
+	assert.NoError(t, err)
+	assert.False(t, revoked)
+}
+
+func TestIssuedAtMilli(t *testing.T) {
+	id, err := uuid.NewV7()
+	assert.NoError(t, err)
+	at := time.Unix(id.Time().UnixTime())
+	assert.Equal(t, at.UnixMilli(), issuedAtMilli(id.String(), at.Unix()))
+
+	// an iat the jti does not agree with, or a jti without time, gives the end of the second
+	assert.Equal(t, (at.Unix()+5)*1000+999, issuedAtMilli(id.String(), at.Unix()+5))
+	assert.Equal(t, at.Unix()*1000+999, issuedAtMilli(uuid.NewString(), at.Unix()))
+}
+
+func TestMemoryRevocationListRevokeSession(t *testing.T) {
+	ts := NewTokenService("testsecret", time.Hour)
+	store := NewMemoryRefreshTokenStore()
+	ts.SetRefreshStore(store, time.Hour)
+	list := NewMemoryRevocationList(store, time.Hour)
+
+	subject := model.Subject{UserId: uuid.New().String()}
+	token, refreshToken, err := ts.CreateSession(subject)
+	assert.NoError(t, err)
+	refreshed, rotated, err := ts.Refresh(refreshToken)
+	assert.NoError(t, err)
+	other, _, err := ts.CreateSession(subject)
+	assert.NoError(t, err)
+
+	claims, err := ts.GetToken(token)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, claims.SessionId)
+	assert.NoError(t, list.RevokeSession(claims.SessionId))
+
+	for _, v := range []string{token, refreshed} {
+		claims, err := ts.GetToken(v)
+		assert.NoError(t, err)
+		revoked, err := list.IsRevoked(claims)
+		assert.NoError(t, err)
+		assert.True(t, revoked)
+	}
+	_, _, err = ts.Refresh(rotated)
+	assert.Error(t, err)
+
+	// Other sessions of the user are left alone
+	otherClaims, err := ts.GetToken(other)
+	assert.NoError(t, err)
+	revoked, err := list.IsRevoked(otherClaims)
+	assert.NoError(t, err)
+	assert.False(t, revoked)
+}
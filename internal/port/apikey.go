@@ -0,0 +1,23 @@
+package driven
+
+import (
+	"errors"
+
+	"github.com/nullexp/finman-api-gateway/internal/port/model"
+)
+
+var ErrApiKeyNotFound = errors.New("api key not found")
+
+type ApiKeyStore interface {
+	Save(model.ApiKey) error
+	GetByHash(hash string) (model.ApiKey, error)
+	GetAll() ([]model.ApiKey, error)
+	Touch(id string, usedAt int64) error
+	Delete(id string) error
+}
+
+type ApiKeyManager interface {
+	CreateApiKey(name string, sb model.Subject, scopes []string, expiresAt int64) (key string, info model.ApiKey, err error)
+	GetApiKeys() ([]model.ApiKey, error)
+	RevokeApiKey(id string) error
+}
@@ -0,0 +1,9 @@
+package driven
+
+import (
+	"github.com/nullexp/finman-api-gateway/internal/port/model"
+)
+
+type KeySetProvider interface {
+	GetJwks() model.Jwks
+}
@@ -1,6 +1,8 @@
 package driven
 
 import (
+	"time"
+
 	"github.com/nullexp/finman-api-gateway/internal/port/model"
 )
 
@@ -13,4 +15,9 @@ type TokenService interface {
 	GetToken(tokenString string) (model.StandardClaims, error)
 	CheckToken(tokenString string) (bool, error)
 	GetSubject(subject string) (out model.Subject, err error)
+	CreateRefreshToken(sb model.Subject) (string, error)
+	// CreateSession returns the token and the first refresh token of a new login session.
+	CreateSession(sb model.Subject) (token string, refreshToken string, err error)
+	Refresh(refreshToken string) (token string, newRefreshToken string, err error)
+	CreateImpersonationToken(target model.Subject, actorId string) (token string, expiresAt time.Time, err error)
 }
@@ -0,0 +1,27 @@
+package driven
+
+import (
+	"errors"
+
+	"github.com/nullexp/finman-api-gateway/internal/port/model"
+)
+
+var (
+	ErrSigningKeyNotFound = errors.New("signing key not found")
+	ErrRetireActiveKey    = errors.New("active signing key can not be retired, promote another key first")
+)
+
+type KeyManager interface {
+	GetKeys() []model.SigningKeyInfo
+	GenerateKey(alg string) (model.SigningKeyInfo, error)
+	Promote(kid string) error
+	Retire(kid string) error
+}
+
+// SigningKeyStore keeps the keys of the key ring, so tokens signed before a restart, or by another
+// instance sharing the store, keep verifying. It holds private keys and must be protected as such.
+type SigningKeyStore interface {
+	Save(model.StoredSigningKey) error
+	GetAll() ([]model.StoredSigningKey, error)
+	Delete(id string) error
+}
@@ -0,0 +1,27 @@
+package driven
+
+import (
+	"errors"
+	"time"
+
+	"github.com/nullexp/finman-api-gateway/internal/port/model"
+)
+
+var ErrTooManyAttempts = errors.New("too many failed login attempts, try again later")
+
+// LoginAttemptStore keeps failed login counters. Entries past their ExpiresAt may be dropped.
+type LoginAttemptStore interface {
+	Get(key string) (model.LoginAttempts, bool, error)
+	Save(model.LoginAttempts) error
+	Delete(key string) error
+}
+
+type LoginGuard interface {
+	// Check returns ErrTooManyAttempts along with the time left when the username or the ip is locked out.
+	Check(username, ip string) (time.Duration, error)
+	Fail(username, ip string) error
+	// Succeed forgets the failures of the username, the ones of the ip are kept.
+	Succeed(username string) error
+	// Clear lifts the lockout of a username or an ip.
+	Clear(usernameOrIp string) error
+}
@@ -0,0 +1,13 @@
+package model
+
+// ApiKey is a long lived credential of a machine client. Only the hash of the key is stored.
+type ApiKey struct {
+	Id         string   `json:"id"`
+	Name       string   `json:"name"`
+	Hash       string   `json:"-"`
+	Subject    Subject  `json:"subject"`
+	Scopes     []string `json:"scopes"`
+	CreatedAt  int64    `json:"createdAt"`
+	ExpiresAt  int64    `json:"expiresAt,omitempty"` // zero for keys that never expire
+	LastUsedAt int64    `json:"lastUsedAt,omitempty"`
+}
@@ -0,0 +1,36 @@
+package model
+
+// Jwk is a public key in JSON Web Key format (RFC 7517).
+type Jwk struct {
+	KeyType   string `json:"kty"`
+	KeyId     string `json:"kid"`
+	Algorithm string `json:"alg"`
+	Use       string `json:"use"`
+	Curve     string `json:"crv,omitempty"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+	X         string `json:"x,omitempty"`
+	Y         string `json:"y,omitempty"`
+}
+
+type Jwks struct {
+	Keys []Jwk `json:"keys"`
+}
+
+// SigningKeyInfo describes a key of the key ring without exposing its material.
+type SigningKeyInfo struct {
+	Id        string `json:"id"`
+	Algorithm string `json:"algorithm"`
+	Active    bool   `json:"active"`
+	RetireAt  int64  `json:"retireAt,omitempty"` // zero for keys that are kept until retired by hand
+}
+
+// StoredSigningKey is a key of the key ring as a SigningKeyStore keeps it.
+type StoredSigningKey struct {
+	Id        string `json:"id"`
+	Algorithm string `json:"algorithm"`
+	Private   []byte `json:"private,omitempty"` // PKCS #8 DER, or the secret of an HMAC key
+	Public    []byte `json:"public,omitempty"`  // PKIX DER of a verify-only key
+	Active    bool   `json:"active"`
+	RetireAt  int64  `json:"retireAt,omitempty"`
+}
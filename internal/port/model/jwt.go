@@ -4,6 +4,8 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"time"
+
+	"github.com/nullexp/finman-api-gateway/pkg/infrastructure/misc"
 )
 
 type StandardClaims struct {
@@ -14,10 +16,18 @@ type StandardClaims struct {
 	Issuer    string   `json:"iss,omitempty"`
 	NotBefore int64    `json:"nbf,omitempty"`
 	Subject   string   `json:"sub,omitempty"`
+	Scope     string   `json:"scope,omitempty"` // space separated permissions of a client token
+	Actor     *Actor   `json:"act,omitempty"`   // set on impersonation tokens
+	SessionId string   `json:"sid,omitempty"`   // login session, the family of its refresh tokens
+}
+
+// Actor is the act claim of RFC 8693, naming the admin an impersonation token was minted for.
+type Actor struct {
+	Subject string `json:"sub"`
 }
 
 func (c StandardClaims) Valid() error {
-	return nil
+	return misc.ClaimsPolicy{}.Validate(c)
 }
 
 func (c StandardClaims) GetExpireTime() int64 {
@@ -44,17 +54,43 @@ func (c StandardClaims) GetIdentity() string {
 	return c.Identity
 }
 
+func (c StandardClaims) GetNotBefore() int64 {
+	return c.NotBefore
+}
+
+func (c StandardClaims) GetActor() string {
+	if c.Actor == nil {
+		return ""
+	}
+	return c.Actor.Subject
+}
+
+func (c StandardClaims) GetSessionId() string {
+	return c.SessionId
+}
+
 func (c StandardClaims) IsExpired() bool {
 	return time.Now().Unix() > c.ExpiresAt
 }
 
+// ScopedClaims is the claim of an api key or a client token, it grants only the listed scopes.
+type ScopedClaims struct {
+	StandardClaims
+	Scopes []string
+}
+
+func (c ScopedClaims) GetScopes() []string {
+	return c.Scopes
+}
+
 type SubjectParser interface {
 	MustParseSubject(string) Subject
 }
 
 type Subject struct {
-	UserId  string `json:"userId"`
-	IsAdmin bool   `json:"isAdmin"`
+	UserId   string `json:"userId"`
+	IsAdmin  bool   `json:"isAdmin"`
+	ClientId string `json:"clientId,omitempty"` // set instead of UserId for tokens of oauth clients
 }
 
 type testSubjectParser struct {
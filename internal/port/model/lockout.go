@@ -0,0 +1,10 @@
+package model
+
+// LoginAttempts counts the failed logins of a username or of a client ip.
+type LoginAttempts struct {
+	Key         string `json:"key"`
+	Failures    int    `json:"failures"`
+	LastFailure int64  `json:"lastFailure"`
+	LockedUntil int64  `json:"lockedUntil,omitempty"`
+	ExpiresAt   int64  `json:"expiresAt"` // the failures are forgotten after this time
+}
@@ -0,0 +1,33 @@
+package model
+
+// OAuthClient is a service registered to get tokens through the client credentials grant.
+type OAuthClient struct {
+	Id         string   `json:"id"`
+	Name       string   `json:"name"`
+	SecretHash string   `json:"secretHash"`
+	Scopes     []string `json:"scopes"` // the most a token of this client may grant
+}
+
+// OAuthToken is the access token response of RFC 6749 section 5.1.
+type OAuthToken struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+	Scope       string `json:"scope,omitempty"`
+}
+
+// Introspection is the introspection response of RFC 7662 section 2.2. Only Active is set for inactive tokens.
+type Introspection struct {
+	Active    bool     `json:"active"`
+	Scope     string   `json:"scope,omitempty"`
+	ClientId  string   `json:"client_id,omitempty"`
+	TokenType string   `json:"token_type,omitempty"`
+	ExpiresAt int64    `json:"exp,omitempty"`
+	IssuedAt  int64    `json:"iat,omitempty"`
+	NotBefore int64    `json:"nbf,omitempty"`
+	Subject   string   `json:"sub,omitempty"`
+	Audience  []string `json:"aud,omitempty"`
+	Issuer    string   `json:"iss,omitempty"`
+	Identity  string   `json:"jti,omitempty"`
+	User      *Subject `json:"subject,omitempty"` // the decoded sub claim
+}
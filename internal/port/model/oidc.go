@@ -0,0 +1,16 @@
+package model
+
+// OidcDiscovery holds the fields of an OpenID provider configuration document the gateway uses.
+type OidcDiscovery struct {
+	Issuer  string `json:"issuer"`
+	JwksUri string `json:"jwks_uri"`
+}
+
+// OidcMapping maps an external user, by subject or by group, to a FinMan subject.
+// UserId is required, the external subject is never used as a FinMan user id.
+type OidcMapping struct {
+	Subject string `json:"sub,omitempty"`
+	Group   string `json:"group,omitempty"`
+	UserId  string `json:"userId,omitempty"`
+	IsAdmin bool   `json:"isAdmin"`
+}
@@ -0,0 +1,11 @@
+package model
+
+// RefreshToken is the stored form of a refresh token. The raw token is never
+// kept, only its hash, so a leaked store cannot be replayed.
+type RefreshToken struct {
+	Id        string
+	Family    string
+	Subject   Subject
+	ExpiresAt int64
+	Used      bool
+}
@@ -0,0 +1,21 @@
+package driven
+
+import (
+	"errors"
+
+	"github.com/nullexp/finman-api-gateway/internal/port/model"
+)
+
+var (
+	ErrInvalidClient = errors.New("client authentication failed")
+	ErrInvalidScope  = errors.New("requested scope is not allowed for the client")
+)
+
+type OAuthClientStore interface {
+	GetClient(id string) (model.OAuthClient, error)
+}
+
+type OAuthServer interface {
+	IssueClientToken(clientId, clientSecret string, scopes []string) (model.OAuthToken, error)
+	Introspect(clientId, clientSecret, token string) (model.Introspection, error)
+}
@@ -0,0 +1,9 @@
+package driven
+
+// PermissionInvalidator drops cached permission decisions once the roles behind them change.
+type PermissionInvalidator interface {
+	// InvalidateUser drops the decisions of a single user, such as one whose role was replaced.
+	InvalidateUser(userId string)
+	// InvalidateAll drops every decision, a changed role may affect any user holding it.
+	InvalidateAll()
+}
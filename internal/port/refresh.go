@@ -0,0 +1,22 @@
+package driven
+
+import (
+	"errors"
+
+	"github.com/nullexp/finman-api-gateway/internal/port/model"
+)
+
+var (
+	ErrRefreshTokenNotFound = errors.New("refresh token not found")
+	ErrRefreshTokenReused   = errors.New("refresh token has already been used")
+	ErrRefreshTokenExpired  = errors.New("refresh token is expired")
+)
+
+type RefreshTokenStore interface {
+	Save(token model.RefreshToken) error
+	// Consume marks the token as used and returns it. If the token was already
+	// used it is returned along with ErrRefreshTokenReused.
+	Consume(id string) (model.RefreshToken, error)
+	RevokeFamily(family string) error
+	RevokeUser(userId string) error
+}
@@ -0,0 +1,10 @@
+package driven
+
+type SessionRevoker interface {
+	// Revoke invalidates a single token until it expires.
+	Revoke(identity string, expiresAt int64) error
+	// RevokeUser invalidates every token and refresh token issued to the user so far.
+	RevokeUser(userId string) error
+	// RevokeSession invalidates every token and refresh token of a login session.
+	RevokeSession(sessionId string) error
+}
@@ -18,3 +18,9 @@ type ErrorDto struct {
 	Details     []interface{} `json:"details,omitempty"`
 	Type        ErrorType     `json:"type"`
 }
+
+// FieldViolation is a detail of an ErrorDto telling what is wrong with a field of the request.
+type FieldViolation struct {
+	Field       string `json:"field"`
+	Description string `json:"description"`
+}
@@ -0,0 +1,71 @@
+package interceptor
+
+import (
+	"context"
+	"strings"
+
+	httpapi "github.com/nullexp/finman-api-gateway/pkg/infrastructure/http/protocol"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// Metadata keys the origin of a call is sent under, forwarded headers keep their lower cased name.
+const (
+	SubjectKey   = "x-subject"
+	ActorKey     = "x-actor"
+	TokenIdKey   = "x-token-id"
+	RequestIdKey = "x-request-id"
+	ClientIPKey  = "x-client-ip"
+	// IdempotencyKeyKey lets the service recognize a call it already did, when the call is retried. It
+	// is sent by UnaryRetry on the calls that are not idempotent only.
+	IdempotencyKeyKey = "idempotency-key"
+)
+
+// UnaryOrigin sends the origin of the request a call is made for, when its context carries one, as
+// outgoing metadata.
+func UnaryOrigin() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		return invoker(withOriginMetadata(ctx), method, req, reply, cc, opts...)
+	}
+}
+
+// StreamOrigin is UnaryOrigin for streams.
+func StreamOrigin() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return streamer(withOriginMetadata(ctx), desc, cc, method, opts...)
+	}
+}
+
+func withOriginMetadata(ctx context.Context) context.Context {
+	origin, ok := httpapi.OriginFrom(ctx)
+	if !ok {
+		return ctx
+	}
+	return metadata.NewOutgoingContext(ctx, metadata.Join(OriginMetadata(origin), outgoing(ctx)))
+}
+
+// OriginMetadata returns the metadata the origin is sent as, leaving out what is unknown. The idempotency
+// key is left to UnaryRetry, which knows the calls that need it.
+func OriginMetadata(origin httpapi.Origin) metadata.MD {
+	md := metadata.MD{}
+	for k, v := range map[string]string{
+		SubjectKey:   origin.Subject,
+		ActorKey:     origin.Actor,
+		TokenIdKey:   origin.TokenId,
+		RequestIdKey: origin.RequestId,
+		ClientIPKey:  origin.ClientIP,
+	} {
+		if v != "" {
+			md.Set(k, v)
+		}
+	}
+	for k, v := range origin.Headers {
+		md.Append(strings.ToLower(k), v...)
+	}
+	return md
+}
+
+func outgoing(ctx context.Context) metadata.MD {
+	md, _ := metadata.FromOutgoingContext(ctx)
+	return md
+}
@@ -0,0 +1,50 @@
+package interceptor
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	httpapi "github.com/nullexp/finman-api-gateway/pkg/infrastructure/http/protocol"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestUnaryOrigin(t *testing.T) {
+	call := func(ctx context.Context) metadata.MD {
+		var sent metadata.MD
+		invoker := func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+			sent, _ = metadata.FromOutgoingContext(ctx)
+			return nil
+		}
+		assert.NoError(t, UnaryOrigin()(ctx, "/user.v1.UserService/GetUser", nil, nil, nil, invoker))
+		return sent
+	}
+
+	t.Run("Expect the origin as metadata", func(t *testing.T) {
+		ctx := httpapi.WithOrigin(context.Background(), httpapi.Origin{
+			Subject:        "7",
+			TokenId:        "jti-1",
+			RequestId:      "req-1",
+			ClientIP:       "10.0.0.9",
+			IdempotencyKey: "key-1",
+			Headers:        http.Header{"Accept-Language": {"fa-IR"}, "Traceparent": {"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}},
+		})
+		ctx = metadata.AppendToOutgoingContext(ctx, "x-custom", "kept")
+		md := call(ctx)
+		assert.Equal(t, []string{"7"}, md.Get(SubjectKey))
+		assert.Equal(t, []string{"jti-1"}, md.Get(TokenIdKey))
+		assert.Equal(t, []string{"req-1"}, md.Get(RequestIdKey))
+		assert.Equal(t, []string{"10.0.0.9"}, md.Get(ClientIPKey))
+		assert.Empty(t, md.Get(IdempotencyKeyKey))
+		assert.Equal(t, []string{"fa-IR"}, md.Get("accept-language"))
+		assert.Equal(t, []string{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}, md.Get("traceparent"))
+		assert.Equal(t, []string{"kept"}, md.Get("x-custom"))
+		assert.Empty(t, md.Get(ActorKey))
+	})
+
+	t.Run("Expect no metadata without an origin", func(t *testing.T) {
+		assert.Empty(t, call(context.Background()))
+	})
+}
@@ -0,0 +1,280 @@
+package interceptor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	httpapi "github.com/nullexp/finman-api-gateway/pkg/infrastructure/http/protocol"
+	logger "github.com/nullexp/finman-api-gateway/pkg/infrastructure/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"gopkg.in/yaml.v3"
+)
+
+const retryLog = "Retrying %s in %s, attempt %d failed: %v"
+
+// RetryCodes are the codes of the failures a call is retried on, the service did not do the call.
+var RetryCodes = []codes.Code{codes.Unavailable, codes.ResourceExhausted}
+
+// IdempotentPrefixes start the names of the RPCs retried without an idempotency key, unless their
+// policy says otherwise. They only read.
+var IdempotentPrefixes = []string{"Get", "List", "Is"}
+
+// DefaultRetryPolicy is the policy of a service left out of the retry config.
+var DefaultRetryPolicy = ServiceRetryPolicy{
+	RetryPolicy: RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     time.Second,
+		Multiplier:     2,
+	},
+	BudgetTokens: 10,
+	BudgetRatio:  0.1,
+}
+
+// RetryConfig holds the retry policy of every upstream service by name. It is read from a YAML or
+// JSON file.
+type RetryConfig struct {
+	Services map[string]ServiceRetryPolicy `yaml:"services"`
+}
+
+// RetryPolicy tells how often a failed call is tried and how long to wait in between. The wait grows
+// by Multiplier from InitialBackoff up to MaxBackoff, a random part of it being taken off so callers
+// do not come back together.
+type RetryPolicy struct {
+	MaxAttempts    int           `yaml:"maxAttempts"` // the first attempt included, 1 never retries
+	InitialBackoff time.Duration `yaml:"initialBackoff"`
+	MaxBackoff     time.Duration `yaml:"maxBackoff"`
+	Multiplier     float64       `yaml:"multiplier"`
+	// Idempotent RPCs are retried on their own, the others only for a request with an idempotency
+	// key. Unset, it goes by IdempotentPrefixes.
+	Idempotent *bool `yaml:"idempotent"`
+}
+
+// ServiceRetryPolicy is the policy of the RPCs of a service, Methods overriding it by RPC name. Unset
+// fields of a method take the value of the service, and unset fields of the service the default.
+//
+// Retries of a service are bounded by a budget: every retry costs a token and a success gives
+// BudgetRatio back, calls are not retried while half of BudgetTokens or less would be left. Failures
+// that are not retried cost nothing. It keeps a service that is down from getting every call several
+// times.
+type ServiceRetryPolicy struct {
+	RetryPolicy  `yaml:",inline"`
+	BudgetTokens float64                `yaml:"budgetTokens"`
+	BudgetRatio  float64                `yaml:"budgetRatio"`
+	Methods      map[string]RetryPolicy `yaml:"methods"`
+}
+
+// ParseRetryConfig reads a retry config, fields it does not know are errors so typos do not go unseen.
+func ParseRetryConfig(data []byte) (config RetryConfig, err error) {
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err = decoder.Decode(&config); err != nil && !errors.Is(err, io.EOF) {
+		return RetryConfig{}, err
+	}
+	return config, nil
+}
+
+// LoadRetryConfig reads the retry config at path.
+func LoadRetryConfig(path string) (RetryConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return RetryConfig{}, err
+	}
+	return ParseRetryConfig(data)
+}
+
+// Validate checks the config against the services, by name, and the RPCs each one serves.
+func (c RetryConfig) Validate(services map[string][]grpc.ServiceDesc) error {
+	for name, service := range c.Services {
+		descs, ok := services[name]
+		if !ok {
+			return fmt.Errorf("retry policy of service %s: unknown service", name)
+		}
+		if err := service.RetryPolicy.validate(); err != nil {
+			return fmt.Errorf("retry policy of service %s: %w", name, err)
+		}
+		if service.BudgetTokens < 0 || service.BudgetRatio < 0 {
+			return fmt.Errorf("retry policy of service %s: budget must not be negative", name)
+		}
+		for method, policy := range service.Methods {
+			if !servesMethod(descs, method) {
+				return fmt.Errorf("retry policy of %s.%s: unknown method", name, method)
+			}
+			if err := policy.validate(); err != nil {
+				return fmt.Errorf("retry policy of %s.%s: %w", name, method, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (p RetryPolicy) validate() error {
+	switch {
+	case p.MaxAttempts < 0:
+		return errors.New("maxAttempts must not be negative")
+	case p.InitialBackoff < 0 || p.MaxBackoff < 0:
+		return errors.New("backoff must not be negative")
+	case p.Multiplier != 0 && p.Multiplier < 1:
+		return errors.New("multiplier must be 1 or more")
+	}
+	return nil
+}
+
+func servesMethod(descs []grpc.ServiceDesc, method string) bool {
+	for _, desc := range descs {
+		for _, v := range desc.Methods {
+			if v.MethodName == method {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Service returns the policy of the service, filled in by the default.
+func (c RetryConfig) Service(name string) ServiceRetryPolicy {
+	service := c.Services[name]
+	service.RetryPolicy = service.RetryPolicy.or(DefaultRetryPolicy.RetryPolicy)
+	if service.BudgetTokens == 0 {
+		service.BudgetTokens = DefaultRetryPolicy.BudgetTokens
+	}
+	if service.BudgetRatio == 0 {
+		service.BudgetRatio = DefaultRetryPolicy.BudgetRatio
+	}
+	return service
+}
+
+// method returns the policy of the RPC, method being its full name.
+func (s ServiceRetryPolicy) method(method string) RetryPolicy {
+	name := path.Base(method)
+	policy := s.Methods[name].or(s.RetryPolicy)
+	if policy.Idempotent == nil {
+		idempotent := slices.ContainsFunc(IdempotentPrefixes, func(prefix string) bool { return strings.HasPrefix(name, prefix) })
+		policy.Idempotent = &idempotent
+	}
+	return policy
+}
+
+// or fills the unset fields of the policy from def.
+func (p RetryPolicy) or(def RetryPolicy) RetryPolicy {
+	if p.MaxAttempts == 0 {
+		p.MaxAttempts = def.MaxAttempts
+	}
+	if p.InitialBackoff == 0 {
+		p.InitialBackoff = def.InitialBackoff
+	}
+	if p.MaxBackoff == 0 {
+		p.MaxBackoff = def.MaxBackoff
+	}
+	if p.Multiplier == 0 {
+		p.Multiplier = def.Multiplier
+	}
+	if p.Idempotent == nil {
+		p.Idempotent = def.Idempotent
+	}
+	return p
+}
+
+// backoff returns how long to wait after the failed attempt, counting from 1.
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	wait := float64(p.InitialBackoff)
+	for i := 1; i < attempt && wait < float64(p.MaxBackoff); i++ {
+		wait *= p.Multiplier
+	}
+	wait = min(wait, float64(p.MaxBackoff))
+	return time.Duration(wait/2 + rand.Float64()*wait/2)
+}
+
+// retryBudget is a token bucket shared by the calls to a service.
+type retryBudget struct {
+	mu     sync.Mutex
+	tokens float64
+	max    float64
+	ratio  float64
+}
+
+func newRetryBudget(max, ratio float64) *retryBudget {
+	return &retryBudget{tokens: max, max: max, ratio: ratio}
+}
+
+func (b *retryBudget) succeed() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens = min(b.tokens+b.ratio, b.max)
+}
+
+// retry reports whether the budget allows a retry, taking its token when it does.
+func (b *retryBudget) retry() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.tokens-1 <= b.max/2 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// UnaryRetry retries the calls to a service that fail with one of RetryCodes, by the policy of the
+// service. Calls of an RPC that is not idempotent are retried only for a request with an idempotency
+// key, the key being sent with them, and the wait between attempts ends with the context of the call.
+func UnaryRetry(service ServiceRetryPolicy) grpc.UnaryClientInterceptor {
+	budget := newRetryBudget(service.BudgetTokens, service.BudgetRatio)
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		policy := service.method(method)
+		if !*policy.Idempotent {
+			ctx = withIdempotencyKey(ctx)
+		}
+		retryable := *policy.Idempotent || hasIdempotencyKey(ctx)
+		for attempt := 1; ; attempt++ {
+			err := invoker(ctx, method, req, reply, cc, opts...)
+			if err == nil {
+				budget.succeed()
+				return nil
+			}
+			if !slices.Contains(RetryCodes, status.Code(err)) {
+				return err
+			}
+			if !retryable || attempt >= policy.MaxAttempts || !budget.retry() {
+				return err
+			}
+			wait := policy.backoff(attempt)
+			logger.Warning.Printf(retryLog, method, wait, attempt, err)
+			timer := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return err
+			case <-timer.C:
+			}
+		}
+	}
+}
+
+// withIdempotencyKey sends the idempotency key of the request, calls that only read go without it.
+func withIdempotencyKey(ctx context.Context) context.Context {
+	origin, ok := httpapi.OriginFrom(ctx)
+	if !ok || origin.IdempotencyKey == "" {
+		return ctx
+	}
+	md := outgoing(ctx).Copy()
+	md.Set(IdempotencyKeyKey, origin.IdempotencyKey)
+	return metadata.NewOutgoingContext(ctx, md)
+}
+
+func hasIdempotencyKey(ctx context.Context) bool {
+	md, _ := metadata.FromOutgoingContext(ctx)
+	return len(md.Get(IdempotencyKeyKey)) != 0
+}
@@ -0,0 +1,183 @@
+package interceptor
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	httpapi "github.com/nullexp/finman-api-gateway/pkg/infrastructure/http/protocol"
+	"github.com/nullexp/finman-api-gateway/pkg/infrastructure/log"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	getTransaction    = "/transaction.v1.TransactionService/GetTransactionById"
+	createTransaction = "/transaction.v1.TransactionService/CreateTransaction"
+)
+
+func TestRetryConfig(t *testing.T) {
+	services := map[string][]grpc.ServiceDesc{"transaction": {{
+		ServiceName: "transaction.v1.TransactionService",
+		Methods:     []grpc.MethodDesc{{MethodName: "CreateTransaction"}, {MethodName: "GetTransactionById"}},
+	}}}
+
+	t.Run("Expect services and methods to be filled in by their defaults", func(t *testing.T) {
+		config, err := ParseRetryConfig([]byte(`
+services:
+  transaction:
+    maxAttempts: 5
+    initialBackoff: 50ms
+    methods:
+      CreateTransaction:
+        idempotent: true
+        maxBackoff: 3s
+`))
+		assert.NoError(t, err)
+		assert.NoError(t, config.Validate(services))
+
+		service := config.Service("transaction")
+		assert.Equal(t, 5, service.MaxAttempts)
+		assert.Equal(t, 50*time.Millisecond, service.InitialBackoff)
+		assert.Equal(t, DefaultRetryPolicy.MaxBackoff, service.MaxBackoff)
+		assert.Equal(t, DefaultRetryPolicy.BudgetTokens, service.BudgetTokens)
+
+		create := service.method(createTransaction)
+		assert.True(t, *create.Idempotent)
+		assert.Equal(t, 5, create.MaxAttempts)
+		assert.Equal(t, 3*time.Second, create.MaxBackoff)
+		assert.True(t, *service.method(getTransaction).Idempotent)
+		assert.False(t, *service.method("/transaction.v1.TransactionService/DeleteTransaction").Idempotent)
+
+		assert.Equal(t, DefaultRetryPolicy.MaxAttempts, config.Service("user").MaxAttempts)
+	})
+
+	t.Run("Expect invalid configs to be rejected", func(t *testing.T) {
+		for _, data := range []string{
+			"services: {transaction: {maxAttemps: 2}}",
+			"services: {payment: {maxAttempts: 2}}",
+			"services: {transaction: {methods: {CreatePayment: {maxAttempts: 2}}}}",
+			"services: {transaction: {multiplier: 0.5}}",
+			"services: {transaction: {methods: {CreateTransaction: {maxAttempts: -1}}}}",
+		} {
+			config, err := ParseRetryConfig([]byte(data))
+			if err == nil {
+				err = config.Validate(services)
+			}
+			assert.Error(t, err, data)
+		}
+	})
+}
+
+func TestUnaryRetry(t *testing.T) {
+	log.Initialize()
+	policy := ServiceRetryPolicy{
+		RetryPolicy:  RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: 2 * time.Millisecond, Multiplier: 2},
+		BudgetTokens: 100,
+		BudgetRatio:  1,
+	}
+
+	// call fails with the codes in turn, then succeeds, and returns the number of attempts
+	call := func(retry grpc.UnaryClientInterceptor, ctx context.Context, method string, failures ...codes.Code) (int, error) {
+		attempts := 0
+		invoker := func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+			attempts++
+			if attempts <= len(failures) {
+				return status.Error(failures[attempts-1], "failed")
+			}
+			return nil
+		}
+		err := retry(ctx, method, nil, nil, nil, invoker)
+		return attempts, err
+	}
+
+	t.Run("Expect idempotent calls to be retried until they succeed", func(t *testing.T) {
+		attempts, err := call(UnaryRetry(policy), context.Background(), getTransaction, codes.Unavailable, codes.ResourceExhausted)
+		assert.NoError(t, err)
+		assert.Equal(t, 3, attempts)
+	})
+
+	t.Run("Expect no more attempts than the policy allows", func(t *testing.T) {
+		attempts, err := call(UnaryRetry(policy), context.Background(), getTransaction, codes.Unavailable, codes.Unavailable, codes.Unavailable)
+		assert.Equal(t, codes.Unavailable, status.Code(err))
+		assert.Equal(t, 3, attempts)
+	})
+
+	t.Run("Expect other failures not to be retried", func(t *testing.T) {
+		attempts, err := call(UnaryRetry(policy), context.Background(), getTransaction, codes.InvalidArgument)
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+		assert.Equal(t, 1, attempts)
+	})
+
+	t.Run("Expect calls that are not idempotent to be retried only with an idempotency key", func(t *testing.T) {
+		attempts, err := call(UnaryRetry(policy), context.Background(), createTransaction, codes.Unavailable)
+		assert.Equal(t, codes.Unavailable, status.Code(err))
+		assert.Equal(t, 1, attempts)
+
+		ctx := httpapi.WithOrigin(context.Background(), httpapi.Origin{IdempotencyKey: "key-1"})
+		attempts, err = call(UnaryRetry(policy), ctx, createTransaction, codes.Unavailable)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, attempts)
+	})
+
+	t.Run("Expect the idempotency key to be sent on calls that are not idempotent only", func(t *testing.T) {
+		ctx := httpapi.WithOrigin(context.Background(), httpapi.Origin{IdempotencyKey: "key-1"})
+		sent := map[string][]string{}
+		invoker := func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+			md, _ := metadata.FromOutgoingContext(ctx)
+			sent[method] = md.Get(IdempotencyKeyKey)
+			return nil
+		}
+		assert.NoError(t, UnaryRetry(policy)(ctx, createTransaction, nil, nil, nil, invoker))
+		assert.NoError(t, UnaryRetry(policy)(ctx, getTransaction, nil, nil, nil, invoker))
+		assert.Equal(t, []string{"key-1"}, sent[createTransaction])
+		assert.Empty(t, sent[getTransaction])
+	})
+
+	t.Run("Expect no retries once the budget is spent", func(t *testing.T) {
+		budgeted := policy
+		budgeted.BudgetTokens = 4
+		budgeted.BudgetRatio = 0.1
+		retry := UnaryRetry(budgeted)
+		attempts, _ := call(retry, context.Background(), getTransaction, codes.Unavailable, codes.Unavailable, codes.Unavailable)
+		assert.Equal(t, 2, attempts)
+		attempts, _ = call(retry, context.Background(), getTransaction, codes.Unavailable)
+		assert.Equal(t, 1, attempts)
+	})
+
+	t.Run("Expect failures that are not retried to leave the budget", func(t *testing.T) {
+		budgeted := policy
+		budgeted.BudgetTokens = 4
+		budgeted.BudgetRatio = 0.1
+		retry := UnaryRetry(budgeted)
+		for range 5 {
+			attempts, _ := call(retry, context.Background(), createTransaction, codes.Unavailable)
+			assert.Equal(t, 1, attempts)
+		}
+		attempts, err := call(retry, context.Background(), getTransaction, codes.Unavailable)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, attempts)
+	})
+
+	t.Run("Expect the wait to end with the context", func(t *testing.T) {
+		slow := policy
+		slow.InitialBackoff, slow.MaxBackoff = time.Hour, time.Hour
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		attempts, err := call(UnaryRetry(slow), ctx, getTransaction, codes.Unavailable)
+		assert.Equal(t, codes.Unavailable, status.Code(err))
+		assert.Equal(t, 1, attempts)
+	})
+}
+
+func TestBackoff(t *testing.T) {
+	policy := RetryPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second, Multiplier: 3}
+	for attempt, ceiling := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 300 * time.Millisecond, 3: 900 * time.Millisecond, 4: time.Second, 10: time.Second} {
+		wait := policy.backoff(attempt)
+		assert.LessOrEqual(t, wait, ceiling)
+		assert.GreaterOrEqual(t, wait, ceiling/2)
+	}
+}
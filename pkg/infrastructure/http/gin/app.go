@@ -5,6 +5,7 @@ import (
 	"context"
 	"embed"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/fs"
@@ -12,6 +13,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"reflect"
+	"slices"
 	"strings"
 	"time"
 
@@ -33,24 +35,28 @@ import (
 //go:embed asset/swagger
 var swaggerDirectory embed.FS
 
-var NotFound = gin.H{"code": "404", "message": "Request not found"}
-
 const (
 	OpenApiRoute                         = "/openapi.json"
+	OpenApiVersionsRoute                 = "/openapi-versions.json"
 	AssetSwagger                         = "asset/swagger"
 	BaseApiURL                           = "/api"
 	Token                                = "token"
 	Authorization                        = "Authorization"
 	Bearer                               = "Bearer"
 	BearerSpace                          = Bearer + " "
+	ApiKey                               = "ApiKey"
+	ApiKeyHeader                         = "X-Api-Key"
+	Allow                                = "Allow"
 	MissingAuthHeader                    = "Authorization header missing."
 	EmptyAuthenticationIsDetected        = "Nil Authentication Is Detected"
 	EmptyAuthorizationIsDetected         = "Nil Authorization Is Detected"
 	UnknownAuthFormat                    = "Unknown Authorization header format."
 	CouldNotParseToken                   = "Could not parse token."
 	TTLExpired                           = "Ttl expired!"
+	TokenRevoked                         = "Token has been revoked."
 	Release                              = "release"
 	UnrecognizedRoute                    = "unrecognized Route."
+	RequestNotFound                      = "Request not found"
 	ArrayIsExpected                      = "An array is Expected."
 	MissingParamWithName                 = "Missing param with name "
 	UnknownValueParameter                = "Unknown value for parameter "
@@ -69,12 +75,22 @@ type GinApp struct {
 	ginDomainHandlers []httpapi.Module
 	preHandlers       map[string][]httpapi.Action
 	PermissionManager *PermissionManager
-	authenticators    map[string]httpapi.Authenticator
-	authorizers       map[string]httpapi.Authorizer
+	authenticators    *prefixTree[map[string]httpapi.Authenticator] // base url to auth scheme to authenticator, nil for no auth
+	authorizers       *prefixTree[httpapi.BatchAuthorizer]
+	revocationList    httpapi.RevocationList
+	claimsPolicy      misc.ClaimsPolicy
 	router            *Router
 	cors              []string
 	logHandler        httpapi.LogHandler
 	logPolicy         model.LogPolicy
+	auditHandler      httpapi.AuditHandler
+	ownerResolver     httpapi.OwnerResolver
+	policyFile        string
+	policyReloadEvery time.Duration
+	policyData        []byte // content of the policy file LoadPolicy applied
+	defaultTimeout    time.Duration
+	forwardedHeaders  []string // inbound headers put on the origin of the request
+	trustedProxies    []string // proxies whose X-Forwarded-For is believed, none by default
 	gin               *gin.Engine
 
 	// for openapi
@@ -85,6 +101,9 @@ type GinApp struct {
 	Errors       []string
 	openApiRoute string
 	jsonOpenApi  string
+	// open api document of every version, by version name
+	versionedOpenApi map[string]string
+	versions         map[string]httpapi.Version
 }
 
 func NewGinApp() *GinApp {
@@ -93,9 +112,10 @@ func NewGinApp() *GinApp {
 	instance.preHandlers = map[string][]httpapi.Action{}
 	instance.PermissionManager = NewPermissionManager()
 	instance.router = NewRouter()
-	instance.authenticators = make(map[string]httpapi.Authenticator)
-	instance.authorizers = map[string]httpapi.Authorizer{}
+	instance.authenticators = newPrefixTree[map[string]httpapi.Authenticator]()
+	instance.authorizers = newPrefixTree[httpapi.BatchAuthorizer]()
 	instance.cors = []string{}
+	instance.forwardedHeaders = slices.Clone(DefaultForwardedHeaders)
 	return &instance
 }
 
@@ -103,6 +123,22 @@ func (ginApp *GinApp) SetLogHandler(handler httpapi.LogHandler) {
 	ginApp.logHandler = handler
 }
 
+// SetAuditHandler sets where impersonated requests are recorded, they are not recorded without one.
+func (ginApp *GinApp) SetAuditHandler(handler httpapi.AuditHandler) {
+	ginApp.auditHandler = handler
+}
+
+// SetOwnerResolver sets how the owner id of a caller is found for ownership rules, it defaults to the
+// sub claim.
+func (ginApp *GinApp) SetOwnerResolver(resolver httpapi.OwnerResolver) {
+	ginApp.ownerResolver = resolver
+}
+
+// GetPermissionCatalog lists the permissions of the registered routes, the app must be initiated.
+func (ginApp *GinApp) GetPermissionCatalog() []model.PermissionCatalogEntry {
+	return ginApp.PermissionManager.Catalog()
+}
+
 func (ginApp *GinApp) GetRoute(url, method string) *httpapi.RequestDefinition {
 	return ginApp.router.GetRoute(url, httpapi.HTTPMethod(method))
 }
@@ -143,19 +179,81 @@ func (ginApp *GinApp) AppendPreHandlers(baseURL string, action httpapi.Action) {
 	ginApp.preHandlers[baseURL] = append(ginApp.preHandlers[baseURL], action)
 }
 
+// AppendAuthorizer registers an authorizer deciding one permission per call, each permission of a route is asked in turn.
 func (ginApp *GinApp) AppendAuthorizer(baseURL string, authorizer httpapi.Authorizer) {
+	ginApp.AppendBatchAuthorizer(baseURL, func(ctx context.Context, identity string, permissions []string) (map[string]bool, error) {
+		out := make(map[string]bool, len(permissions))
+		for _, v := range permissions {
+			valid, err := authorizer(ctx, identity, v)
+			if err != nil {
+				return nil, err
+			}
+			out[v] = valid
+		}
+		return out, nil
+	})
+}
+
+// AppendBatchAuthorizer registers an authorizer deciding every permission of a route in a single call.
+func (ginApp *GinApp) AppendBatchAuthorizer(baseURL string, authorizer httpapi.BatchAuthorizer) {
 	// No Race Condition will ever happens
-	ginApp.authorizers[baseURL] = authorizer
+	ginApp.authorizers.Set(baseURL, authorizer)
 }
 
 func (ginApp *GinApp) AppendAuthenticator(baseURL string, authenticator httpapi.Authenticator) {
+	ginApp.AppendSchemeAuthenticator(baseURL, Bearer, authenticator)
+}
+
+// AppendSchemeAuthenticator registers an authenticator for the given Authorization scheme, like Bearer or ApiKey.
+func (ginApp *GinApp) AppendSchemeAuthenticator(baseURL, scheme string, authenticator httpapi.Authenticator) {
 	// No Race Condition will ever happens
-	ginApp.authenticators[baseURL] = authenticator
+	authenticators, set := ginApp.authenticators.Get(baseURL)
+	if set && authenticators == nil {
+		// Auth was disabled here, the authorizer DisableAuth cleared must not stay cleared
+		if authorizer, ok := ginApp.authorizers.Get(baseURL); ok && authorizer == nil {
+			ginApp.authorizers.Unset(baseURL)
+		}
+	}
+	if authenticators == nil {
+		authenticators = map[string]httpapi.Authenticator{}
+		ginApp.authenticators.Set(baseURL, authenticators)
+	}
+	authenticators[scheme] = authenticator
+}
+
+// DisableAuth lets the routes under the base URL in without authentication and authorization, even
+// when a shorter base URL has an authenticator or an authorizer. Registering an authenticator for the
+// base URL afterwards enables both again, the authorizer of a shorter base URL covering it until one is
+// registered for it.
+func (ginApp *GinApp) DisableAuth(baseURL string) {
+	ginApp.authenticators.Set(baseURL, nil)
+	ginApp.authorizers.Set(baseURL, nil)
+}
+
+func (ginApp *GinApp) SetRevocationList(list httpapi.RevocationList) {
+	ginApp.revocationList = list
+}
+
+// SetClaimsPolicy sets the registered claims Bearer tokens must satisfy. Other schemes have no issuer
+// or audience, so only their validity times are checked.
+func (ginApp *GinApp) SetClaimsPolicy(policy misc.ClaimsPolicy) {
+	ginApp.claimsPolicy = policy
 }
 
 func (ginApp *GinApp) Run(ip string, port uint, mode string) error {
 	ginApp.Init(mode)
-	return ginApp.gin.Run(fmt.Sprintf("%s:%d", ip, port))
+	for _, v := range ginApp.GetAuthReport() {
+		logger.Info.Println(v)
+	}
+	if ginApp.policyFile != "" {
+		if err := ginApp.LoadPolicy(); err != nil {
+			return err
+		}
+		if ginApp.policyReloadEvery > 0 {
+			go ginApp.WatchPolicy(context.Background(), ginApp.policyReloadEvery)
+		}
+	}
+	return http.ListenAndServe(fmt.Sprintf("%s:%d", ip, port), ginApp)
 }
 
 func (ginApp *GinApp) Init(mode string) {
@@ -178,10 +276,16 @@ func (ginApp *GinApp) Init(mode string) {
 	}
 
 	r := gin.New()
+	if err := r.SetTrustedProxies(ginApp.trustedProxies); err != nil {
+		panic(err)
+	}
+	ginApp.initVersions(r)
 	ginApp.initDefaultHandlers(r)
-	ginApp.initRouter()
+	ginApp.initRouter(r)
 	ginApp.enableOpenApiIfRequired(r)
 	ginApp.initAuthentication(r)
+	ginApp.initImpersonation(r)
+	ginApp.initOrigin(r)
 	ginApp.initAuthorization(r)
 	ginApp.initAny(r)
 	ginApp.initDomainHandlers(r)
@@ -192,11 +296,10 @@ func (ginApp *GinApp) Init(mode string) {
 
 func (ginApp *GinApp) initDefaultHandlers(r *gin.Engine) {
 	r.Use(gin.Recovery())
+	r.Use(RequestIdHandler)
 
 	r.NoRoute(func(c *gin.Context) {
-		req := NewRequest(c)
-		req.Negotiate(http.StatusNotFound, nil, NotFound)
-		c.Abort()
+		NewRequest(c).SetNotFound(RequestNotFound, response.NotFound)
 	})
 
 	r.Use(helmet.Default())
@@ -216,6 +319,28 @@ func (ginApp *GinApp) initDefaultHandlers(r *gin.Engine) {
 	if gin.Mode() != gin.ReleaseMode {
 		r.Use(gin.Logger())
 	}
+	r.Use(HeadHandler)
+}
+
+// HeadHandler lets HEAD requests run the GET handler of the route and drops the body it writes.
+func HeadHandler(c *gin.Context) {
+	if c.Request.Method == http.MethodHead {
+		c.Writer = &headWriter{ResponseWriter: c.Writer}
+	}
+}
+
+type headWriter struct {
+	gin.ResponseWriter
+}
+
+func (w *headWriter) Write(data []byte) (int, error) {
+	w.WriteHeaderNow()
+	return len(data), nil
+}
+
+func (w *headWriter) WriteString(s string) (int, error) {
+	w.WriteHeaderNow()
+	return len(s), nil
 }
 
 func (ginApp *GinApp) enableOpenApiIfRequired(r *gin.Engine) {
@@ -224,9 +349,24 @@ func (ginApp *GinApp) enableOpenApiIfRequired(r *gin.Engine) {
 	}
 
 	r.GET(OpenApiRoute, func(ctx *gin.Context) {
-		_, _ = ctx.Writer.Write([]byte(ginApp.jsonOpenApi))
+		document := ginApp.jsonOpenApi
+		if version := ctx.Query(Version); version != "" {
+			if document = ginApp.versionedOpenApi[version]; document == "" {
+				NewRequest(ctx).SetNotFound(RequestNotFound, response.NotFound)
+				return
+			}
+		}
+		_, _ = ctx.Writer.Write([]byte(document))
 		ctx.Status(http.StatusOK)
 	})
+	r.GET(OpenApiVersionsRoute, func(ctx *gin.Context) {
+		versions := []string{}
+		for k := range ginApp.versionedOpenApi {
+			versions = append(versions, k)
+		}
+		slices.Sort(versions)
+		ctx.JSON(http.StatusOK, versions)
+	})
 	fsRoot, _ := fs.Sub(swaggerDirectory, AssetSwagger)
 	r.StaticFS(ginApp.openApiRoute, http.FS(fsRoot))
 }
@@ -236,28 +376,25 @@ func (ginApp *GinApp) initAuthentication(r *gin.Engine) {
 }
 
 func (ginApp *GinApp) AuthenticationHandler(c *gin.Context) {
-	route := GetRegisteredRoute(c, BaseApiURL)
+	route := ginApp.matchRoute(c).Template
 	if ginApp.router.IsFree(route, httpapi.HTTPMethod(c.Request.Method)) {
 		return
 	}
-	var authenticator httpapi.Authenticator
-	for k, v := range ginApp.authenticators {
-		if strings.HasPrefix(route, k) {
-			authenticator = v
-			break
-		}
-	}
+	authenticators, _, _ := ginApp.authenticators.Match(ginApp.unversioned(route))
 	req := NewRequest(c)
-	if authenticator == nil {
+	if authenticators == nil {
 		return
 	}
 
 	reqToken := ""
 
-	if c.Query(Token) == "" {
-		reqToken = c.GetHeader(Authorization)
-	} else {
+	switch {
+	case c.Query(Token) != "":
 		reqToken = BearerSpace + c.Query(Token)
+	case c.GetHeader(ApiKeyHeader) != "":
+		reqToken = ApiKey + " " + c.GetHeader(ApiKeyHeader)
+	default:
+		reqToken = c.GetHeader(Authorization)
 	}
 
 	if reqToken == "" {
@@ -267,7 +404,14 @@ func (ginApp *GinApp) AuthenticationHandler(c *gin.Context) {
 
 	splitToken := strings.Split(reqToken, " ")
 
-	if splitToken == nil || len(splitToken) != 2 || splitToken[0] != Bearer {
+	if splitToken == nil || len(splitToken) != 2 {
+		req.SetUnauthorized(UnknownAuthFormat, response.UnknownFormat)
+		return
+	}
+
+	scheme := splitToken[0]
+	authenticator := authenticators[scheme]
+	if authenticator == nil {
 		req.SetUnauthorized(UnknownAuthFormat, response.UnknownFormat)
 		return
 	}
@@ -280,9 +424,30 @@ func (ginApp *GinApp) AuthenticationHandler(c *gin.Context) {
 		return
 	}
 
-	if m.IsExpired() {
+	policy := ginApp.claimsPolicy
+	if scheme != Bearer {
+		policy = misc.ClaimsPolicy{Leeway: policy.Leeway}
+	}
+	err = policy.Validate(m)
+	switch {
+	case errors.Is(err, misc.ErrTokenExpired):
 		req.SetUnauthorized(TTLExpired, response.SessionExpired)
 		return
+	case errors.Is(err, misc.ErrTokenNotYetValid):
+		req.SetUnauthorized(err.Error(), response.TokenNotYetValid)
+		return
+	case errors.Is(err, misc.ErrTokenIssuedInFuture):
+		req.SetUnauthorized(err.Error(), response.TokenIssuedInFuture)
+		return
+	case errors.Is(err, misc.ErrInvalidIssuer):
+		req.SetUnauthorized(err.Error(), response.InvalidIssuer)
+		return
+	case errors.Is(err, misc.ErrInvalidAudience):
+		req.SetUnauthorized(err.Error(), response.InvalidAudience)
+		return
+	case err != nil:
+		req.SetUnauthorized(err.Error(), response.UnknownFormat)
+		return
 	}
 
 	var valid bool
@@ -297,16 +462,104 @@ func (ginApp *GinApp) AuthenticationHandler(c *gin.Context) {
 		return
 	}
 
+	if ginApp.revocationList != nil {
+		var revoked bool
+		revoked, err = ginApp.revocationList.IsRevoked(m)
+		if err != nil {
+			req.SetServerError(err.Error())
+			return
+		}
+		if revoked {
+			req.SetUnauthorized(TokenRevoked, response.SessionRevoked)
+			return
+		}
+	}
+
 	req.Set(httpapi.KeyAuth, m)
 }
 
-func (ginApp *GinApp) initRouter() {
+func (ginApp *GinApp) initOrigin(r *gin.Engine) {
+	r.Use(ginApp.OriginHandler)
+}
+
+func (ginApp *GinApp) initImpersonation(r *gin.Engine) {
+	r.Use(ginApp.ImpersonationHandler)
+}
+
+// ImpersonationHandler keeps impersonation tokens to read only routes and to the routes allowing
+// them, then hands every request made with one to the audit handler, refused ones included.
+func (ginApp *GinApp) ImpersonationHandler(c *gin.Context) {
+	auth, _ := c.Get(httpapi.KeyAuth)
+	claim, ok := auth.(misc.ActingClaim)
+	if !ok || claim.GetActor() == "" {
+		return
+	}
+
+	route := ginApp.matchRoute(c).Template
+	switch c.Request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		c.Next()
+	default:
+		if definition := ginApp.router.GetRoute(route, httpapi.HTTPMethod(c.Request.Method)); definition != nil && definition.AllowImpersonation {
+			c.Next()
+		} else {
+			NewRequest(c).SetForbidden()
+		}
+	}
+
+	if ginApp.auditHandler == nil {
+		return
+	}
+	ginApp.auditHandler.Handle(model.AuditLog{
+		Time:    time.Now(),
+		Actor:   claim.GetActor(),
+		Subject: claim.GetSubject(),
+		IP:      c.ClientIP(),
+		Method:  c.Request.Method,
+		Path:    c.Request.URL.Path,
+		Route:   route,
+		Status:  uint(c.Writer.Status()),
+	})
+}
+
+// initRouter registers the routes of every module, reporting all conflicting ones at once.
+func (ginApp *GinApp) initRouter(r *gin.Engine) {
+	conflicts := []error{}
 	for _, module := range ginApp.ginDomainHandlers {
 		reqDefs := module.GetRequestHandlers()
 		for _, v := range reqDefs {
-			ginApp.router.Register(v, module.GetBaseURL())
+			if err := ginApp.router.Register(v, moduleBaseURL(module)); err != nil {
+				conflicts = append(conflicts, err)
+			}
 		}
 	}
+	if len(conflicts) != 0 {
+		panic("conflicting routes are detected:\n" + errors.Join(conflicts...).Error())
+	}
+	r.Use(ginApp.RouteHandler)
+	r.Use(ginApp.TimeoutHandler)
+}
+
+// RouteHandler matches the request to a registered route once for the middlewares after it, and
+// marks the routes of a deprecated version.
+func (ginApp *GinApp) RouteHandler(c *gin.Context) {
+	match := ginApp.matchRoute(c)
+	c.Set(routeKey, match)
+	if version, ok := ginApp.routeVersion(match.Template); ok {
+		setDeprecation(c, version)
+	}
+}
+
+func (ginApp *GinApp) matchRoute(c *gin.Context) RouteMatch {
+	if match, ok := c.Get(routeKey); ok {
+		return match.(RouteMatch)
+	}
+	path := c.Request.URL.Path
+	if path == BaseApiURL || strings.HasPrefix(path, BaseApiURL+"/") {
+		path = strings.TrimPrefix(path, BaseApiURL)
+	}
+	match, _ := ginApp.router.Match(path)
+	return match
 }
 
 func (ginApp *GinApp) initAuthorization(r *gin.Engine) {
@@ -335,10 +588,11 @@ func ToGinHandler(act httpapi.Action) gin.HandlerFunc {
 }
 
 func (ginApp *GinApp) initDomainHandlers(r *gin.Engine) {
+	options := map[string]bool{}
 	for _, domainHandler := range ginApp.ginDomainHandlers {
 
 		reqData := domainHandler.GetRequestHandlers()
-		baseURL := domainHandler.GetBaseURL()
+		baseURL := moduleBaseURL(domainHandler)
 
 		for _, v := range reqData {
 
@@ -347,17 +601,20 @@ func (ginApp *GinApp) initDomainHandlers(r *gin.Engine) {
 			}
 			hnd := ToGinHandler(v.Handler)
 
-			if v.AnyPermissions != nil {
+			if v.AnyPermissions != nil || v.AllPermissions != nil || v.Ownership != nil {
 				for key := range v.AnyPermissions {
 					ginApp.PermissionManager.SetPermission(v.Method, baseURL+v.Route, v.AnyPermissions[key])
 				}
+				for key := range v.AllPermissions {
+					ginApp.PermissionManager.SetAllPermission(v.Method, baseURL+v.Route, v.AllPermissions[key])
+				}
 			} else {
 				ginApp.PermissionManager.SetFreePermission(v.Route, v.Method)
 			}
 
 			group := r.Group(baseURL)
 
-			if chain := ginApp.preHandlers[baseURL]; chain != nil {
+			if chain := ginApp.preHandlers[domainHandler.GetBaseURL()]; chain != nil {
 				var use func(middleware ...gin.HandlerFunc) gin.IRoutes
 				if baseURL == "" {
 					use = r.Use
@@ -382,14 +639,32 @@ func (ginApp *GinApp) initDomainHandlers(r *gin.Engine) {
 				group.DELETE(v.Route, hnd)
 			case http.MethodGet:
 				group.GET(v.Route, hnd)
+				group.HEAD(v.Route, hnd)
 			case http.MethodPut:
 				group.PUT(v.Route, hnd)
+			case http.MethodPatch:
+				group.PATCH(v.Route, hnd)
+			default:
+				panic("unsupported method " + string(v.Method) + " is detected")
+			}
+
+			if !options[baseURL+v.Route] {
+				options[baseURL+v.Route] = true
+				group.OPTIONS(v.Route, ginApp.optionsHandler(baseURL+v.Route))
 			}
 		}
 
 	}
 }
 
+// optionsHandler answers OPTIONS of the route with the methods it allows.
+func (ginApp *GinApp) optionsHandler(route string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header(Allow, strings.Join(ginApp.router.Allowed(route), ", "))
+		c.Status(http.StatusNoContent)
+	}
+}
+
 func toTopicMap(dhds []*httpapi.DuplexHandlerDefinition) (out map[string]*httpapi.DuplexHandlerDefinition) {
 	out = map[string]*httpapi.DuplexHandlerDefinition{}
 	for k, v := range dhds {
@@ -398,7 +673,8 @@ func toTopicMap(dhds []*httpapi.DuplexHandlerDefinition) (out map[string]*httpap
 	return out
 }
 
-func loop(duplexCon *wsmodel.DuplexConnection, topics map[string]*httpapi.DuplexHandlerDefinition) <-chan error {
+// loop serves the messages of the connection, ctx being the context of the request it was upgraded from.
+func loop(ctx context.Context, duplexCon *wsmodel.DuplexConnection, topics map[string]*httpapi.DuplexHandlerDefinition) <-chan error {
 	echan := make(chan error)
 
 	// TODO: must handle may ws features like ping pong , write/read deadline and so on
@@ -440,7 +716,7 @@ func loop(duplexCon *wsmodel.DuplexConnection, topics map[string]*httpapi.Duplex
 				}
 				verifier, ok := dto.(httpapi.Verifier)
 				if ok {
-					if err := verifier.Validate(context.Background()); err != nil {
+					if err := verifier.Validate(ctx); err != nil {
 						_ = duplexCon.SendError(response.ValidationError, err.Error())
 						continue
 					}
@@ -489,7 +765,7 @@ func (ginApp *GinApp) initDuplexHandlers(r *gin.Engine) {
 			case <-time.After(time.Duration(time.Hour * 2)): // TODO: time must be injected with given policy , no connection can persist more than given time
 				_ = duplexCon.SendError(wsmodel.TimeoutError, wsmodel.ConnectionWasForTooLong)
 				duplexCon.Close()
-			case err := <-loop(duplexCon, topicMap):
+			case err := <-loop(c.Request.Context(), duplexCon, topicMap):
 				logger.Trace.Println(err.Error())
 			}
 			logger.Trace.Println("done")
@@ -497,63 +773,118 @@ func (ginApp *GinApp) initDuplexHandlers(r *gin.Engine) {
 	}
 }
 
+// GetRegisteredRoute returns the route template the request was matched to, or its path without the
+// base when it matches no route.
 func GetRegisteredRoute(c *gin.Context, base string) string {
-	url := fmt.Sprintf("%+v", c.Request.URL)
-	url = strings.ReplaceAll(url, base, "")
-	url = strings.ReplaceAll(url, "?"+c.Request.URL.RawQuery, "")
-
-	for _, p := range c.Params {
-		url = strings.Replace(url, p.Value, ":"+p.Key, 1)
+	if match, ok := c.Get(routeKey); ok {
+		return match.(RouteMatch).Template
 	}
-
-	return url
+	return strings.TrimPrefix(c.Request.URL.Path, base)
 }
 
 func (ginApp *GinApp) AuthorizationHandler(c *gin.Context) {
-	route := GetRegisteredRoute(c, BaseApiURL)
-	if ginApp.PermissionManager.IsFree(route, httpapi.HTTPMethod(c.Request.Method)) {
+	match := ginApp.matchRoute(c)
+	route := match.Template
+
+	if ginApp.router.IsFree(route, httpapi.HTTPMethod(c.Request.Method)) {
 		return
 	}
+	authorize, _, _ := ginApp.authorizers.Match(ginApp.unversioned(route))
+	req := NewRequest(c)
 
-	if ginApp.router.IsFree(route, httpapi.HTTPMethod(c.Request.Method)) {
+	auth, _ := req.Get(httpapi.KeyAuth)
+	model, _ := auth.(misc.JwtClaim)
+
+	method := httpapi.HTTPMethod(c.Request.Method)
+	anyPerms := ginApp.PermissionManager.GetPermission(route, method)
+	allPerms := ginApp.PermissionManager.GetAllPermission(route, method)
+	var rule *httpapi.OwnershipRule
+	if definition := ginApp.router.GetRoute(route, method); definition != nil {
+		rule = definition.Ownership
+	}
+
+	// A scoped claim goes no further than its scopes, owning the resource does not widen them
+	scoped, isScoped := model.(misc.ScopedClaim)
+	if isScoped && !scopesAllow(scoped, method, route, anyPerms, allPerms) {
+		req.SetForbidden()
 		return
 	}
-	var authorize httpapi.Authorizer
-	for k, v := range ginApp.authorizers {
-		if strings.HasPrefix(route, k) {
-			authorize = v
-			break
-		}
+	if rule == nil && len(anyPerms) == 0 && len(allPerms) == 0 {
+		return
+	}
+	if authorize == nil && rule == nil {
+		return
 	}
 
-	if authorize == nil {
+	if rule != nil && rule.PathParam != "" && ginApp.isOwner(model, match.Params[rule.PathParam]) {
 		return
 	}
 
-	req := NewRequest(c)
+	if authorize != nil && (len(anyPerms) != 0 || len(allPerms) != 0) {
+		// Permissions outside the scopes of a scoped claim are denied without asking the authorizer
+		asked := []string{}
+		for _, v := range slices.Concat(allPerms, anyPerms) {
+			if slices.Contains(asked, v) || (isScoped && !slices.Contains(scoped.GetScopes(), v)) {
+				continue
+			}
+			asked = append(asked, v)
+		}
 
-	auth, _ := req.Get(httpapi.KeyAuth)
-	model, _ := auth.(misc.JwtClaim)
+		granted := map[string]bool{}
+		if len(asked) != 0 {
+			var err error
+			granted, err = authorize(c.Request.Context(), model.GetSubject(), asked)
+			if err != nil {
+				req.SetServerError(err.Error())
+				return
+			}
+		}
+		if IsPermitted(granted, anyPerms, allPerms) {
+			return
+		}
+	}
 
-	routePerms := ginApp.PermissionManager.GetPermission(route, httpapi.HTTPMethod(c.Request.Method))
+	if rule != nil && rule.ResponseField != "" {
+		ginApp.enforceResponseOwner(c, model, rule.ResponseField)
+		return
+	}
+	req.SetForbidden()
+}
 
-	for _, v := range routePerms {
-		valid, err := authorize(model.GetSubject(), v)
-		if err != nil {
-			req.SetServerError(err.Error())
-			return
+// scopesAllow reports whether the scopes of the claim hold the permissions the route requires, or
+// name the route when it requires none.
+func scopesAllow(claim misc.ScopedClaim, method httpapi.HTTPMethod, route string, anyPerms, allPerms []string) bool {
+	if len(anyPerms) == 0 && len(allPerms) == 0 {
+		if method == http.MethodHead {
+			method = http.MethodGet
 		}
-		if !valid {
-			req.SetForbidden()
-			return
+		return slices.Contains(claim.GetScopes(), httpapi.RouteScope(method, route))
+	}
+	scopes := map[string]bool{}
+	for _, v := range claim.GetScopes() {
+		scopes[v] = true
+	}
+	return IsPermitted(scopes, anyPerms, allPerms)
+}
+
+// IsPermitted reports whether the granted permissions hold every one of allPerms and, when anyPerms is
+// not empty, at least one of anyPerms.
+func IsPermitted(granted map[string]bool, anyPerms, allPerms []string) bool {
+	for _, v := range allPerms {
+		if !granted[v] {
+			return false
 		}
 	}
+	if len(anyPerms) == 0 {
+		return true
+	}
+	return slices.ContainsFunc(anyPerms, func(v string) bool { return granted[v] })
 }
 
 func (ginApp *GinApp) AnyReq(c *gin.Context) {
-	route := GetRegisteredRoute(c, BaseApiURL)
+	match := ginApp.matchRoute(c)
 
-	fullRoute := ginApp.router.GetRoute(route, httpapi.HTTPMethod(c.Request.Method))
+	fullRoute := ginApp.router.GetRoute(match.Template, httpapi.HTTPMethod(c.Request.Method))
 
 	req := NewRequest(c)
 	if fullRoute == nil {
@@ -561,7 +892,20 @@ func (ginApp *GinApp) AnyReq(c *gin.Context) {
 	}
 	req.Set(httpapi.MaxLimit, fullRoute.MaxLimit)
 
-	if fullRoute.Dto != nil {
+	if fullRoute.Method == http.MethodPatch {
+		// The dto of a patch route is the patched resource, the handler applies the patch to it
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			req.SetBadRequest(err.Error(), response.UnknownFormat)
+			return
+		}
+		patch, err := ParsePatch(c.ContentType(), body)
+		if err != nil {
+			req.SetBadRequest(err.Error(), response.InvalidPatch)
+			return
+		}
+		req.Set(httpapi.KeyPatch, patch)
+	} else if fullRoute.Dto != nil {
 
 		dtoType := reflect.TypeOf(fullRoute.Dto).Elem()
 		v := reflect.New(dtoType)
@@ -574,7 +918,7 @@ func (ginApp *GinApp) AnyReq(c *gin.Context) {
 
 		verifier, ok := copy.(httpapi.Verifier)
 		if ok {
-			if err := verifier.Validate(context.Background()); err != nil {
+			if err := verifier.Validate(c.Request.Context()); err != nil {
 				req.SetBadRequest(err.Error(), response.ValidationError)
 				return
 			}
@@ -600,7 +944,7 @@ func (ginApp *GinApp) AnyReq(c *gin.Context) {
 		for i := 0; i < s.Len(); i++ {
 			verifier, ok := s.Index(i).Interface().(httpapi.Verifier)
 			if ok {
-				if err := verifier.Validate(context.Background()); err != nil {
+				if err := verifier.Validate(c.Request.Context()); err != nil {
 					req.SetBadRequest(err.Error(), response.ValidationError)
 					return
 				}
@@ -617,7 +961,7 @@ func (ginApp *GinApp) AnyReq(c *gin.Context) {
 		if v.Query {
 			value = c.Query(v.Definition.GetName())
 		} else {
-			value = c.Param(v.Definition.GetName())
+			value = match.Params[v.Definition.GetName()]
 		}
 
 		if value == "" {
@@ -734,7 +1078,7 @@ func (ginApp *GinApp) AnyReq(c *gin.Context) {
 			}
 			verifier, ok := copy.(httpapi.Verifier)
 			if ok {
-				if err := verifier.Validate(context.Background()); err != nil {
+				if err := verifier.Validate(c.Request.Context()); err != nil {
 					req.SetBadRequest(err.Error(), response.ValidationError)
 					return
 				}
@@ -765,7 +1109,7 @@ func (ginApp *GinApp) LogRequests(c *gin.Context) {
 	hLog.Request.Size = CalcRequestSize(c.Request)
 	hLog.Request.IP = c.ClientIP()
 	hLog.Request.Method = c.Request.Method
-	hLog.Request.Route = GetRegisteredRoute(c, BaseApiURL)
+	hLog.Request.Route = ginApp.matchRoute(c).Template
 	hLog.Request.Path = fmt.Sprintf("%+v", c.Request.URL)
 
 	for k, v := range c.Request.Header {
@@ -863,6 +1207,6 @@ func GinBodyLogMiddleware(c *gin.Context) {
 }
 
 func (ginApp *GinApp) TestHandle(recorder *httptest.ResponseRecorder, request *http.Request) error {
-	ginApp.gin.ServeHTTP(recorder, request)
+	ginApp.ServeHTTP(recorder, request)
 	return nil
 }
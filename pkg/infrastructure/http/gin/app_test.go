@@ -27,6 +27,7 @@ import (
 	"github.com/nullexp/finman-api-gateway/pkg/infrastructure/http/protocol/model"
 	mlp "github.com/nullexp/finman-api-gateway/pkg/infrastructure/http/protocol/model/multipart"
 	"github.com/nullexp/finman-api-gateway/pkg/infrastructure/http/protocol/model/openapi"
+	"github.com/nullexp/finman-api-gateway/pkg/infrastructure/http/protocol/response"
 	"github.com/nullexp/finman-api-gateway/pkg/infrastructure/http/protocol/utility"
 	"github.com/nullexp/finman-api-gateway/pkg/infrastructure/log"
 	"github.com/nullexp/finman-api-gateway/pkg/infrastructure/misc"
@@ -116,6 +117,10 @@ func (t TokenInfo) GetIdentity() string {
 	return t.Identity
 }
 
+func (t TokenInfo) GetNotBefore() int64 {
+	return t.NotBefore
+}
+
 func (t TokenInfo) IsExpired() bool {
 	return time.Now().Unix() > t.ExpireTime
 }
@@ -127,6 +132,7 @@ type TokenInfo struct {
 	Audience   []string `json:"aud"` // Apis which can process this token
 	IssuedAt   int64    `json:"iat"` // The time it has been issued
 	Identity   string   `json:"jti"` // Token Identity
+	NotBefore  int64    `json:"nbf"` // The time it becomes valid
 }
 
 type testAuthenticator struct {
@@ -275,7 +281,7 @@ func TestAuthoriation(t *testing.T) {
 	info := TokenInfo{ExpireTime: time.Now().AddDate(1, 0, 0).Unix(), Subject: "1", Identity: uuid.NewString()}
 	auth := NewOkTestAuthenticatorWithToken(info)
 	a.AppendAuthenticator(baseRoute, auth)
-	a.AppendAuthorizer(baseRoute, func(identity string, permission string) (bool, error) {
+	a.AppendAuthorizer(baseRoute, func(_ context.Context, identity string, permission string) (bool, error) {
 		return true, nil
 	})
 
@@ -307,7 +313,7 @@ func TestAuthoriation(t *testing.T) {
 	info = TokenInfo{ExpireTime: time.Now().AddDate(1, 0, 0).Unix(), Subject: "1", Identity: uuid.NewString()}
 	auth = NewOkTestAuthenticatorWithToken(info)
 	a.AppendAuthenticator(failbaseRoute, auth)
-	a.AppendAuthorizer(failbaseRoute, func(identity string, permission string) (bool, error) {
+	a.AppendAuthorizer(failbaseRoute, func(_ context.Context, identity string, permission string) (bool, error) {
 		return false, nil
 	})
 
@@ -344,6 +350,692 @@ func TestAuthoriation(t *testing.T) {
 	})
 }
 
+func TestLongestPrefixAuth(t *testing.T) {
+	app := NewGinApp()
+	var a protocol.Api = app
+
+	handle := func(req protocol.Request) {
+		req.ReturnStatus(http.StatusNoContent, nil)
+	}
+	a.AppendModule(NewTestModule("/users", &protocol.RequestDefinition{Route: "", Method: http.MethodGet, AnyPermissions: []string{"Read"}, Handler: handle}))
+	a.AppendModule(NewTestModule("/admin", &protocol.RequestDefinition{Route: "", Method: http.MethodGet, AnyPermissions: []string{"Read"}, Handler: handle}))
+	a.AppendModule(NewTestModule("/administrators", &protocol.RequestDefinition{Route: "", Method: http.MethodGet, AnyPermissions: []string{"Read"}, Handler: handle}))
+	a.AppendModule(NewTestModule("/public", &protocol.RequestDefinition{Route: "", Method: http.MethodGet, AnyPermissions: []string{"Read"}, Handler: handle}))
+	a.AppendModule(NewTestModule("/login", &protocol.RequestDefinition{Route: "", Method: http.MethodPost, FreeRoute: true, Handler: handle}))
+
+	info := TokenInfo{ExpireTime: time.Now().Add(time.Hour).Unix(), Subject: "1", Identity: uuid.NewString()}
+	grant := func(granted bool) protocol.BatchAuthorizer {
+		return func(_ context.Context, identity string, permissions []string) (map[string]bool, error) {
+			out := map[string]bool{}
+			for _, v := range permissions {
+				out[v] = granted
+			}
+			return out, nil
+		}
+	}
+	a.AppendAuthenticator("/", NewOkTestAuthenticatorWithToken(info))
+	a.AppendBatchAuthorizer("/", grant(true))
+	a.AppendSchemeAuthenticator("/admin", ApiKey, NewOkTestAuthenticatorWithToken(info))
+	a.AppendBatchAuthorizer("/admin", grant(false))
+	a.DisableAuth("/public")
+	app.Init(gin.TestMode)
+
+	send := func(route, authorization string) int {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, route, nil)
+		if authorization != "" {
+			req.Header.Add(Authorization, authorization)
+		}
+		_ = app.TestHandle(w, req)
+		return w.Code
+	}
+
+	t.Run("Expect the longest base url to win", func(t *testing.T) {
+		for i := 0; i < 10; i++ {
+			assert.Equal(t, http.StatusNoContent, send("/users", "Bearer token"))
+			assert.Equal(t, http.StatusUnauthorized, send("/admin", "Bearer token"))
+			assert.Equal(t, http.StatusForbidden, send("/admin", "ApiKey key"))
+		}
+	})
+
+	t.Run("Expect base urls to match whole segments", func(t *testing.T) {
+		assert.Equal(t, http.StatusNoContent, send("/administrators", "Bearer token"))
+	})
+
+	t.Run("Expect disabled auth to let anyone in", func(t *testing.T) {
+		assert.Equal(t, http.StatusNoContent, send("/public", ""))
+	})
+
+	t.Run("Expect report to name what each route resolves to", func(t *testing.T) {
+		report := []string{}
+		for _, v := range app.GetAuthReport() {
+			report = append(report, v.String())
+		}
+		assert.Equal(t, []string{
+			"GET /admin: authenticated by /admin (ApiKey), authorized by /admin",
+			"GET /administrators: authenticated by / (Bearer), authorized by /",
+			"POST /login is free",
+			"GET /public: no authentication, disabled at /public, no authorization, disabled at /public",
+			"GET /users: authenticated by / (Bearer), authorized by /",
+		}, report)
+	})
+}
+
+func TestReenabledAuth(t *testing.T) {
+	app := NewGinApp()
+	var a protocol.Api = app
+
+	a.AppendModule(NewTestModule("/public", &protocol.RequestDefinition{Route: "", Method: http.MethodGet, AnyPermissions: []string{"Read"}, Handler: func(req protocol.Request) {
+		req.ReturnStatus(http.StatusNoContent, nil)
+	}}))
+	info := TokenInfo{ExpireTime: time.Now().Add(time.Hour).Unix(), Subject: "1", Identity: uuid.NewString()}
+	a.AppendAuthenticator("/", NewOkTestAuthenticatorWithToken(info))
+	a.AppendAuthorizer("/", func(_ context.Context, identity string, permission string) (bool, error) { return false, nil })
+	a.DisableAuth("/public")
+	a.AppendAuthenticator("/public", NewOkTestAuthenticatorWithToken(info))
+	app.Init(gin.TestMode)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/public", nil)
+	req.Header.Add(Authorization, "Bearer token")
+	_ = app.TestHandle(w, req)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Equal(t, "GET /public: authenticated by /public (Bearer), authorized by /", app.GetAuthReport()[0].String())
+}
+
+func TestPermissionSemantics(t *testing.T) {
+	app := NewGinApp()
+	var a protocol.Api = app
+
+	baseRoute := "/test"
+	handle := func(req protocol.Request) {
+		req.ReturnStatus(http.StatusNoContent, nil)
+	}
+	a.AppendModule(NewTestModule(baseRoute,
+		&protocol.RequestDefinition{Route: "/any", Method: http.MethodGet, AnyPermissions: []string{"Read", "Write"}, Handler: handle},
+		&protocol.RequestDefinition{Route: "/any-denied", Method: http.MethodGet, AnyPermissions: []string{"Write", "Delete"}, Handler: handle},
+		&protocol.RequestDefinition{Route: "/all", Method: http.MethodGet, AllPermissions: []string{"Read", "Write"}, Handler: handle},
+		&protocol.RequestDefinition{Route: "/all-granted", Method: http.MethodGet, AllPermissions: []string{"Read", "List"}, Handler: handle},
+		&protocol.RequestDefinition{Route: "/both", Method: http.MethodGet, AllPermissions: []string{"Read"}, AnyPermissions: []string{"Read", "Write"}, Handler: handle},
+		&protocol.RequestDefinition{Route: "/both-denied", Method: http.MethodGet, AllPermissions: []string{"Write"}, AnyPermissions: []string{"Read"}, Handler: handle},
+	))
+	info := TokenInfo{ExpireTime: time.Now().Add(time.Hour).Unix(), Subject: "1", Identity: uuid.NewString()}
+	a.AppendAuthenticator(baseRoute, NewOkTestAuthenticatorWithToken(info))
+	calls := [][]string{}
+	a.AppendBatchAuthorizer(baseRoute, func(_ context.Context, identity string, permissions []string) (map[string]bool, error) {
+		calls = append(calls, permissions)
+		out := map[string]bool{}
+		for _, v := range permissions {
+			out[v] = v == "Read" || v == "List"
+		}
+		return out, nil
+	})
+	app.Init(gin.TestMode)
+
+	send := func(route string) int {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, baseRoute+route, nil)
+		req.Header.Add(Authorization, "Bearer somerandomText")
+		_ = app.TestHandle(w, req)
+		return w.Code
+	}
+
+	t.Run("Expect any of to need a single granted permission", func(t *testing.T) {
+		assert.Equal(t, http.StatusNoContent, send("/any"))
+		assert.Equal(t, http.StatusForbidden, send("/any-denied"))
+	})
+
+	t.Run("Expect all of to need every permission", func(t *testing.T) {
+		assert.Equal(t, http.StatusForbidden, send("/all"))
+		assert.Equal(t, http.StatusNoContent, send("/all-granted"))
+	})
+
+	t.Run("Expect both to be combined with and", func(t *testing.T) {
+		assert.Equal(t, http.StatusNoContent, send("/both"))
+		assert.Equal(t, http.StatusForbidden, send("/both-denied"))
+	})
+
+	t.Run("Expect one batched call per request without repeated permissions", func(t *testing.T) {
+		calls = calls[:0]
+		send("/both")
+		assert.Equal(t, [][]string{{"Read", "Write"}}, calls)
+	})
+}
+
+func TestOwnership(t *testing.T) {
+	app := NewGinApp()
+	var a protocol.Api = app
+
+	baseRoute := "/test"
+	owned := func(req protocol.Request) {
+		req.Negotiate(http.StatusOK, nil, map[string]any{"item": map[string]any{"userId": req.MustGet("id")}})
+	}
+	idParam := []protocol.RequestParameter{{Definition: misc.NewQueryDefinition("id", []misc.QueryOperator{misc.QueryOperatorEqual}, misc.DataTypeString)}}
+	a.AppendModule(NewTestModule(baseRoute,
+		&protocol.RequestDefinition{Route: "/path/:id", Method: http.MethodGet, Parameters: idParam, AnyPermissions: []string{"Manage"}, Ownership: &protocol.OwnershipRule{PathParam: "id"}, Handler: owned},
+		&protocol.RequestDefinition{Route: "/body/:id", Method: http.MethodGet, Parameters: idParam, Ownership: &protocol.OwnershipRule{ResponseField: "item.userId"}, Handler: owned},
+		&protocol.RequestDefinition{Route: "/missing", Method: http.MethodGet, Ownership: &protocol.OwnershipRule{ResponseField: "item.userId"}, Handler: func(req protocol.Request) {
+			req.SetBadRequest("missing", response.UnknownFormat)
+		}},
+	))
+	unauthorizedRoute := "/unauthorized"
+	a.AppendModule(NewTestModule(unauthorizedRoute,
+		&protocol.RequestDefinition{Route: "/path/:id", Method: http.MethodGet, Parameters: idParam, Ownership: &protocol.OwnershipRule{PathParam: "id"}, Handler: owned},
+		&protocol.RequestDefinition{Route: "/body/:id", Method: http.MethodGet, Parameters: idParam, Ownership: &protocol.OwnershipRule{ResponseField: "item.userId"}, Handler: owned},
+	))
+	info := TokenInfo{ExpireTime: time.Now().Add(time.Hour).Unix(), Subject: "1", Identity: uuid.NewString()}
+	scopes := []string{}
+	for _, base := range []string{baseRoute, unauthorizedRoute} {
+		a.AppendAuthenticator(base, NewOkTestAuthenticatorWithToken(info))
+		a.AppendSchemeAuthenticator(base, ApiKey, NewTestAuthenticator(func(token string) (misc.JwtClaim, error) {
+			return scopedTokenInfo{TokenInfo: info, Scopes: scopes}, nil
+		}, func(token string) (bool, error) { return true, nil }))
+	}
+	manager := false
+	a.AppendBatchAuthorizer(baseRoute, func(_ context.Context, identity string, permissions []string) (map[string]bool, error) {
+		out := map[string]bool{}
+		for _, v := range permissions {
+			out[v] = manager
+		}
+		return out, nil
+	})
+	a.SetOwnerResolver(func(claim misc.JwtClaim) (string, error) { return "user-" + claim.GetSubject(), nil })
+	app.Init(gin.TestMode)
+
+	sendAs := func(route, token string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, route, nil)
+		req.Header.Add(Authorization, token)
+		_ = app.TestHandle(w, req)
+		return w
+	}
+	send := func(route string) *httptest.ResponseRecorder {
+		return sendAs(baseRoute+route, "Bearer somerandomText")
+	}
+
+	t.Run("Expect owner of path param to need no permission", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, send("/path/user-1").Code)
+		assert.Equal(t, http.StatusForbidden, send("/path/user-2").Code)
+	})
+
+	t.Run("Expect owner of response field to get the response", func(t *testing.T) {
+		w := send("/body/user-1")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), "user-1")
+
+		w = send("/body/user-2")
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.NotContains(t, w.Body.String(), "user-2")
+	})
+
+	t.Run("Expect failed responses to pass through", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, send("/missing").Code)
+	})
+
+	t.Run("Expect permissions to let others in", func(t *testing.T) {
+		manager = true
+		defer func() { manager = false }()
+		assert.Equal(t, http.StatusOK, send("/path/user-2").Code)
+	})
+
+	t.Run("Expect scoped token to own only within its scopes", func(t *testing.T) {
+		assert.Equal(t, http.StatusForbidden, sendAs(baseRoute+"/path/user-1", "ApiKey key").Code)
+		scopes = []string{"Manage"}
+		defer func() { scopes = []string{} }()
+		assert.Equal(t, http.StatusOK, sendAs(baseRoute+"/path/user-1", "ApiKey key").Code)
+		assert.Equal(t, http.StatusForbidden, sendAs(baseRoute+"/path/user-2", "ApiKey key").Code)
+	})
+
+	t.Run("Expect only the owner in when no authorizer decides the rule", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, sendAs(unauthorizedRoute+"/path/user-1", "Bearer somerandomText").Code)
+		assert.Equal(t, http.StatusForbidden, sendAs(unauthorizedRoute+"/path/user-2", "Bearer somerandomText").Code)
+		assert.Equal(t, http.StatusOK, sendAs(unauthorizedRoute+"/body/user-1", "Bearer somerandomText").Code)
+		assert.Equal(t, http.StatusForbidden, sendAs(unauthorizedRoute+"/body/user-2", "Bearer somerandomText").Code)
+	})
+}
+
+func TestRouteTemplate(t *testing.T) {
+	app := NewGinApp()
+	var a protocol.Api = app
+
+	baseRoute := "/test"
+	echo := func(req protocol.Request) {
+		req.Negotiate(http.StatusOK, nil, map[string]any{"id": req.MustGet("id")})
+	}
+	idParam := []protocol.RequestParameter{{Definition: misc.NewQueryDefinition("id", []misc.QueryOperator{misc.QueryOperatorEqual}, misc.DataTypeString)}}
+	a.AppendModule(NewTestModule(baseRoute,
+		&protocol.RequestDefinition{Route: "/:id", Method: http.MethodGet, Parameters: idParam, AnyPermissions: []string{"Manage"}, Handler: echo},
+		&protocol.RequestDefinition{Route: "/user/:id", Method: http.MethodGet, Parameters: idParam, Ownership: &protocol.OwnershipRule{PathParam: "id"}, Handler: echo},
+	))
+	info := TokenInfo{ExpireTime: time.Now().Add(time.Hour).Unix(), Subject: "user", Identity: uuid.NewString()}
+	a.AppendAuthenticator(baseRoute, NewOkTestAuthenticatorWithToken(info))
+	a.AppendBatchAuthorizer(baseRoute, func(_ context.Context, identity string, permissions []string) (map[string]bool, error) {
+		return map[string]bool{}, nil
+	})
+	app.Init(gin.TestMode)
+
+	send := func(route string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, baseRoute+route, nil)
+		req.Header.Add(Authorization, "Bearer somerandomText")
+		_ = app.TestHandle(w, req)
+		return w
+	}
+
+	t.Run("Expect a param equal to a literal segment to keep its route", func(t *testing.T) {
+		w := send("/user/user")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"id": "user"}`, w.Body.String())
+	})
+
+	t.Run("Expect a literal segment taken as a param to keep its route", func(t *testing.T) {
+		assert.Equal(t, http.StatusForbidden, send("/user").Code)
+	})
+}
+
+func TestRouteConflictsAtInit(t *testing.T) {
+	app := NewGinApp()
+	handler := func(req protocol.Request) {}
+	app.AppendModule(NewTestModule("/test",
+		&protocol.RequestDefinition{Route: "/:id", Method: http.MethodGet, Handler: handler},
+		&protocol.RequestDefinition{Route: "/:userId/items", Method: http.MethodGet, Handler: handler},
+		&protocol.RequestDefinition{Route: "/:id", Method: http.MethodGet, Handler: handler},
+	))
+	defer func() {
+		err := recover()
+		assert.Contains(t, err, "/test/:userId/items conflicts with /test/:id")
+		assert.Contains(t, err, "GET /test/:id is registered twice")
+	}()
+	app.Init(gin.TestMode)
+}
+
+func TestResponseField(t *testing.T) {
+	body := []byte(`{"transaction":{"userId":"a","amount":12,"tags":["x"]}}`)
+	assert.Equal(t, "a", ResponseField(body, "transaction.userId"))
+	assert.Equal(t, "12", ResponseField(body, "transaction.amount"))
+	assert.Equal(t, "", ResponseField(body, "transaction.tags"))
+	assert.Equal(t, "", ResponseField(body, "transaction.userId.id"))
+	assert.Equal(t, "", ResponseField(body, "user.id"))
+	assert.Equal(t, "", ResponseField([]byte("not json"), "user.id"))
+}
+
+func TestPermissionCatalog(t *testing.T) {
+	app := NewGinApp()
+	var a protocol.Api = app
+
+	handle := func(req protocol.Request) {
+		req.ReturnStatus(http.StatusNoContent, nil)
+	}
+	a.AppendModule(NewTestModule("/test",
+		&protocol.RequestDefinition{Route: "", Method: http.MethodGet, AnyPermissions: []string{"Read", "Write"}, Handler: handle},
+		&protocol.RequestDefinition{Route: "", Method: http.MethodPost, AllPermissions: []string{"Write"}, Handler: handle},
+		&protocol.RequestDefinition{Route: "/free", Method: http.MethodGet, FreeRoute: true, Handler: handle},
+	))
+	app.Init(gin.TestMode)
+	app.PermissionManager.SetPolicy(map[protocol.HTTPMethod]map[string]PolicyRule{
+		http.MethodPost: {"/test": {All: []string{"Audit"}}},
+	})
+
+	assert.Equal(t, []model.PermissionCatalogEntry{
+		{Permission: "Audit", Routes: []model.PermissionRoute{{Method: http.MethodPost, Route: "/test", Requirement: model.RequireAll}}},
+		{Permission: "Read", Routes: []model.PermissionRoute{{Method: http.MethodGet, Route: "/test", Requirement: model.RequireAny}}},
+		{Permission: "Write", Routes: []model.PermissionRoute{
+			{Method: http.MethodGet, Route: "/test", Requirement: model.RequireAny},
+			{Method: http.MethodPost, Route: "/test", Requirement: model.RequireAll},
+		}},
+	}, a.GetPermissionCatalog())
+}
+
+func TestHttpMethods(t *testing.T) {
+	app := NewGinApp()
+	var a protocol.Api = app
+
+	baseRoute := "/test"
+	a.AppendModule(NewTestModule(baseRoute,
+		&protocol.RequestDefinition{Route: "/item", Method: http.MethodGet, Handler: func(req protocol.Request) {
+			req.Negotiate(http.StatusOK, nil, map[string]string{"name": "n"})
+		}},
+		&protocol.RequestDefinition{Route: "/item", Method: http.MethodPatch, Dto: &patchedDto{}, Handler: func(req protocol.Request) {
+			dto := &patchedDto{Name: "n"}
+			if err := req.MustGetPatch().Apply(req.Context(), dto); err != nil {
+				req.SetBadRequest(err.Error(), response.InvalidPatch)
+				return
+			}
+			req.Negotiate(http.StatusOK, nil, dto)
+		}},
+		&protocol.RequestDefinition{Route: "/item", Method: http.MethodDelete, Handler: func(req protocol.Request) {
+			req.ReturnStatus(http.StatusNoContent, nil)
+		}},
+		&protocol.RequestDefinition{Route: "/secret", Method: http.MethodGet, AnyPermissions: []string{"Read"}, Handler: func(req protocol.Request) {
+			req.Negotiate(http.StatusOK, nil, map[string]string{"name": "n"})
+		}},
+	))
+	info := TokenInfo{ExpireTime: time.Now().Add(time.Hour).Unix(), Subject: "1", Identity: uuid.NewString()}
+	a.AppendAuthenticator(baseRoute, NewOkTestAuthenticatorWithToken(info))
+	a.AppendBatchAuthorizer(baseRoute, func(_ context.Context, identity string, permissions []string) (map[string]bool, error) {
+		return map[string]bool{}, nil
+	})
+	app.Init(gin.TestMode)
+
+	send := func(method, route, contentType, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, baseRoute+route, strings.NewReader(body))
+		req.Header.Add(Authorization, "Bearer somerandomText")
+		if contentType != "" {
+			req.Header.Add("Content-Type", contentType)
+		}
+		_ = app.TestHandle(w, req)
+		return w
+	}
+
+	t.Run("Expect head to answer like get without a body", func(t *testing.T) {
+		w := send(http.MethodHead, "/item", "", "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Empty(t, w.Body.String())
+		assert.Equal(t, http.StatusForbidden, send(http.MethodHead, "/secret", "", "").Code)
+	})
+
+	t.Run("Expect options to list the allowed methods", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodOptions, baseRoute+"/item", nil)
+		_ = app.TestHandle(w, req)
+		assert.Equal(t, http.StatusNoContent, w.Code)
+		assert.Equal(t, "GET, HEAD, PATCH, DELETE, OPTIONS", w.Header().Get(Allow))
+	})
+
+	t.Run("Expect patch to take merge and json patches", func(t *testing.T) {
+		w := send(http.MethodPatch, "/item", MergePatchContentType, `{"age": 3}`)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"age":3`)
+
+		w = send(http.MethodPatch, "/item", JsonPatchContentType, `[{"op": "replace", "path": "/name", "value": "m"}]`)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"name":"m"`)
+
+		w = send(http.MethodPatch, "/item", "text/plain", `name=m`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), response.InvalidPatch)
+	})
+}
+
+func TestIsPermitted(t *testing.T) {
+	granted := map[string]bool{"A": true, "B": false}
+	assert.True(t, IsPermitted(granted, nil, nil))
+	assert.True(t, IsPermitted(granted, []string{"A", "B"}, nil))
+	assert.False(t, IsPermitted(granted, []string{"B", "C"}, nil))
+	assert.False(t, IsPermitted(granted, nil, []string{"A", "B"}))
+	assert.True(t, IsPermitted(granted, []string{"B", "A"}, []string{"A"}))
+	assert.False(t, IsPermitted(granted, []string{"A"}, []string{"C"}))
+}
+
+type testRevocationList struct {
+	revoked map[string]bool
+}
+
+func (l *testRevocationList) Revoke(identity string, _ int64) error {
+	l.revoked[identity] = true
+	return nil
+}
+
+func (l *testRevocationList) IsRevoked(claim misc.JwtClaim) (bool, error) {
+	return l.revoked[claim.GetIdentity()], nil
+}
+
+func TestRevocation(t *testing.T) {
+	app := NewGinApp()
+	var a protocol.Api = app
+
+	baseRoute := "/test"
+	var smodule protocol.Module = NewTestModule(baseRoute, &protocol.RequestDefinition{
+		Route:  "/data",
+		Method: http.MethodGet,
+		Handler: func(req protocol.Request) {
+			req.ReturnStatus(http.StatusNoContent, nil)
+		},
+	})
+	a.AppendModule(smodule)
+	info := TokenInfo{ExpireTime: time.Now().AddDate(1, 0, 0).Unix(), Subject: "1", Identity: uuid.NewString()}
+	a.AppendAuthenticator(baseRoute, NewOkTestAuthenticatorWithToken(info))
+	list := &testRevocationList{revoked: map[string]bool{}}
+	a.SetRevocationList(list)
+
+	app.Init(gin.TestMode)
+
+	t.Run("Expect token to be accepted before revocation", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, baseRoute+"/data", nil)
+		req.Header.Add("Authorization", "Bearer somerandomText")
+		_ = app.TestHandle(w, req)
+		assert.Equal(t, http.StatusNoContent, w.Code)
+	})
+
+	t.Run("Expect revoked token to be rejected", func(t *testing.T) {
+		_ = list.Revoke(info.Identity, info.ExpireTime)
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, baseRoute+"/data", nil)
+		req.Header.Add("Authorization", "Bearer somerandomText")
+		_ = app.TestHandle(w, req)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Contains(t, w.Body.String(), "SessionRevoked")
+	})
+}
+
+func TestClaimsPolicy(t *testing.T) {
+	now := time.Now()
+	valid := TokenInfo{ExpireTime: now.Add(time.Hour).Unix(), IssuedAt: now.Unix(), Issuer: "gateway", Audience: []string{"finman"}}
+
+	cases := []struct {
+		name   string
+		mutate func(*TokenInfo)
+		status int
+		code   string
+	}{
+		{"Expect valid token to be accepted", func(*TokenInfo) {}, http.StatusNoContent, ""},
+		{"Expect expired token within leeway to be accepted", func(ti *TokenInfo) { ti.ExpireTime = now.Add(-10 * time.Second).Unix() }, http.StatusNoContent, ""},
+		{"Expect expired token to be rejected", func(ti *TokenInfo) { ti.ExpireTime = now.Add(-time.Minute).Unix() }, http.StatusUnauthorized, response.SessionExpired},
+		{"Expect future nbf to be rejected", func(ti *TokenInfo) { ti.NotBefore = now.Add(time.Minute).Unix() }, http.StatusUnauthorized, response.TokenNotYetValid},
+		{"Expect future iat to be rejected", func(ti *TokenInfo) { ti.IssuedAt = now.Add(time.Minute).Unix() }, http.StatusUnauthorized, response.TokenIssuedInFuture},
+		{"Expect unknown issuer to be rejected", func(ti *TokenInfo) { ti.Issuer = "other" }, http.StatusUnauthorized, response.InvalidIssuer},
+		{"Expect other audience to be rejected", func(ti *TokenInfo) { ti.Audience = []string{"other"} }, http.StatusUnauthorized, response.InvalidAudience},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			app := NewGinApp()
+			var a protocol.Api = app
+
+			baseRoute := "/test"
+			a.AppendModule(NewTestModule(baseRoute, &protocol.RequestDefinition{
+				Route:  "/data",
+				Method: http.MethodGet,
+				Handler: func(req protocol.Request) {
+					req.ReturnStatus(http.StatusNoContent, nil)
+				},
+			}))
+			info := valid
+			c.mutate(&info)
+			a.AppendAuthenticator(baseRoute, NewOkTestAuthenticatorWithToken(info))
+			a.SetClaimsPolicy(misc.ClaimsPolicy{Issuers: []string{"gateway"}, Audiences: []string{"finman"}, Leeway: 30 * time.Second})
+			app.Init(gin.TestMode)
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodGet, baseRoute+"/data", nil)
+			req.Header.Add("Authorization", "Bearer somerandomText")
+			_ = app.TestHandle(w, req)
+			assert.Equal(t, c.status, w.Code)
+			assert.Contains(t, w.Body.String(), c.code)
+		})
+	}
+}
+
+type scopedTokenInfo struct {
+	TokenInfo
+	Scopes []string
+}
+
+func (t scopedTokenInfo) GetScopes() []string {
+	return t.Scopes
+}
+
+func TestSchemeAuthentication(t *testing.T) {
+	app := NewGinApp()
+	var a protocol.Api = app
+
+	baseRoute := "/test"
+	a.AppendModule(NewTestModule(baseRoute, &protocol.RequestDefinition{
+		Route:          "/read",
+		Method:         http.MethodGet,
+		AnyPermissions: []string{"Read"},
+		Handler: func(req protocol.Request) {
+			req.ReturnStatus(http.StatusNoContent, nil)
+		},
+	}, &protocol.RequestDefinition{
+		Route:          "/write",
+		Method:         http.MethodGet,
+		AnyPermissions: []string{"Write"},
+		Handler: func(req protocol.Request) {
+			req.ReturnStatus(http.StatusNoContent, nil)
+		},
+	}, &protocol.RequestDefinition{
+		Route:  "/me",
+		Method: http.MethodGet,
+		Handler: func(req protocol.Request) {
+			req.ReturnStatus(http.StatusNoContent, nil)
+		},
+	}, &protocol.RequestDefinition{
+		Route:  "/other",
+		Method: http.MethodGet,
+		Handler: func(req protocol.Request) {
+			req.ReturnStatus(http.StatusNoContent, nil)
+		},
+	}))
+	// a module without base URL registers its routes by their full path
+	a.AppendModule(NewTestModule("", &protocol.RequestDefinition{
+		Route:  baseRoute + "/unbased",
+		Method: http.MethodGet,
+		Handler: func(req protocol.Request) {
+			req.ReturnStatus(http.StatusNoContent, nil)
+		},
+	}))
+	expire := time.Now().Add(time.Hour).Unix()
+	a.AppendAuthenticator(baseRoute, NewTestAuthenticator(func(token string) (misc.JwtClaim, error) {
+		return TokenInfo{ExpireTime: expire}, nil
+	}, func(token string) (bool, error) { return token == "jwt", nil }))
+	a.AppendSchemeAuthenticator(baseRoute, ApiKey, NewTestAuthenticator(func(token string) (misc.JwtClaim, error) {
+		return scopedTokenInfo{TokenInfo: TokenInfo{ExpireTime: expire}, Scopes: []string{"Read", protocol.RouteScope(http.MethodGet, baseRoute+"/me")}}, nil
+	}, func(token string) (bool, error) { return token == "key", nil }))
+	a.AppendAuthorizer(baseRoute, func(_ context.Context, identity string, permission string) (bool, error) {
+		return true, nil
+	})
+	app.Init(gin.TestMode)
+
+	send := func(route, header, value string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, baseRoute+route, nil)
+		req.Header.Add(header, value)
+		_ = app.TestHandle(w, req)
+		return w
+	}
+
+	t.Run("Expect bearer token to reach bearer authenticator", func(t *testing.T) {
+		assert.Equal(t, http.StatusNoContent, send("/write", Authorization, "Bearer jwt").Code)
+		assert.Equal(t, http.StatusUnauthorized, send("/write", Authorization, "Bearer key").Code)
+	})
+
+	t.Run("Expect api key to reach api key authenticator", func(t *testing.T) {
+		assert.Equal(t, http.StatusNoContent, send("/read", Authorization, "ApiKey key").Code)
+		assert.Equal(t, http.StatusNoContent, send("/read", ApiKeyHeader, "key").Code)
+		assert.Equal(t, http.StatusUnauthorized, send("/read", ApiKeyHeader, "jwt").Code)
+	})
+
+	t.Run("Expect unknown scheme to be rejected", func(t *testing.T) {
+		w := send("/read", Authorization, "Basic key")
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Contains(t, w.Body.String(), response.UnknownFormat)
+	})
+
+	t.Run("Expect permission outside of scopes to be forbidden", func(t *testing.T) {
+		assert.Equal(t, http.StatusForbidden, send("/write", ApiKeyHeader, "key").Code)
+	})
+
+	t.Run("Expect routes without permissions to need a scope naming them", func(t *testing.T) {
+		assert.Equal(t, http.StatusNoContent, send("/me", ApiKeyHeader, "key").Code)
+		assert.Equal(t, http.StatusForbidden, send("/other", ApiKeyHeader, "key").Code)
+		assert.Equal(t, http.StatusForbidden, send("/unbased", ApiKeyHeader, "key").Code)
+		assert.Equal(t, http.StatusNoContent, send("/other", Authorization, "Bearer jwt").Code)
+	})
+}
+
+type actingTokenInfo struct {
+	TokenInfo
+	Actor string
+}
+
+func (t actingTokenInfo) GetActor() string {
+	return t.Actor
+}
+
+type testAuditHandler struct {
+	logs []model.AuditLog
+}
+
+func (h *testAuditHandler) Handle(entry model.AuditLog) {
+	h.logs = append(h.logs, entry)
+}
+
+func TestImpersonation(t *testing.T) {
+	app := NewGinApp()
+	var a protocol.Api = app
+
+	baseRoute := "/test"
+	handle := func(req protocol.Request) {
+		req.ReturnStatus(http.StatusNoContent, nil)
+	}
+	a.AppendModule(NewTestModule(baseRoute,
+		&protocol.RequestDefinition{Route: "/data", Method: http.MethodGet, Handler: handle},
+		&protocol.RequestDefinition{Route: "/data", Method: http.MethodDelete, Handler: handle},
+		&protocol.RequestDefinition{Route: "/session", Method: http.MethodDelete, AllowImpersonation: true, Handler: handle},
+	))
+	expire := time.Now().Add(time.Hour).Unix()
+	a.AppendAuthenticator(baseRoute, NewTestAuthenticator(func(token string) (misc.JwtClaim, error) {
+		info := TokenInfo{ExpireTime: expire, Subject: "user"}
+		if token == "acting" {
+			return actingTokenInfo{TokenInfo: info, Actor: "admin"}, nil
+		}
+		return info, nil
+	}, func(token string) (bool, error) { return true, nil }))
+	audit := &testAuditHandler{}
+	a.SetAuditHandler(audit)
+	app.Init(gin.TestMode)
+
+	send := func(method, route, token string) int {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, baseRoute+route, nil)
+		req.Header.Add(Authorization, BearerSpace+token)
+		_ = app.TestHandle(w, req)
+		return w.Code
+	}
+
+	t.Run("Expect regular token to pass without audit", func(t *testing.T) {
+		assert.Equal(t, http.StatusNoContent, send(http.MethodDelete, "/data", "jwt"))
+		assert.Empty(t, audit.logs)
+	})
+
+	t.Run("Expect impersonation token to only read", func(t *testing.T) {
+		assert.Equal(t, http.StatusNoContent, send(http.MethodGet, "/data", "acting"))
+		assert.Equal(t, http.StatusForbidden, send(http.MethodDelete, "/data", "acting"))
+		assert.Equal(t, http.StatusNoContent, send(http.MethodDelete, "/session", "acting"))
+	})
+
+	t.Run("Expect every impersonated request to be audited", func(t *testing.T) {
+		assert.Len(t, audit.logs, 3)
+		assert.Equal(t, "admin", audit.logs[1].Actor)
+		assert.Equal(t, "user", audit.logs[1].Subject)
+		assert.Equal(t, baseRoute+"/data", audit.logs[1].Route)
+		assert.Equal(t, uint(http.StatusForbidden), audit.logs[1].Status)
+	})
+}
+
 func TestPreHandlers(t *testing.T) {
 	t.Parallel()
 	app := NewGinApp()
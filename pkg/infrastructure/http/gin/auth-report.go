@@ -0,0 +1,78 @@
+package gin
+
+import (
+	"cmp"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	httpapi "github.com/nullexp/finman-api-gateway/pkg/infrastructure/http/protocol"
+)
+
+// RouteAuth tells which authenticators and authorizer a registered route resolves to. They are named
+// by the base URL they were registered for.
+type RouteAuth struct {
+	Method        string
+	Route         string
+	Free          bool
+	Authenticator string   // base URL of the authenticators, empty when no base URL covers the route
+	Schemes       []string // schemes accepted, empty when authentication is disabled or missing
+	Authorizer    string   // base URL of the authorizer, empty when no base URL covers the route
+	Authorized    bool     // false when authorization is disabled or missing
+}
+
+func (r RouteAuth) String() string {
+	if r.Free {
+		return fmt.Sprintf("%s %s is free", r.Method, r.Route)
+	}
+	authentication := "no authentication"
+	if len(r.Schemes) != 0 {
+		authentication = fmt.Sprintf("authenticated by %s (%s)", r.Authenticator, strings.Join(r.Schemes, ", "))
+	} else if r.Authenticator != "" {
+		authentication = "no authentication, disabled at " + r.Authenticator
+	}
+	authorization := "no authorization"
+	if r.Authorized {
+		authorization = "authorized by " + r.Authorizer
+	} else if r.Authorizer != "" {
+		authorization = "no authorization, disabled at " + r.Authorizer
+	}
+	return fmt.Sprintf("%s %s: %s, %s", r.Method, r.Route, authentication, authorization)
+}
+
+// GetAuthReport resolves the authenticators and the authorizer of every registered route, sorted by
+// route and method. The app must be initiated.
+func (ginApp *GinApp) GetAuthReport() []RouteAuth {
+	routes := map[string]map[string]*httpapi.RequestDefinition{
+		http.MethodGet:    ginApp.router.RoutesGetMap,
+		http.MethodPost:   ginApp.router.RoutesPostMap,
+		http.MethodPut:    ginApp.router.RoutesPutMap,
+		http.MethodDelete: ginApp.router.RoutesDeleteMap,
+		http.MethodPatch:  ginApp.router.RoutesPatchMap,
+	}
+
+	out := []RouteAuth{}
+	for method, definitions := range routes {
+		for route, definition := range definitions {
+			entry := RouteAuth{Method: method, Route: route, Free: definition.FreeRoute}
+			if !entry.Free {
+				authenticators, baseURL, _ := ginApp.authenticators.Match(ginApp.unversioned(route))
+				entry.Authenticator = baseURL
+				for scheme := range authenticators {
+					entry.Schemes = append(entry.Schemes, scheme)
+				}
+				slices.Sort(entry.Schemes)
+
+				authorize, baseURL, _ := ginApp.authorizers.Match(ginApp.unversioned(route))
+				entry.Authorizer = baseURL
+				entry.Authorized = authorize != nil
+			}
+			out = append(out, entry)
+		}
+	}
+	slices.SortFunc(out, func(a, b RouteAuth) int {
+		return cmp.Or(cmp.Compare(a.Route, b.Route), cmp.Compare(a.Method, b.Method))
+	})
+	return out
+}
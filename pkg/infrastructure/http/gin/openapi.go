@@ -9,6 +9,7 @@ import (
 	"strconv"
 	"strings"
 
+	errorProtocol "github.com/nullexp/finman-api-gateway/pkg/infrastructure/error/protocol"
 	httpapi "github.com/nullexp/finman-api-gateway/pkg/infrastructure/http/protocol"
 	"github.com/nullexp/finman-api-gateway/pkg/infrastructure/http/protocol/model/openapi"
 	response "github.com/nullexp/finman-api-gateway/pkg/infrastructure/http/protocol/response"
@@ -24,59 +25,68 @@ const (
 	PathCannotHaveTwoSameMethod = "a path cannot have two  similar methods"
 	RepeatedResponseStatus      = "repeated status code for responses has been detected"
 
-	Version                 = "version"
-	OpenApi                 = "openapi"
-	Description             = "description"
-	Summary                 = "summary"
-	OperationId             = "operationId"
-	Title                   = "title"
-	Contact                 = "contact"
-	Info                    = "info"
-	Email                   = "email"
-	Name                    = "name"
-	URL                     = "url"
-	OpenApiVersion          = "3.0.3"
-	ExternalDocs            = "externalDocs"
-	Servers                 = "servers"
-	Tags                    = "tags"
-	Paths                   = "paths"
-	SchemaLocation          = "#/components/schemas/"
-	Content                 = "content"
-	ApplicationJson         = "application/json"
-	MultipartFormData       = "multipart/form-data"
-	Json                    = "json"
-	Scheme                  = "scheme"
-	Schema                  = "schema"
-	Ref                     = "$ref"
-	Type                    = "type"
-	Array                   = "array"
-	Items                   = "items"
-	RequestBody             = "requestBody"
-	Required                = "required"
-	BearerAuth              = "bearerAuth"
-	Responses               = "responses"
-	Security                = "security"
-	In                      = "in"
-	Query                   = "query"
-	Path                    = "path"
-	String                  = "string"
-	Binary                  = "binary"
-	Parameters              = "parameters"
-	Format                  = "format"
-	Example                 = "example"
-	Object                  = "object"
-	Properties              = "properties"
-	SecuritySchemes         = "securitySchemes"
-	HTTP                    = "http"
-	JWT                     = "JWT"
-	SmallBearer             = "bearer"
-	BearerFormat            = "bearerFormat"
-	Components              = "components"
-	Schemas                 = "schemas"
-	Error                   = "Error"
-	ErrorCode               = "ErrorCode"
-	ErrorCodeMessageExample = "Supplied message for developers only"
-	Enum                    = "enum"
+	Version                    = "version"
+	OpenApi                    = "openapi"
+	Description                = "description"
+	Summary                    = "summary"
+	OperationId                = "operationId"
+	Title                      = "title"
+	Contact                    = "contact"
+	Info                       = "info"
+	Email                      = "email"
+	Name                       = "name"
+	URL                        = "url"
+	OpenApiVersion             = "3.0.3"
+	ExternalDocs               = "externalDocs"
+	Servers                    = "servers"
+	Tags                       = "tags"
+	Paths                      = "paths"
+	SchemaLocation             = "#/components/schemas/"
+	Content                    = "content"
+	ApplicationJson            = "application/json"
+	MultipartFormData          = "multipart/form-data"
+	Json                       = "json"
+	Scheme                     = "scheme"
+	Schema                     = "schema"
+	Ref                        = "$ref"
+	Type                       = "type"
+	Array                      = "array"
+	Items                      = "items"
+	RequestBody                = "requestBody"
+	Required                   = "required"
+	Deprecated                 = "deprecated"
+	BearerAuth                 = "bearerAuth"
+	Responses                  = "responses"
+	Security                   = "security"
+	XAnyPermissions            = "x-any-permissions" // the caller needs at least one of them
+	XAllPermissions            = "x-all-permissions" // the caller needs every one of them
+	XOwnership                 = "x-ownership"       // the owner needs none of the permissions
+	In                         = "in"
+	Query                      = "query"
+	Path                       = "path"
+	String                     = "string"
+	Binary                     = "binary"
+	Parameters                 = "parameters"
+	Format                     = "format"
+	Example                    = "example"
+	Object                     = "object"
+	Properties                 = "properties"
+	SecuritySchemes            = "securitySchemes"
+	HTTP                       = "http"
+	JWT                        = "JWT"
+	SmallBearer                = "bearer"
+	BearerFormat               = "bearerFormat"
+	Components                 = "components"
+	Schemas                    = "schemas"
+	Error                      = "Error"
+	ErrorCode                  = "ErrorCode"
+	ErrorCodeMessageExample    = "Supplied message for developers only"
+	ErrorDetail                = "ErrorDetail"
+	ErrorIdDescription         = "Id of the error in the gateway logs, give it to support"
+	ErrorDetailCodeDescription = "Stable code of the failed operation, such as user.USER_ALREADY_EXIST"
+	Problem                    = "Problem"
+	ProblemTypeDescription     = "Urn of the response code, such as " + ProblemTypePrefix + "NotFound"
+	Enum                       = "enum"
 
 	Time                   = "Time"
 	JsonTagSeperator       = ","
@@ -114,18 +124,32 @@ func (ginApp *GinApp) SetErrors(errors []string) {
 	ginApp.Errors = errors
 }
 
+// EnableOpenApi generates the document of the unversioned modules and one document per version, the
+// swagger ui being served at the route.
 func (ginApp *GinApp) EnableOpenApi(route string) (err error) {
 	ginApp.openApiRoute = route
 
-	ginApp.jsonOpenApi, err = ginApp.generateSwaggerAsJson()
+	ginApp.jsonOpenApi, err = ginApp.generateSwaggerAsJson("")
 	if err != nil {
 		return err
 	}
+
+	ginApp.versionedOpenApi = map[string]string{}
+	for _, module := range ginApp.ginDomainHandlers {
+		version, ok := moduleVersion(module)
+		if !ok || ginApp.versionedOpenApi[version.Name] != "" {
+			continue
+		}
+		ginApp.versionedOpenApi[version.Name], err = ginApp.generateSwaggerAsJson(version.Name)
+		if err != nil {
+			return err
+		}
+	}
 	return
 }
 
-func (ginApp *GinApp) generateSwaggerAsJson() (out string, err error) {
-	data, err := ginApp.generateSwagger()
+func (ginApp *GinApp) generateSwaggerAsJson(version string) (out string, err error) {
+	data, err := ginApp.generateSwagger(version)
 	if err != nil {
 		return
 	}
@@ -137,9 +161,18 @@ func (ginApp *GinApp) generateSwaggerAsJson() (out string, err error) {
 	return string(raw), err
 }
 
-func (ginApp *GinApp) generateSwagger() (out map[string]any, err error) {
+// generateSwagger generates the document of the modules of the version, the unversioned ones for an
+// empty version.
+func (ginApp *GinApp) generateSwagger(version string) (out map[string]any, err error) {
 	out = map[string]any{}
 
+	modules := []httpapi.Module{}
+	for _, module := range ginApp.ginDomainHandlers {
+		if v, _ := moduleVersion(module); v.Name == version {
+			modules = append(modules, module)
+		}
+	}
+
 	// Setting open api version
 	out[OpenApi] = OpenApiVersion
 
@@ -147,7 +180,11 @@ func (ginApp *GinApp) generateSwagger() (out map[string]any, err error) {
 	if ginApp.ApiInfo == nil {
 		return nil, ErrApiInfoShouldNotBeEmpty
 	}
-	assignServerInfo(out, *ginApp.ApiInfo)
+	info := *ginApp.ApiInfo
+	if version != "" {
+		info.Version = version
+	}
+	assignServerInfo(out, info)
 
 	// contact is optional
 	if ginApp.Contact != nil {
@@ -169,13 +206,13 @@ func (ginApp *GinApp) generateSwagger() (out map[string]any, err error) {
 		}
 	}
 
-	if len(ginApp.ginDomainHandlers) != 0 {
-		err = assignTags(out, ginApp.ginDomainHandlers)
+	if len(modules) != 0 {
+		err = assignTags(out, modules)
 		if err != nil {
 			return
 		}
 
-		err = assignPaths(out, ginApp.ginDomainHandlers)
+		err = assignPaths(out, modules)
 		if err != nil {
 			return
 		}
@@ -184,7 +221,7 @@ func (ginApp *GinApp) generateSwagger() (out map[string]any, err error) {
 		if len(ginApp.Errors) != 0 {
 			allErrors = append(allErrors, ginApp.Errors...)
 		}
-		err = assignComponents(out, allErrors, ginApp.ginDomainHandlers)
+		err = assignComponents(out, allErrors, modules)
 
 	}
 	return
@@ -229,8 +266,33 @@ func assignDefaultSchemas(schemas map[string]any, errors []string) {
 	schemas[Error] = map[string]any{
 		Type: Object,
 		Properties: map[string]any{
+			"id":      map[string]any{Type: String, Description: ErrorIdDescription},
 			"code":    map[string]any{Ref: SchemaLocation + ErrorCode},
 			"message": map[string]any{Type: String, Description: ErrorCodeMessageExample},
+			"detail":  map[string]any{Ref: SchemaLocation + ErrorDetail},
+		},
+	}
+	schemas[ErrorDetail] = map[string]any{
+		Type: Object,
+		Properties: map[string]any{
+			"id":          map[string]any{Type: String},
+			"errorCode":   map[string]any{Type: String, Description: ErrorDetailCodeDescription},
+			"description": map[string]any{Type: String},
+			"details":     map[string]any{Type: Array, Items: map[string]any{Type: Object}},
+			"type":        map[string]any{Type: String, Enum: []string{string(errorProtocol.ErrorTypeUserOperation), string(errorProtocol.ErrorTypeNotFound), string(errorProtocol.ErrorTypeSystemError)}},
+		},
+	}
+	schemas[Problem] = map[string]any{
+		Type: Object,
+		Properties: map[string]any{
+			"type":     map[string]any{Type: String, Description: ProblemTypeDescription},
+			"title":    map[string]any{Type: String},
+			"status":   map[string]any{Type: "integer"},
+			"detail":   map[string]any{Type: String, Description: ErrorCodeMessageExample},
+			"instance": map[string]any{Type: String},
+			"code":     map[string]any{Ref: SchemaLocation + ErrorCode},
+			"traceId":  map[string]any{Type: String, Description: ErrorIdDescription},
+			"error":    map[string]any{Ref: SchemaLocation + ErrorDetail},
 		},
 	}
 	schemas[ErrorCode] = map[string]any{
@@ -349,8 +411,9 @@ func assignPaths(src map[string]any, modules []httpapi.Module) (err error) {
 	paths := map[string]map[string]any{}
 
 	for _, v := range modules {
+		version, _ := moduleVersion(v)
 		for _, handler := range v.GetRequestHandlers() {
-			route := v.GetBaseURL() + handler.Route
+			route := moduleBaseURL(v) + handler.Route
 			// "/users"   / post , get
 			openapiPath := mapGinParamToOpenApiPath(route)
 			pathMethods, ok := paths[openapiPath]
@@ -369,10 +432,15 @@ func assignPaths(src map[string]any, modules []httpapi.Module) (err error) {
 				err = ErrPathCannotHaveTwoSameMethod
 				return
 			}
-			pathMethods[openapiMethod], err = getMethod(handler, v.GetTag())
+			var method map[string]any
+			method, err = getMethod(handler, v.GetTag())
 			if err != nil {
 				return
 			}
+			if version.IsDeprecated() {
+				method[Deprecated] = true
+			}
+			pathMethods[openapiMethod] = method
 
 		}
 	}
@@ -388,6 +456,9 @@ func getMethod(def *httpapi.RequestDefinition, tag openapi.Tag) (out map[string]
 	out[Description] = def.Description
 	out[Summary] = def.Summary
 	out[OperationId] = def.OperationId
+	if def.Deprecated {
+		out[Deprecated] = true
+	}
 
 	reqbody := getRequestBody(def)
 	if reqbody != nil {
@@ -404,6 +475,15 @@ func getMethod(def *httpapi.RequestDefinition, tag openapi.Tag) (out map[string]
 
 	if !def.FreeRoute {
 		out[Security] = getMethodSecurity()
+		if len(def.AnyPermissions) != 0 {
+			out[XAnyPermissions] = def.AnyPermissions
+		}
+		if len(def.AllPermissions) != 0 {
+			out[XAllPermissions] = def.AllPermissions
+		}
+		if def.Ownership != nil {
+			out[XOwnership] = def.Ownership
+		}
 	}
 
 	if len(def.Parameters) != 0 {
@@ -422,6 +502,14 @@ func getMethod(def *httpapi.RequestDefinition, tag openapi.Tag) (out map[string]
 func getRequestBody(def *httpapi.RequestDefinition) (out map[string]any) {
 	out = map[string]any{}
 	out[Required] = true
+	if def.Dto != nil && def.Method == http.MethodPatch {
+		// A merge patch looks like the resource, a json patch is a list of operations on it
+		out[Content] = map[string]any{
+			MergePatchContentType: map[string]any{Schema: map[string]any{Ref: getDtoComponentLocation(def.Dto, def.Method)}},
+			JsonPatchContentType:  map[string]any{Schema: map[string]any{Type: Array, Items: map[string]any{Type: "object"}}},
+		}
+		return
+	}
 	if def.Dto != nil {
 		location := getDtoComponentLocation(def.Dto, def.Method)
 		out[Content] = getContentWithLocation(location)
@@ -461,6 +549,14 @@ func getContentWithLocation(location string) map[string]any {
 	}
 }
 
+// getErrorContent offers an error both as Error and as Problem, the client choosing by its Accept header.
+func getErrorContent() map[string]any {
+	return map[string]any{
+		ApplicationJson:    map[string]any{Schema: map[string]any{Ref: SchemaLocation + Error}},
+		ProblemContentType: map[string]any{Schema: map[string]any{Ref: SchemaLocation + Problem}},
+	}
+}
+
 func getContentArrayWithLocation(location string) map[string]any {
 	return map[string]any{
 		ApplicationJson: map[string]any{
@@ -477,7 +573,7 @@ func getContentArrayWithLocation(location string) map[string]any {
 func getDefaultBadRequestResponse() (out map[string]any) {
 	out = map[string]any{
 		Description: IfClientErrorOccured,
-		Content:     getContentWithLocation(SchemaLocation + Error),
+		Content:     getErrorContent(),
 	}
 	return
 }
@@ -485,7 +581,7 @@ func getDefaultBadRequestResponse() (out map[string]any) {
 func getDefaultNotFoundResponse() (out map[string]any) {
 	out = map[string]any{
 		Description: IfResousrceWasNotFound,
-		Content:     getContentWithLocation(SchemaLocation + Error),
+		Content:     getErrorContent(),
 	}
 	return
 }
@@ -507,6 +603,9 @@ func getResponseBody(def httpapi.ResponseDefinition) (out map[string]any) {
 	}
 
 	if def.Dto == nil {
+		if def.Status >= http.StatusBadRequest {
+			out[Content] = getErrorContent()
+		}
 		return
 	}
 
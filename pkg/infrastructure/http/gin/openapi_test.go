@@ -77,7 +77,7 @@ func TestGenerateOpenApi(t *testing.T) {
 			Handler: func(req protocol.Request) {},
 		}))
 
-		data, err := app.generateSwagger()
+		data, err := app.generateSwagger("")
 		assert.Nil(t, err)
 		if err != nil {
 			return
@@ -99,6 +99,8 @@ func TestGenerateOpenApi(t *testing.T) {
 
 		security := post[Security].([]map[string]any)
 		assert.EqualValues(t, []string{}, security[0][BearerAuth])
+		assert.EqualValues(t, []string{TestPermission, TestPermission2}, post[XAnyPermissions])
+		assert.Nil(t, post[XAllPermissions])
 
 		tags := post[Tags].([]string)
 		assert.EqualValues(t, name, tags[0])
@@ -108,6 +110,12 @@ func TestGenerateOpenApi(t *testing.T) {
 		statusOk := responses["200"].(map[string]any)
 		assert.EqualValues(t, description, statusOk[Description])
 
+		notFound := responses[FourOFour].(map[string]any)[Content].(map[string]any)
+		assert.Contains(t, notFound, ApplicationJson)
+		assert.Contains(t, notFound, ProblemContentType)
+		schemas := data[Components].(map[string]any)[Schemas].(map[string]any)
+		assert.Contains(t, schemas, Problem)
+
 		params := post[Parameters].([]map[string]any)
 
 		assert.EqualValues(t, Path, params[0][In])
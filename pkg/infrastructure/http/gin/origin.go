@@ -0,0 +1,123 @@
+package gin
+
+import (
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	httpapi "github.com/nullexp/finman-api-gateway/pkg/infrastructure/http/protocol"
+	"github.com/nullexp/finman-api-gateway/pkg/infrastructure/http/protocol/response"
+	"github.com/nullexp/finman-api-gateway/pkg/infrastructure/misc"
+)
+
+const (
+	RequestIdHeader    = "X-Request-Id"
+	IdempotencyKey     = "Idempotency-Key"
+	AcceptLanguage     = "Accept-Language"
+	TraceParent        = "Traceparent"
+	TraceState         = "Tracestate"
+	Cookie             = "Cookie"
+	MaxRequestIdLength = 128
+	// InvalidIdempotencyKey answers a key that is not 1 to MaxRequestIdLength printable ascii characters
+	InvalidIdempotencyKey = "Idempotency-Key must be 1 to 128 printable ascii characters"
+	// requestIdKey holds the request id in the gin context
+	requestIdKey = "RequestId"
+)
+
+// DefaultForwardedHeaders are the inbound headers forwarded to the services unless SetForwardedHeaders
+// says otherwise: the language of the client and the W3C trace context.
+var DefaultForwardedHeaders = []string{AcceptLanguage, TraceParent, TraceState}
+
+// reservedHeaders cannot be forwarded as metadata: gRPC reserves them, they concern the connection to
+// the gateway only, or the gateway sends them itself with the origin of the request.
+var reservedHeaders = []string{
+	"Content-Type", "Te", "User-Agent", "Host",
+	"Connection", "Keep-Alive", "Proxy-Authenticate", "Proxy-Authorization", "Trailer", "Transfer-Encoding", "Upgrade",
+	"X-Subject", "X-Actor", "X-Token-Id", RequestIdHeader, "X-Client-Ip", IdempotencyKey,
+}
+
+// SetForwardedHeaders sets the inbound headers the services get, credentials, reserved and hop-by-hop
+// headers are never forwarded.
+func (ginApp *GinApp) SetForwardedHeaders(headers []string) {
+	forwarded := []string{}
+	for _, v := range headers {
+		v = http.CanonicalHeaderKey(v)
+		if v == Authorization || v == ApiKeyHeader || v == Cookie {
+			panic("header " + v + " carries credentials and cannot be forwarded")
+		}
+		if slices.Contains(reservedHeaders, v) || strings.HasPrefix(v, "Grpc-") || strings.HasPrefix(v, ":") {
+			panic("header " + v + " is reserved or hop-by-hop and cannot be forwarded")
+		}
+		if !slices.Contains(forwarded, v) {
+			forwarded = append(forwarded, v)
+		}
+	}
+	ginApp.forwardedHeaders = forwarded
+}
+
+// SetTrustedProxies sets the ips and CIDRs of the proxies in front of the gateway. The client ip is read
+// from X-Forwarded-For only when the request comes through one of them, otherwise it is the peer address.
+func (ginApp *GinApp) SetTrustedProxies(proxies []string) {
+	for _, v := range proxies {
+		if _, _, err := net.ParseCIDR(v); err != nil && net.ParseIP(v) == nil {
+			panic("trusted proxy " + v + " is not an ip or a CIDR")
+		}
+	}
+	ginApp.trustedProxies = slices.Clone(proxies)
+}
+
+// RequestIdHandler gives the request the id the client sent, or a new one when it sent none or an
+// unusable one, and answers it back in the X-Request-Id header.
+func RequestIdHandler(c *gin.Context) {
+	id := c.GetHeader(RequestIdHeader)
+	if !isRequestId(id) {
+		id = uuid.NewString()
+	}
+	c.Set(requestIdKey, id)
+	c.Header(RequestIdHeader, id)
+}
+
+func isRequestId(id string) bool {
+	if id == "" || len(id) > MaxRequestIdLength {
+		return false
+	}
+	for _, v := range id {
+		// printable ascii only, the id ends up in logs and metadata
+		if v <= ' ' || v > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// OriginHandler puts the origin of the request on its context, for the upstream calls made with it. An
+// Idempotency-Key is held to the rules of the request id, the request is refused otherwise.
+func (ginApp *GinApp) OriginHandler(c *gin.Context) {
+	origin := httpapi.Origin{ClientIP: c.ClientIP(), Headers: http.Header{}}
+	origin.RequestId = c.GetString(requestIdKey)
+	if key, ok := c.Request.Header[IdempotencyKey]; ok {
+		if len(key) != 1 || !isRequestId(key[0]) {
+			NewRequest(c).SetBadRequest(InvalidIdempotencyKey, response.ValidationError)
+			return
+		}
+		origin.IdempotencyKey = key[0]
+	}
+	if auth, ok := c.Get(httpapi.KeyAuth); ok {
+		if claim, ok := auth.(misc.JwtClaim); ok {
+			origin.Subject = claim.GetSubject()
+			origin.TokenId = claim.GetIdentity()
+		}
+		if claim, ok := auth.(misc.ActingClaim); ok {
+			origin.Actor = claim.GetActor()
+		}
+	}
+	for _, v := range ginApp.forwardedHeaders {
+		if values := c.Request.Header.Values(v); len(values) != 0 {
+			origin.Headers[v] = slices.Clone(values)
+		}
+	}
+	c.Request = c.Request.WithContext(httpapi.WithOrigin(c.Request.Context(), origin))
+}
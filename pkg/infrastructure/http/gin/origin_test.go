@@ -0,0 +1,137 @@
+package gin
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	httpapi "github.com/nullexp/finman-api-gateway/pkg/infrastructure/http/protocol"
+	"github.com/nullexp/finman-api-gateway/pkg/infrastructure/http/protocol/response"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOrigin(t *testing.T) {
+	app := NewGinApp()
+	var a httpapi.Api = app
+
+	baseRoute := "/test"
+	var origin httpapi.Origin
+	var found bool
+	handler := func(req httpapi.Request) {
+		origin, found = httpapi.OriginFrom(req.Context())
+		req.ReturnStatus(http.StatusNoContent, nil)
+	}
+	a.AppendModule(NewTestModule(baseRoute,
+		&httpapi.RequestDefinition{Route: "/private", Method: http.MethodGet, Handler: handler},
+		&httpapi.RequestDefinition{Route: "/free", Method: http.MethodGet, FreeRoute: true, Handler: handler},
+	))
+	info := TokenInfo{ExpireTime: time.Now().AddDate(1, 0, 0).Unix(), Subject: "7", Identity: uuid.NewString()}
+	a.AppendAuthenticator(baseRoute, NewOkTestAuthenticatorWithToken(info))
+	a.AppendAuthorizer(baseRoute, func(_ context.Context, identity string, permission string) (bool, error) {
+		return true, nil
+	})
+	a.SetForwardedHeaders([]string{"accept-language", TraceParent})
+	app.Init(gin.TestMode)
+
+	send := func(route string, header http.Header) *httptest.ResponseRecorder {
+		found = false
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, baseRoute+route, nil)
+		req.Header = header
+		req.RemoteAddr = "10.0.0.9:4000"
+		_ = app.TestHandle(w, req)
+		return w
+	}
+
+	t.Run("Expect the caller, the request id and the allowed headers on the context", func(t *testing.T) {
+		traceParent := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+		w := send("/private", http.Header{
+			Authorization:   {"Bearer token"},
+			RequestIdHeader: {"req-1"},
+			IdempotencyKey:  {"key-1"},
+			AcceptLanguage:  {"fa-IR"},
+			TraceParent:     {traceParent},
+			TraceState:      {"vendor=1"},
+		})
+		assert.Equal(t, http.StatusNoContent, w.Code)
+		assert.True(t, found)
+		assert.Equal(t, "7", origin.Subject)
+		assert.Equal(t, info.Identity, origin.TokenId)
+		assert.Equal(t, "req-1", origin.RequestId)
+		assert.Equal(t, "10.0.0.9", origin.ClientIP)
+		assert.Equal(t, "key-1", origin.IdempotencyKey)
+		assert.Equal(t, http.Header{AcceptLanguage: {"fa-IR"}, TraceParent: {traceParent}}, origin.Headers)
+		assert.Equal(t, "req-1", w.Header().Get(RequestIdHeader))
+	})
+
+	t.Run("Expect no subject on free routes", func(t *testing.T) {
+		w := send("/free", http.Header{})
+		assert.Equal(t, http.StatusNoContent, w.Code)
+		assert.True(t, found)
+		assert.Empty(t, origin.Subject)
+		assert.Empty(t, origin.TokenId)
+		assert.Empty(t, origin.Headers)
+	})
+
+	t.Run("Expect a new request id when the client sends none or an unusable one", func(t *testing.T) {
+		for _, id := range []string{"", "has space", strings.Repeat("a", MaxRequestIdLength+1)} {
+			w := send("/free", http.Header{RequestIdHeader: {id}})
+			assert.NotEqual(t, id, origin.RequestId)
+			assert.NoError(t, uuid.Validate(origin.RequestId))
+			assert.Equal(t, origin.RequestId, w.Header().Get(RequestIdHeader))
+		}
+	})
+
+	t.Run("Expect X-Forwarded-For of an untrusted peer to be ignored", func(t *testing.T) {
+		send("/free", http.Header{"X-Forwarded-For": {"203.0.113.7"}})
+		assert.Equal(t, "10.0.0.9", origin.ClientIP)
+	})
+
+	t.Run("Expect an unusable idempotency key to be refused", func(t *testing.T) {
+		for _, key := range [][]string{{""}, {"has space"}, {strings.Repeat("a", MaxRequestIdLength+1)}, {"key-1", "key-2"}} {
+			w := send("/free", http.Header{IdempotencyKey: key})
+			assert.Equal(t, http.StatusBadRequest, w.Code, key)
+			assert.Contains(t, w.Body.String(), response.ValidationError)
+		}
+	})
+
+	t.Run("Expect the request id on errors too", func(t *testing.T) {
+		w := send("/private", http.Header{RequestIdHeader: {"req-2"}})
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Equal(t, "req-2", w.Header().Get(RequestIdHeader))
+	})
+}
+
+func TestTrustedProxies(t *testing.T) {
+	app := NewGinApp()
+	var clientIP string
+	app.AppendModule(NewTestModule("/test", &httpapi.RequestDefinition{Route: "/free", Method: http.MethodGet, FreeRoute: true, Handler: func(req httpapi.Request) {
+		origin, _ := httpapi.OriginFrom(req.Context())
+		clientIP = origin.ClientIP
+		req.ReturnStatus(http.StatusNoContent, nil)
+	}}))
+	app.SetTrustedProxies([]string{"10.0.0.0/8"})
+	app.Init(gin.TestMode)
+
+	for peer, expected := range map[string]string{"10.0.0.9:4000": "203.0.113.7", "198.51.100.1:4000": "198.51.100.1"} {
+		req, _ := http.NewRequest(http.MethodGet, "/test/free", nil)
+		req.Header.Set("X-Forwarded-For", "203.0.113.7")
+		req.RemoteAddr = peer
+		_ = app.TestHandle(httptest.NewRecorder(), req)
+		assert.Equal(t, expected, clientIP, peer)
+	}
+
+	assert.Panics(t, func() { NewGinApp().SetTrustedProxies([]string{"proxy.local"}) })
+}
+
+func TestSetForwardedHeaders(t *testing.T) {
+	for _, header := range []string{"authorization", ApiKeyHeader, Cookie, "proxy-authorization", "content-type", "te", "connection", "grpc-timeout", "x-subject", IdempotencyKey} {
+		assert.Panics(t, func() { NewGinApp().SetForwardedHeaders([]string{AcceptLanguage, header}) }, header)
+	}
+	assert.NotPanics(t, func() { NewGinApp().SetForwardedHeaders([]string{AcceptLanguage, "x-tenant"}) })
+}
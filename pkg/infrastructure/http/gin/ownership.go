@@ -0,0 +1,110 @@
+package gin
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nullexp/finman-api-gateway/pkg/infrastructure/misc"
+)
+
+// isOwner reports whether the caller owns the resource with the given owner id.
+func (ginApp *GinApp) isOwner(claim misc.JwtClaim, ownerId string) bool {
+	if claim == nil || ownerId == "" {
+		return false
+	}
+	resolve := ginApp.ownerResolver
+	if resolve == nil {
+		resolve = func(claim misc.JwtClaim) (string, error) { return claim.GetSubject(), nil }
+	}
+	id, err := resolve(claim)
+	if err != nil {
+		return false
+	}
+	return id == ownerId
+}
+
+// enforceResponseOwner runs the rest of the chain with the response held back, and lets it out only
+// when the field of the response names the caller. Failed responses are let out as they are, they
+// carry nothing of the resource.
+func (ginApp *GinApp) enforceResponseOwner(c *gin.Context, claim misc.JwtClaim, field string) {
+	writer := &ownershipWriter{ResponseWriter: c.Writer}
+	c.Writer = writer
+	c.Next()
+	c.Writer = writer.ResponseWriter
+
+	status := writer.Status()
+	if status < http.StatusOK || status >= http.StatusMultipleChoices ||
+		ginApp.isOwner(claim, ResponseField(writer.body.Bytes(), field)) {
+		c.Writer.WriteHeader(status)
+		c.Writer.Write(writer.body.Bytes())
+		return
+	}
+
+	c.Writer.Header().Del("Content-Type")
+	c.Writer.Header().Del("Content-Length")
+	NewRequest(c).SetForbidden()
+}
+
+// ResponseField returns the value at the dotted path of a JSON body, or an empty string when there is
+// none.
+func ResponseField(body []byte, path string) string {
+	var value any
+	if err := json.Unmarshal(body, &value); err != nil {
+		return ""
+	}
+	for _, key := range strings.Split(path, ".") {
+		object, ok := value.(map[string]any)
+		if !ok {
+			return ""
+		}
+		value = object[key]
+	}
+	switch v := value.(type) {
+	case nil, map[string]any, []any:
+		return ""
+	case string:
+		return v
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// ownershipWriter buffers the response until its owner is known.
+type ownershipWriter struct {
+	gin.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *ownershipWriter) WriteHeader(code int) {
+	w.status = code
+}
+
+func (w *ownershipWriter) WriteHeaderNow() {}
+
+func (w *ownershipWriter) Write(data []byte) (int, error) {
+	return w.body.Write(data)
+}
+
+func (w *ownershipWriter) WriteString(s string) (int, error) {
+	return w.body.WriteString(s)
+}
+
+func (w *ownershipWriter) Status() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+func (w *ownershipWriter) Size() int {
+	return w.body.Len()
+}
+
+func (w *ownershipWriter) Written() bool {
+	return w.status != 0 || w.body.Len() != 0
+}
@@ -0,0 +1,328 @@
+package gin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin/binding"
+	httpapi "github.com/nullexp/finman-api-gateway/pkg/infrastructure/http/protocol"
+)
+
+const (
+	MergePatchContentType = "application/merge-patch+json" // RFC 7396
+	JsonPatchContentType  = "application/json-patch+json"  // RFC 6902
+)
+
+var (
+	ErrUnsupportedPatch = errors.New("patch must be " + MergePatchContentType + " or " + JsonPatchContentType)
+	ErrPatchTestFailed  = errors.New("patch test operation failed")
+)
+
+// ParsePatch reads the body of a PATCH request by its content type. Plain JSON is taken as a merge
+// patch.
+func ParsePatch(contentType string, body []byte) (httpapi.Patch, error) {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case MergePatchContentType, binding.MIMEJSON:
+		var patch any
+		if err := json.Unmarshal(body, &patch); err != nil {
+			return nil, err
+		}
+		return mergePatch{patch: patch}, nil
+	case JsonPatchContentType:
+		var operations []patchOperation
+		if err := json.Unmarshal(body, &operations); err != nil {
+			return nil, err
+		}
+		for _, v := range operations {
+			if err := v.check(); err != nil {
+				return nil, err
+			}
+		}
+		return jsonPatch{operations: operations}, nil
+	}
+	return nil, ErrUnsupportedPatch
+}
+
+type mergePatch struct {
+	patch any
+}
+
+func (p mergePatch) Apply(ctx context.Context, target any) error {
+	return applyPatch(ctx, target, func(document any) (any, error) {
+		return merge(document, p.patch), nil
+	})
+}
+
+// merge applies a merge patch to a document, RFC 7396 section 2.
+func merge(document, patch any) any {
+	fields, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	object, ok := document.(map[string]any)
+	if !ok {
+		object = map[string]any{}
+	}
+	for k, v := range fields {
+		if v == nil {
+			delete(object, k)
+			continue
+		}
+		object[k] = merge(object[k], v)
+	}
+	return object
+}
+
+type patchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from"`
+	Value json.RawMessage `json:"value"`
+}
+
+func (o patchOperation) check() error {
+	switch o.Op {
+	case "add", "replace", "test":
+		if o.Value == nil {
+			return fmt.Errorf("patch %s operation at %q has no value", o.Op, o.Path)
+		}
+	case "remove":
+	case "move", "copy":
+		if _, err := splitPointer(o.From); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown patch operation %q", o.Op)
+	}
+	_, err := splitPointer(o.Path)
+	return err
+}
+
+type jsonPatch struct {
+	operations []patchOperation
+}
+
+func (p jsonPatch) Apply(ctx context.Context, target any) error {
+	return applyPatch(ctx, target, func(document any) (out any, err error) {
+		for _, v := range p.operations {
+			if document, err = v.apply(document); err != nil {
+				return nil, err
+			}
+		}
+		return document, nil
+	})
+}
+
+// apply runs the operation on the document, RFC 6902 section 4.
+func (o patchOperation) apply(document any) (any, error) {
+	path, _ := splitPointer(o.Path)
+	var value any
+	if o.Value != nil {
+		if err := json.Unmarshal(o.Value, &value); err != nil {
+			return nil, err
+		}
+	}
+
+	switch o.Op {
+	case "add":
+		return addAt(document, path, value)
+	case "remove":
+		document, _, err := removeAt(document, path)
+		return document, err
+	case "replace":
+		document, _, err := removeAt(document, path)
+		if err != nil {
+			return nil, err
+		}
+		return addAt(document, path, value)
+	case "move", "copy":
+		from, _ := splitPointer(o.From)
+		var err error
+		if o.Op == "move" {
+			document, value, err = removeAt(document, from)
+		} else if value, err = valueAt(document, from); err == nil {
+			// the copy must not share containers with the original
+			var data []byte
+			if data, err = json.Marshal(value); err == nil {
+				value = nil
+				err = json.Unmarshal(data, &value)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		return addAt(document, path, value)
+	default: // test
+		current, err := valueAt(document, path)
+		if err != nil {
+			return nil, err
+		}
+		if !reflect.DeepEqual(current, value) {
+			return nil, fmt.Errorf("%w at %q", ErrPatchTestFailed, o.Path)
+		}
+		return document, nil
+	}
+}
+
+// splitPointer splits a JSON pointer into its unescaped tokens, RFC 6901.
+func splitPointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return []string{}, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("json pointer %q must start with /", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, v := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(v, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+func arrayIndex(token string, length int, appending bool) (int, error) {
+	if appending && token == "-" {
+		return length, nil
+	}
+	index, err := strconv.Atoi(token)
+	if err != nil || index < 0 || index > length || (!appending && index == length) || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("array index %q is out of range", token)
+	}
+	return index, nil
+}
+
+func valueAt(document any, path []string) (any, error) {
+	for _, token := range path {
+		switch v := document.(type) {
+		case map[string]any:
+			child, ok := v[token]
+			if !ok {
+				return nil, fmt.Errorf("member %q does not exist", token)
+			}
+			document = child
+		case []any:
+			index, err := arrayIndex(token, len(v), false)
+			if err != nil {
+				return nil, err
+			}
+			document = v[index]
+		default:
+			return nil, fmt.Errorf("%q is not in a container", token)
+		}
+	}
+	return document, nil
+}
+
+// addAt returns the document with the value added at the path, the parent of the path must exist.
+func addAt(document any, path []string, value any) (any, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	parent, err := valueAt(document, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+	last := path[len(path)-1]
+	switch v := parent.(type) {
+	case map[string]any:
+		v[last] = value
+		return document, nil
+	case []any:
+		index, err := arrayIndex(last, len(v), true)
+		if err != nil {
+			return nil, err
+		}
+		v = append(v[:index], append([]any{value}, v[index:]...)...)
+		return setAt(document, path[:len(path)-1], v)
+	}
+	return nil, fmt.Errorf("%q is not in a container", last)
+}
+
+// setAt returns the document with the value at the path replaced by the given one.
+func setAt(document any, path []string, value any) (any, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	parent, err := valueAt(document, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+	last := path[len(path)-1]
+	switch v := parent.(type) {
+	case map[string]any:
+		v[last] = value
+	case []any:
+		index, err := arrayIndex(last, len(v), false)
+		if err != nil {
+			return nil, err
+		}
+		v[index] = value
+	}
+	return document, nil
+}
+
+// removeAt returns the document without the value at the path, and the removed value.
+func removeAt(document any, path []string) (any, any, error) {
+	if len(path) == 0 {
+		return nil, document, nil
+	}
+	parent, err := valueAt(document, path[:len(path)-1])
+	if err != nil {
+		return nil, nil, err
+	}
+	last := path[len(path)-1]
+	switch v := parent.(type) {
+	case map[string]any:
+		removed, ok := v[last]
+		if !ok {
+			return nil, nil, fmt.Errorf("member %q does not exist", last)
+		}
+		delete(v, last)
+		return document, removed, nil
+	case []any:
+		index, err := arrayIndex(last, len(v), false)
+		if err != nil {
+			return nil, nil, err
+		}
+		removed := v[index]
+		v = append(v[:index:index], v[index+1:]...)
+		document, err = setAt(document, path[:len(path)-1], v)
+		return document, removed, err
+	}
+	return nil, nil, fmt.Errorf("%q is not in a container", last)
+}
+
+// applyPatch patches the JSON form of target, then decodes the result back into target from its zero
+// value so removed members are cleared.
+func applyPatch(ctx context.Context, target any, patch func(document any) (any, error)) error {
+	data, err := json.Marshal(target)
+	if err != nil {
+		return err
+	}
+	var document any
+	if err = json.Unmarshal(data, &document); err != nil {
+		return err
+	}
+	if document, err = patch(document); err != nil {
+		return err
+	}
+	if data, err = json.Marshal(document); err != nil {
+		return err
+	}
+
+	value := reflect.ValueOf(target).Elem()
+	value.Set(reflect.Zero(value.Type()))
+	if err = json.Unmarshal(data, target); err != nil {
+		return err
+	}
+	if verifier, ok := target.(httpapi.Verifier); ok {
+		return verifier.Validate(ctx)
+	}
+	return nil
+}
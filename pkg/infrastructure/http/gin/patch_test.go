@@ -0,0 +1,97 @@
+package gin
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type patchedDto struct {
+	Name  string         `json:"name"`
+	Age   int            `json:"age,omitempty"`
+	Tags  []string       `json:"tags"`
+	Extra map[string]any `json:"extra,omitempty"`
+}
+
+func (d *patchedDto) Validate(context.Context) error {
+	if d.Name == "" {
+		return errors.New("name is required")
+	}
+	return nil
+}
+
+func TestMergePatch(t *testing.T) {
+	patch, err := ParsePatch(MergePatchContentType, []byte(`{"age": 30, "extra": {"a": 1, "b": null}, "tags": ["x"]}`))
+	assert.NoError(t, err)
+
+	dto := &patchedDto{Name: "n", Age: 10, Tags: []string{"y", "z"}, Extra: map[string]any{"b": "c"}}
+	assert.NoError(t, patch.Apply(context.Background(), dto))
+	assert.Equal(t, &patchedDto{Name: "n", Age: 30, Tags: []string{"x"}, Extra: map[string]any{"a": float64(1)}}, dto)
+
+	t.Run("Expect null to clear the member", func(t *testing.T) {
+		patch, err := ParsePatch("application/json; charset=utf-8", []byte(`{"age": null}`))
+		assert.NoError(t, err)
+		dto := &patchedDto{Name: "n", Age: 10}
+		assert.NoError(t, patch.Apply(context.Background(), dto))
+		assert.Equal(t, 0, dto.Age)
+	})
+
+	t.Run("Expect patched dto to be validated", func(t *testing.T) {
+		patch, err := ParsePatch(MergePatchContentType, []byte(`{"name": null}`))
+		assert.NoError(t, err)
+		assert.Error(t, patch.Apply(context.Background(), &patchedDto{Name: "n"}))
+	})
+}
+
+func TestJsonPatch(t *testing.T) {
+	apply := func(operations string, dto *patchedDto) error {
+		patch, err := ParsePatch(JsonPatchContentType, []byte(operations))
+		if err != nil {
+			return err
+		}
+		return patch.Apply(context.Background(), dto)
+	}
+
+	t.Run("Expect operations to run in order", func(t *testing.T) {
+		dto := &patchedDto{Name: "n", Tags: []string{"a", "b"}}
+		err := apply(`[
+			{"op": "test", "path": "/name", "value": "n"},
+			{"op": "replace", "path": "/name", "value": "m"},
+			{"op": "add", "path": "/tags/1", "value": "c"},
+			{"op": "add", "path": "/tags/-", "value": "d"},
+			{"op": "remove", "path": "/tags/0"},
+			{"op": "add", "path": "/extra", "value": {"a~b": 1}},
+			{"op": "copy", "from": "/extra", "path": "/extra/copy"},
+			{"op": "move", "from": "/extra/a~0b", "path": "/age"}
+		]`, dto)
+		assert.NoError(t, err)
+		assert.Equal(t, &patchedDto{Name: "m", Age: 1, Tags: []string{"c", "b", "d"}, Extra: map[string]any{"copy": map[string]any{"a~b": float64(1)}}}, dto)
+	})
+
+	t.Run("Expect failed test to leave dto alone", func(t *testing.T) {
+		dto := &patchedDto{Name: "n"}
+		err := apply(`[{"op": "replace", "path": "/name", "value": "m"}, {"op": "test", "path": "/name", "value": "n"}]`, dto)
+		assert.ErrorIs(t, err, ErrPatchTestFailed)
+		assert.Equal(t, "n", dto.Name)
+	})
+
+	for name, operations := range map[string]string{
+		"unknown op":      `[{"op": "merge", "path": "/name"}]`,
+		"missing value":   `[{"op": "add", "path": "/name"}]`,
+		"bad pointer":     `[{"op": "remove", "path": "name"}]`,
+		"missing member":  `[{"op": "remove", "path": "/unknown"}]`,
+		"index too large": `[{"op": "add", "path": "/tags/5", "value": "x"}]`,
+		"not an array":    `{"op": "remove", "path": "/name"}`,
+	} {
+		t.Run("Expect "+name+" to fail", func(t *testing.T) {
+			assert.Error(t, apply(operations, &patchedDto{Name: "n", Tags: []string{}}))
+		})
+	}
+}
+
+func TestParsePatchContentType(t *testing.T) {
+	_, err := ParsePatch("text/plain", []byte(`{}`))
+	assert.ErrorIs(t, err, ErrUnsupportedPatch)
+}
@@ -1,9 +1,13 @@
 package gin
 
 import (
+	"cmp"
 	"net/http"
+	"slices"
+	"sync"
 
 	httpapi "github.com/nullexp/finman-api-gateway/pkg/infrastructure/http/protocol"
+	"github.com/nullexp/finman-api-gateway/pkg/infrastructure/http/protocol/model"
 )
 
 type PermissionManager struct {
@@ -11,7 +15,14 @@ type PermissionManager struct {
 	innerDeleteRouteMap map[string][]string
 	innerPutRouteMap    map[string][]string
 	innerGetRouteMap    map[string][]string
+	innerPatchRouteMap  map[string][]string
 	innerFreeRouteMap   map[string][]httpapi.HTTPMethod
+	// permissions a route requires all of, the maps above hold the ones it requires any of
+	innerAllRouteMap map[httpapi.HTTPMethod]map[string][]string
+
+	// rules of the permission policy, they are replaced while requests read them
+	policyLock sync.RWMutex
+	policy     map[httpapi.HTTPMethod]map[string]PolicyRule
 }
 
 func NewPermissionManager() *PermissionManager {
@@ -21,7 +32,9 @@ func NewPermissionManager() *PermissionManager {
 	pm.innerDeleteRouteMap = map[string][]string{}
 	pm.innerPutRouteMap = map[string][]string{}
 	pm.innerGetRouteMap = map[string][]string{}
+	pm.innerPatchRouteMap = map[string][]string{}
 	pm.innerFreeRouteMap = map[string][]httpapi.HTTPMethod{}
+	pm.innerAllRouteMap = map[httpapi.HTTPMethod]map[string][]string{}
 	return &pm
 }
 
@@ -65,11 +78,34 @@ func (pm *PermissionManager) GetPutPermission(route string) []string {
 	return val
 }
 
+func (pm *PermissionManager) GetPatchPermission(route string) []string {
+	val, ok := pm.innerPatchRouteMap[route]
+
+	if !ok {
+		return []string{}
+	}
+
+	return val
+}
+
 func (pm *PermissionManager) SetPostPermission(route string, perm string) {
 	pm.innerPostRouteMap[route] = append(pm.innerPostRouteMap[route], perm)
 }
 
+// GetPermission returns the permissions the route requires any of, after the permission policy.
 func (pm *PermissionManager) GetPermission(route string, method httpapi.HTTPMethod) []string {
+	method = permissionMethod(method)
+	rule, ok := pm.getPolicyRule(route, method)
+	if !ok {
+		return pm.getRegisteredPermission(route, method)
+	}
+	if rule.Override {
+		return rule.Any
+	}
+	return union(pm.getRegisteredPermission(route, method), rule.Any)
+}
+
+func (pm *PermissionManager) getRegisteredPermission(route string, method httpapi.HTTPMethod) []string {
 	routePerms := []string{}
 	switch method {
 	case http.MethodGet:
@@ -80,6 +116,8 @@ func (pm *PermissionManager) GetPermission(route string, method httpapi.HTTPMeth
 		routePerms = pm.GetDeletePermission(route)
 	case http.MethodPut:
 		routePerms = pm.GetPutPermission(route)
+	case http.MethodPatch:
+		routePerms = pm.GetPatchPermission(route)
 	default:
 		return routePerms
 	}
@@ -94,6 +132,10 @@ func (pm *PermissionManager) SetGetPermission(route string, perm string) {
 	pm.innerGetRouteMap[route] = append(pm.innerGetRouteMap[route], perm)
 }
 
+func (pm *PermissionManager) SetPatchPermission(route string, perm string) {
+	pm.innerPatchRouteMap[route] = append(pm.innerPatchRouteMap[route], perm)
+}
+
 func (pm *PermissionManager) SetDeletePermission(route string, perm string) {
 	pm.innerDeleteRouteMap[route] = append(pm.innerDeleteRouteMap[route], perm)
 }
@@ -108,7 +150,67 @@ func (pm *PermissionManager) SetPermission(method httpapi.HTTPMethod, route stri
 		pm.SetGetPermission(route, perm)
 	case "PUT":
 		pm.SetPutPermission(route, perm)
+	case "PATCH":
+		pm.SetPatchPermission(route, perm)
+	}
+}
+
+func (pm *PermissionManager) SetAllPermission(method httpapi.HTTPMethod, route string, perm string) {
+	if pm.innerAllRouteMap[method] == nil {
+		pm.innerAllRouteMap[method] = map[string][]string{}
+	}
+	pm.innerAllRouteMap[method][route] = append(pm.innerAllRouteMap[method][route], perm)
+}
+
+// GetAllPermission returns the permissions the route requires every one of, after the permission
+// policy.
+func (pm *PermissionManager) GetAllPermission(route string, method httpapi.HTTPMethod) []string {
+	method = permissionMethod(method)
+	val, ok := pm.innerAllRouteMap[method][route]
+	if !ok {
+		val = []string{}
+	}
+
+	rule, ok := pm.getPolicyRule(route, method)
+	if !ok {
+		return val
 	}
+	if rule.Override {
+		return rule.All
+	}
+	return union(val, rule.All)
+}
+
+// SetPolicy replaces the rules of the permission policy, nil drops the policy.
+func (pm *PermissionManager) SetPolicy(rules map[httpapi.HTTPMethod]map[string]PolicyRule) {
+	pm.policyLock.Lock()
+	defer pm.policyLock.Unlock()
+	pm.policy = rules
+}
+
+func (pm *PermissionManager) getPolicyRule(route string, method httpapi.HTTPMethod) (PolicyRule, bool) {
+	pm.policyLock.RLock()
+	defer pm.policyLock.RUnlock()
+	rule, ok := pm.policy[method][route]
+	return rule, ok
+}
+
+// permissionMethod returns the method whose permissions guard the method, HEAD is guarded as GET.
+func permissionMethod(method httpapi.HTTPMethod) httpapi.HTTPMethod {
+	if method == http.MethodHead {
+		return http.MethodGet
+	}
+	return method
+}
+
+func union(a, b []string) []string {
+	out := slices.Clone(a)
+	for _, v := range b {
+		if !slices.Contains(out, v) {
+			out = append(out, v)
+		}
+	}
+	return out
 }
 
 func (pm *PermissionManager) SetFreePermission(route string, method httpapi.HTTPMethod) {
@@ -132,3 +234,57 @@ func (pm *PermissionManager) IsFree(route string, method httpapi.HTTPMethod) boo
 	}
 	return false
 }
+
+// Catalog lists every permission the routes require after the permission policy, sorted by
+// permission, method and route.
+func (pm *PermissionManager) Catalog() []model.PermissionCatalogEntry {
+	routes := map[httpapi.HTTPMethod]map[string]bool{}
+	add := func(method httpapi.HTTPMethod, perms map[string][]string) {
+		if routes[method] == nil {
+			routes[method] = map[string]bool{}
+		}
+		for route := range perms {
+			routes[method][route] = true
+		}
+	}
+	add(http.MethodGet, pm.innerGetRouteMap)
+	add(http.MethodPost, pm.innerPostRouteMap)
+	add(http.MethodPut, pm.innerPutRouteMap)
+	add(http.MethodDelete, pm.innerDeleteRouteMap)
+	add(http.MethodPatch, pm.innerPatchRouteMap)
+	for method, perms := range pm.innerAllRouteMap {
+		add(method, perms)
+	}
+	pm.policyLock.RLock()
+	for method, rules := range pm.policy {
+		if routes[method] == nil {
+			routes[method] = map[string]bool{}
+		}
+		for route := range rules {
+			routes[method][route] = true
+		}
+	}
+	pm.policyLock.RUnlock()
+
+	entries := map[string][]model.PermissionRoute{}
+	for method, set := range routes {
+		for route := range set {
+			for _, v := range pm.GetPermission(route, method) {
+				entries[v] = append(entries[v], model.PermissionRoute{Method: string(method), Route: route, Requirement: model.RequireAny})
+			}
+			for _, v := range pm.GetAllPermission(route, method) {
+				entries[v] = append(entries[v], model.PermissionRoute{Method: string(method), Route: route, Requirement: model.RequireAll})
+			}
+		}
+	}
+
+	out := make([]model.PermissionCatalogEntry, 0, len(entries))
+	for permission, v := range entries {
+		slices.SortFunc(v, func(a, b model.PermissionRoute) int {
+			return cmp.Or(cmp.Compare(a.Route, b.Route), cmp.Compare(a.Method, b.Method), cmp.Compare(a.Requirement, b.Requirement))
+		})
+		out = append(out, model.PermissionCatalogEntry{Permission: permission, Routes: v})
+	}
+	slices.SortFunc(out, func(a, b model.PermissionCatalogEntry) int { return cmp.Compare(a.Permission, b.Permission) })
+	return out
+}
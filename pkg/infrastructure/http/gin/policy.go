@@ -0,0 +1,188 @@
+package gin
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	httpapi "github.com/nullexp/finman-api-gateway/pkg/infrastructure/http/protocol"
+	logger "github.com/nullexp/finman-api-gateway/pkg/infrastructure/log"
+	"gopkg.in/yaml.v3"
+)
+
+const AnyMethod = "*"
+
+// PermissionPolicy changes the permissions routes require without a rebuild. It is read from a YAML
+// or JSON file.
+type PermissionPolicy struct {
+	Rules []PolicyRule `yaml:"rules"`
+}
+
+// PolicyRule gives the permissions of the routes it matches. They are added to the permissions the
+// route registered, or replace them when Override is set.
+type PolicyRule struct {
+	Method   string   `yaml:"method"` // GET, POST, PUT, PATCH, DELETE or * for every method
+	Route    string   `yaml:"route"`  // a registered route, a trailing /* matches every route under it
+	Any      []string `yaml:"any"`    // the caller needs at least one of these
+	All      []string `yaml:"all"`    // the caller needs every one of these
+	Override bool     `yaml:"override"`
+}
+
+// ParsePermissionPolicy reads a policy, fields it does not know are errors so typos do not go unseen.
+func ParsePermissionPolicy(data []byte) (policy PermissionPolicy, err error) {
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err = decoder.Decode(&policy); err != nil && !errors.Is(err, io.EOF) {
+		return PermissionPolicy{}, err
+	}
+	return policy, nil
+}
+
+// Resolve validates the policy against the registered routes and returns the rule of each route and
+// method. A route matched by several rules gets the most specific one, an exact route before a
+// pattern and a longer pattern before a shorter one.
+func (p PermissionPolicy) Resolve(router *Router) (map[httpapi.HTTPMethod]map[string]PolicyRule, error) {
+	routes := map[httpapi.HTTPMethod]map[string]*httpapi.RequestDefinition{
+		http.MethodGet:    router.RoutesGetMap,
+		http.MethodPost:   router.RoutesPostMap,
+		http.MethodPut:    router.RoutesPutMap,
+		http.MethodDelete: router.RoutesDeleteMap,
+		http.MethodPatch:  router.RoutesPatchMap,
+	}
+
+	out := map[httpapi.HTTPMethod]map[string]PolicyRule{}
+	scores := map[httpapi.HTTPMethod]map[string]int{}
+	for i, rule := range p.Rules {
+		name := fmt.Sprintf("policy rule %d (%s %s)", i+1, rule.Method, rule.Route)
+		if len(rule.Any) == 0 && len(rule.All) == 0 {
+			return nil, fmt.Errorf("%s: gives no permission", name)
+		}
+		methods := []httpapi.HTTPMethod{httpapi.HTTPMethod(strings.ToUpper(rule.Method))}
+		if rule.Method == AnyMethod {
+			methods = []httpapi.HTTPMethod{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+		} else if _, ok := routes[methods[0]]; !ok {
+			return nil, fmt.Errorf("%s: unknown method", name)
+		}
+
+		score, matches := rule.matcher()
+		if rule.Method != AnyMethod {
+			score++
+		}
+		matched := false
+		for _, method := range methods {
+			for route, definition := range routes[method] {
+				if !matches(route) {
+					continue
+				}
+				if definition.FreeRoute {
+					if score >= math.MaxInt-1 {
+						return nil, fmt.Errorf("%s: route is free", name)
+					}
+					continue
+				}
+				matched = true
+
+				if out[method] == nil {
+					out[method] = map[string]PolicyRule{}
+					scores[method] = map[string]int{}
+				}
+				if previous, ok := scores[method][route]; ok {
+					if previous == score {
+						return nil, fmt.Errorf("%s: %s %s is matched by another rule as specific", name, method, route)
+					}
+					if previous > score {
+						continue
+					}
+				}
+				out[method][route] = rule
+				scores[method][route] = score
+			}
+		}
+		if !matched {
+			return nil, fmt.Errorf("%s: matches no route", name)
+		}
+	}
+	return out, nil
+}
+
+// matcher returns how specific the route of the rule is, leaving the lowest bit for the method, and
+// whether it matches a route.
+func (r PolicyRule) matcher() (int, func(string) bool) {
+	prefix, isPattern := strings.CutSuffix(r.Route, "/*")
+	if !isPattern {
+		return math.MaxInt - 1, func(route string) bool { return route == r.Route }
+	}
+	return len(prefix) * 2, func(route string) bool {
+		return route == prefix || strings.HasPrefix(route, prefix+"/")
+	}
+}
+
+// SetPolicyFile sets the permission policy file. It is validated when the app runs, and read again
+// every reloadEvery when that is not zero.
+func (ginApp *GinApp) SetPolicyFile(path string, reloadEvery time.Duration) {
+	ginApp.policyFile = path
+	ginApp.policyReloadEvery = reloadEvery
+}
+
+// LoadPolicy reads the policy file and applies it. The routes must be registered already, so the app
+// must be initiated.
+func (ginApp *GinApp) LoadPolicy() error {
+	data, err := os.ReadFile(ginApp.policyFile)
+	if err != nil {
+		return err
+	}
+	if err = ginApp.applyPolicy(data); err != nil {
+		return err
+	}
+	ginApp.policyData = data
+	return nil
+}
+
+func (ginApp *GinApp) applyPolicy(data []byte) error {
+	policy, err := ParsePermissionPolicy(data)
+	if err != nil {
+		return fmt.Errorf("permission policy %s: %w", ginApp.policyFile, err)
+	}
+	rules, err := policy.Resolve(ginApp.router)
+	if err != nil {
+		return fmt.Errorf("permission policy %s: %w", ginApp.policyFile, err)
+	}
+	ginApp.PermissionManager.SetPolicy(rules)
+	return nil
+}
+
+// WatchPolicy applies the policy file again whenever its content differs from the loaded one, until
+// the context is done. A file that is not valid is logged and the previous policy stays.
+func (ginApp *GinApp) WatchPolicy(ctx context.Context, every time.Duration) {
+	last := ginApp.policyData
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			data, err := os.ReadFile(ginApp.policyFile)
+			if err != nil {
+				logger.Error.Printf("Error reading permission policy: %v", err)
+				continue
+			}
+			if bytes.Equal(data, last) {
+				continue
+			}
+			last = data
+			if err = ginApp.applyPolicy(data); err != nil {
+				logger.Error.Printf("Error reloading permission policy, keeping the previous one: %v", err)
+				continue
+			}
+			logger.Info.Printf("Permission policy %s is reloaded", ginApp.policyFile)
+		}
+	}
+}
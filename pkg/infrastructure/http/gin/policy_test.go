@@ -0,0 +1,149 @@
+package gin
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/nullexp/finman-api-gateway/pkg/infrastructure/http/protocol"
+	"github.com/stretchr/testify/assert"
+)
+
+func newPolicyRouter() *Router {
+	router := NewRouter()
+	router.Register(&protocol.RequestDefinition{Route: "", Method: http.MethodGet, AnyPermissions: []string{"Manage"}}, "/users")
+	router.Register(&protocol.RequestDefinition{Route: "/:id", Method: http.MethodGet}, "/users")
+	router.Register(&protocol.RequestDefinition{Route: "/:id", Method: http.MethodDelete}, "/users")
+	router.Register(&protocol.RequestDefinition{Route: "/login", Method: http.MethodPost, FreeRoute: true}, "/users")
+	return router
+}
+
+func TestParsePermissionPolicy(t *testing.T) {
+	t.Run("Expect yaml and json to be read alike", func(t *testing.T) {
+		yamlPolicy, err := ParsePermissionPolicy([]byte("rules:\n  - method: GET\n    route: /users\n    any: [Read]\n    override: true\n"))
+		assert.NoError(t, err)
+		jsonPolicy, err := ParsePermissionPolicy([]byte(`{"rules": [{"method": "GET", "route": "/users", "any": ["Read"], "override": true}]}`))
+		assert.NoError(t, err)
+		assert.Equal(t, yamlPolicy, jsonPolicy)
+		assert.Equal(t, []PolicyRule{{Method: "GET", Route: "/users", Any: []string{"Read"}, Override: true}}, jsonPolicy.Rules)
+	})
+
+	t.Run("Expect unknown fields to fail", func(t *testing.T) {
+		_, err := ParsePermissionPolicy([]byte("rules:\n  - method: GET\n    rout: /users\n"))
+		assert.Error(t, err)
+	})
+
+	t.Run("Expect empty file to be an empty policy", func(t *testing.T) {
+		policy, err := ParsePermissionPolicy(nil)
+		assert.NoError(t, err)
+		assert.Empty(t, policy.Rules)
+	})
+}
+
+func TestResolvePermissionPolicy(t *testing.T) {
+	router := newPolicyRouter()
+
+	t.Run("Expect most specific rule to win", func(t *testing.T) {
+		policy := PermissionPolicy{Rules: []PolicyRule{
+			{Method: AnyMethod, Route: "/users/*", Any: []string{"Wide"}},
+			{Method: http.MethodGet, Route: "/users/*", Any: []string{"Get"}},
+			{Method: AnyMethod, Route: "/users/:id", Any: []string{"Exact"}},
+		}}
+		rules, err := policy.Resolve(router)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"Get"}, rules[http.MethodGet]["/users"].Any)
+		assert.Equal(t, []string{"Exact"}, rules[http.MethodGet]["/users/:id"].Any)
+		assert.Equal(t, []string{"Exact"}, rules[http.MethodDelete]["/users/:id"].Any)
+		_, ok := rules[http.MethodPost]["/users/login"]
+		assert.False(t, ok, "patterns must skip free routes")
+	})
+
+	for name, rule := range map[string]PolicyRule{
+		"no route":       {Method: http.MethodGet, Route: "/roles", Any: []string{"A"}},
+		"no permission":  {Method: http.MethodGet, Route: "/users"},
+		"unknown method": {Method: "FETCH", Route: "/users", Any: []string{"A"}},
+		"free route":     {Method: http.MethodPost, Route: "/users/login", Any: []string{"A"}},
+	} {
+		t.Run("Expect rule with "+name+" to fail", func(t *testing.T) {
+			_, err := PermissionPolicy{Rules: []PolicyRule{rule}}.Resolve(router)
+			assert.Error(t, err)
+		})
+	}
+
+	t.Run("Expect rules as specific to fail", func(t *testing.T) {
+		_, err := PermissionPolicy{Rules: []PolicyRule{
+			{Method: http.MethodGet, Route: "/users", Any: []string{"A"}},
+			{Method: http.MethodGet, Route: "/users", Any: []string{"B"}},
+		}}.Resolve(router)
+		assert.Error(t, err)
+	})
+}
+
+func TestPermissionPolicy(t *testing.T) {
+	app := NewGinApp()
+	var a protocol.Api = app
+
+	baseRoute := "/test"
+	handle := func(req protocol.Request) {
+		req.ReturnStatus(http.StatusNoContent, nil)
+	}
+	a.AppendModule(NewTestModule(baseRoute,
+		&protocol.RequestDefinition{Route: "/merged", Method: http.MethodGet, AnyPermissions: []string{"Write"}, Handler: handle},
+		&protocol.RequestDefinition{Route: "/overridden", Method: http.MethodGet, AnyPermissions: []string{"Read"}, Handler: handle},
+	))
+	info := TokenInfo{ExpireTime: time.Now().Add(time.Hour).Unix(), Subject: "1", Identity: uuid.NewString()}
+	a.AppendAuthenticator(baseRoute, NewOkTestAuthenticatorWithToken(info))
+	a.AppendBatchAuthorizer(baseRoute, func(_ context.Context, identity string, permissions []string) (map[string]bool, error) {
+		out := map[string]bool{}
+		for _, v := range permissions {
+			out[v] = v == "Read"
+		}
+		return out, nil
+	})
+
+	file := filepath.Join(t.TempDir(), "policy.yaml")
+	write := func(content string) {
+		assert.NoError(t, os.WriteFile(file, []byte(content), 0o600))
+	}
+	write(`rules:
+  - {method: GET, route: /test/merged, any: [Read]}
+  - {method: GET, route: /test/overridden, all: [Write], override: true}
+`)
+	a.SetPolicyFile(file, time.Millisecond)
+	app.Init(gin.TestMode)
+	assert.NoError(t, app.LoadPolicy())
+
+	send := func(route string) int {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, baseRoute+route, nil)
+		req.Header.Add(Authorization, "Bearer somerandomText")
+		_ = app.TestHandle(w, req)
+		return w.Code
+	}
+
+	t.Run("Expect policy to merge with and override the route permissions", func(t *testing.T) {
+		assert.Equal(t, http.StatusNoContent, send("/merged"))
+		assert.Equal(t, http.StatusForbidden, send("/overridden"))
+	})
+
+	t.Run("Expect changed file to be reloaded and a broken one to be ignored", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go app.WatchPolicy(ctx, time.Millisecond)
+
+		write("rules: []\n")
+		assert.Eventually(t, func() bool { return send("/merged") == http.StatusForbidden }, time.Second, time.Millisecond)
+		assert.Equal(t, http.StatusNoContent, send("/overridden"))
+
+		write(`rules: [{method: GET, route: /test/unknown, any: [Read]}]`)
+		time.Sleep(20 * time.Millisecond)
+		assert.Equal(t, http.StatusForbidden, send("/merged"))
+		assert.Equal(t, http.StatusNoContent, send("/overridden"))
+	})
+}
@@ -0,0 +1,91 @@
+package gin
+
+import "strings"
+
+// prefixTree holds values by base URL and finds the one of the longest base URL a route falls under.
+// Base URLs are compared segment by segment, so /admin covers /admin/users but not /administrators.
+type prefixTree[T any] struct {
+	root *prefixNode[T]
+}
+
+type prefixNode[T any] struct {
+	children map[string]*prefixNode[T]
+	baseURL  string
+	value    T
+	set      bool
+}
+
+func newPrefixTree[T any]() *prefixTree[T] {
+	return &prefixTree[T]{root: &prefixNode[T]{children: map[string]*prefixNode[T]{}}}
+}
+
+func splitSegments(path string) []string {
+	out := []string{}
+	for _, v := range strings.Split(path, "/") {
+		if v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// Set stores the value of the base URL, replacing the one stored before.
+func (t *prefixTree[T]) Set(baseURL string, value T) {
+	node := t.root
+	segments := splitSegments(baseURL)
+	for _, v := range segments {
+		child := node.children[v]
+		if child == nil {
+			child = &prefixNode[T]{children: map[string]*prefixNode[T]{}}
+			node.children[v] = child
+		}
+		node = child
+	}
+	node.baseURL = "/" + strings.Join(segments, "/")
+	node.value = value
+	node.set = true
+}
+
+// Unset removes the value of the base URL, shorter base URLs cover its routes again.
+func (t *prefixTree[T]) Unset(baseURL string) {
+	node := t.root
+	for _, v := range splitSegments(baseURL) {
+		node = node.children[v]
+		if node == nil {
+			return
+		}
+	}
+	var zero T
+	node.value = zero
+	node.set = false
+}
+
+// Get returns the value stored for exactly the base URL.
+func (t *prefixTree[T]) Get(baseURL string) (value T, ok bool) {
+	node := t.root
+	for _, v := range splitSegments(baseURL) {
+		node = node.children[v]
+		if node == nil {
+			return value, false
+		}
+	}
+	return node.value, node.set
+}
+
+// Match returns the value of the longest base URL covering the route, and that base URL.
+func (t *prefixTree[T]) Match(route string) (value T, baseURL string, ok bool) {
+	node := t.root
+	if node.set {
+		value, baseURL, ok = node.value, node.baseURL, true
+	}
+	for _, v := range splitSegments(route) {
+		node = node.children[v]
+		if node == nil {
+			break
+		}
+		if node.set {
+			value, baseURL, ok = node.value, node.baseURL, true
+		}
+	}
+	return
+}
@@ -0,0 +1,37 @@
+package gin
+
+import (
+	"net/http"
+
+	"github.com/nullexp/finman-api-gateway/pkg/infrastructure/http/protocol/model"
+)
+
+const (
+	ProblemContentType = "application/problem+json"
+	// ProblemTypePrefix starts the type of a problem, the code of the error ends it
+	ProblemTypePrefix = "urn:problem-type:"
+)
+
+// NewProblem turns the error into RFC 7807 problem details, the error id being its trace id.
+func NewProblem(status int, instance string, e model.RequestError) model.Problem {
+	return model.Problem{
+		Type:     ProblemTypePrefix + e.Code,
+		Title:    http.StatusText(status),
+		Status:   status,
+		Detail:   e.Message,
+		Instance: instance,
+		Code:     e.Code,
+		TraceId:  e.Id,
+		Error:    e.Detail,
+	}
+}
+
+// acceptsProblem reports whether the client asks for application/problem+json errors.
+func (req *request) acceptsProblem() bool {
+	for _, v := range req.getAccept() {
+		if v.Type+"/"+v.Subtype == ProblemContentType && v.Q > 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,98 @@
+package gin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	errorProtocol "github.com/nullexp/finman-api-gateway/pkg/infrastructure/error/protocol"
+	httpapi "github.com/nullexp/finman-api-gateway/pkg/infrastructure/http/protocol"
+	"github.com/nullexp/finman-api-gateway/pkg/infrastructure/http/protocol/model"
+	"github.com/nullexp/finman-api-gateway/pkg/infrastructure/http/protocol/response"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProblem(t *testing.T) {
+	app := NewGinApp()
+	var a httpapi.Api = app
+
+	baseRoute := "/test"
+	missing := errorProtocol.NewNotFoundError("user.USER_NOT_FOUND", "no such user").WithIdAndDetail("8d0c7a43-4e0b-4a4f-9c41-0b7f7f3c2b10")
+	a.AppendModule(NewTestModule(baseRoute,
+		&httpapi.RequestDefinition{Route: "/bad", Method: http.MethodGet, FreeRoute: true, Handler: func(req httpapi.Request) {
+			req.SetBadRequest("bad", response.UnknownFormat)
+		}},
+		&httpapi.RequestDefinition{Route: "/missing", Method: http.MethodGet, FreeRoute: true, Handler: func(req httpapi.Request) {
+			req.Negotiate(http.StatusOK, missing, nil)
+		}},
+		&httpapi.RequestDefinition{Route: "/failed", Method: http.MethodGet, FreeRoute: true, Handler: func(req httpapi.Request) {
+			req.SetServerError("failed")
+		}},
+	))
+	app.Init(gin.TestMode)
+
+	send := func(route, accept string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, route, nil)
+		if accept != "" {
+			req.Header.Set(AcceptHeader, accept)
+		}
+		_ = app.TestHandle(w, req)
+		return w
+	}
+
+	problemOf := func(w *httptest.ResponseRecorder) model.Problem {
+		assert.Equal(t, ProblemContentType, w.Header().Get(ContentType))
+		out := model.Problem{}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &out))
+		return out
+	}
+
+	t.Run("Expect problem details when the client accepts them", func(t *testing.T) {
+		w := send(baseRoute+"/bad", ProblemContentType+", application/json;q=0.5")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		problem := problemOf(w)
+		assert.Equal(t, ProblemTypePrefix+response.UnknownFormat, problem.Type)
+		assert.Equal(t, http.StatusText(http.StatusBadRequest), problem.Title)
+		assert.Equal(t, http.StatusBadRequest, problem.Status)
+		assert.Equal(t, "bad", problem.Detail)
+		assert.Equal(t, baseRoute+"/bad", problem.Instance)
+		assert.Equal(t, response.UnknownFormat, problem.Code)
+		assert.NotEmpty(t, problem.TraceId)
+	})
+
+	t.Run("Expect the managed error to be carried and its id to be the trace id", func(t *testing.T) {
+		w := send(baseRoute+"/missing", ProblemContentType)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		problem := problemOf(w)
+		assert.Equal(t, missing.Id, problem.TraceId)
+		assert.NotNil(t, problem.Error)
+		assert.Equal(t, missing.ErrorCode, problem.Error.ErrorCode)
+	})
+
+	t.Run("Expect server errors as problem details", func(t *testing.T) {
+		w := send(baseRoute+"/failed", ProblemContentType)
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+		assert.Equal(t, http.StatusInternalServerError, problemOf(w).Status)
+	})
+
+	t.Run("Expect unknown routes as problem details", func(t *testing.T) {
+		w := send("/nothing", ProblemContentType)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Equal(t, response.NotFound, problemOf(w).Code)
+	})
+
+	t.Run("Expect the usual error when problem details are not accepted", func(t *testing.T) {
+		for _, accept := range []string{"", "application/json"} {
+			w := send(baseRoute+"/bad", accept)
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			assert.NotEqual(t, ProblemContentType, w.Header().Get(ContentType))
+			out := model.RequestError{}
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &out))
+			assert.Equal(t, response.UnknownFormat, out.Code)
+			assert.NotEmpty(t, out.Id)
+		}
+	})
+}
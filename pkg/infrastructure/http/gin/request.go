@@ -1,6 +1,7 @@
 package gin
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -8,10 +9,13 @@ import (
 	"net/http"
 	"net/textproto"
 	"reflect"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gin-gonic/gin/binding"
+	"github.com/google/uuid"
 	errorProtocol "github.com/nullexp/finman-api-gateway/pkg/infrastructure/error/protocol"
 	fileProtocol "github.com/nullexp/finman-api-gateway/pkg/infrastructure/file/protocol"
 	httpapi "github.com/nullexp/finman-api-gateway/pkg/infrastructure/http/protocol"
@@ -35,30 +39,75 @@ func NewRequest(ctx *gin.Context) httpapi.Request {
 	return &request{ctx}
 }
 
-const serverErrorLog = "Server err of %s - %s , msg: %s"
+func (req *request) Context() context.Context {
+	return req.ctx.Request.Context()
+}
 
+const (
+	serverErrorLog = "Server err %s of %s - %s , msg: %s"
+	clientErrorLog = "Client err %s of %s - %s , status: %d, code: %s, msg: %s"
+)
+
+// SetServerError answers with a generic message, msg is logged under the id of the error instead.
 func (req *request) SetServerError(msg string) {
+	req.setErrorWithCause(http.StatusInternalServerError, msg, model.RequestError{Message: ServerErrorOccurred, Code: response.ServerError})
+}
+
+// setError answers with the error under an id, the id of its detail when it has one, and logs it
+// so the id a client reports leads to the request.
+func (req *request) setError(status int, e model.RequestError) {
+	req.setErrorWithCause(status, e.Message, e)
+}
+
+// setErrorWithCause is setError logging cause in place of the message, which a server error keeps
+// generic.
+func (req *request) setErrorWithCause(status int, cause string, e model.RequestError) {
+	if e.Detail != nil && e.Detail.Id != "" {
+		e.Id = e.Detail.Id
+	}
+	if e.Id == "" {
+		e.Id = uuid.NewString()
+	}
+	if e.Detail != nil {
+		e.Detail.Id = e.Id
+	}
 	c := req.ctx
-	logger.Error.Printf(serverErrorLog, c.ClientIP(), c.Request.URL, msg)
-	req.ctx.JSON(http.StatusInternalServerError, model.RequestError{Message: msg, Code: response.ServerError})
-	req.ctx.Abort()
+	if status >= http.StatusInternalServerError {
+		logger.Error.Printf(serverErrorLog, e.Id, c.ClientIP(), c.Request.URL, cause)
+	} else {
+		logger.Info.Printf(clientErrorLog, e.Id, c.ClientIP(), c.Request.URL, status, e.Code, cause)
+	}
+
+	switch {
+	case req.acceptsProblem():
+		c.Header(ContentType, ProblemContentType)
+		c.JSON(status, NewProblem(status, c.Request.URL.Path, e))
+	case status >= http.StatusInternalServerError:
+		c.JSON(status, e)
+	default:
+		req.negotiate(status, e)
+	}
+	c.Abort()
 }
 
 // SetForbidden will set http.Forbidden status code with given data
 func (req *request) SetForbidden() {
-	req.negotiate(http.StatusForbidden, model.RequestError{Code: response.AccessDenied})
-	req.ctx.Abort()
+	req.setError(http.StatusForbidden, model.RequestError{Code: response.AccessDenied})
 }
 
 func (req *request) SetUnauthorized(msg string, code string) {
-	req.negotiate(http.StatusUnauthorized, model.RequestError{Message: msg, Code: code})
-	req.ctx.Abort()
+	req.setError(http.StatusUnauthorized, model.RequestError{Message: msg, Code: code})
 }
 
 func (req *request) SetBadRequest(msg string, code string) {
-	req.negotiate(http.StatusBadRequest, model.RequestError{Message: msg, Code: code})
+	req.setError(http.StatusBadRequest, model.RequestError{Message: msg, Code: code})
+}
 
-	req.ctx.Abort()
+// SetTooManyRequests will set http.TooManyRequests status code, and tell the client when to retry with Retry-After
+func (req *request) SetTooManyRequests(msg string, code string, retryAfter time.Duration) {
+	seconds := int64((retryAfter + time.Second - 1) / time.Second)
+	req.ctx.Header("Retry-After", strconv.FormatInt(seconds, 10))
+	req.setError(http.StatusTooManyRequests, model.RequestError{Message: msg, Code: code})
 }
 
 func (req *request) SetStatus(status int) {
@@ -66,8 +115,19 @@ func (req *request) SetStatus(status int) {
 }
 
 func (req *request) SetNotFound(message string, code string) {
-	req.negotiate(http.StatusNotFound, model.RequestError{Message: message, Code: code})
-	req.ctx.Abort()
+	req.setError(http.StatusNotFound, model.RequestError{Message: message, Code: code})
+}
+
+func (req *request) GetHeader(key string) string {
+	return req.ctx.GetHeader(key)
+}
+
+func (req *request) SetHeader(key, value string) {
+	req.ctx.Header(key, value)
+}
+
+func (req *request) GetClientIP() string {
+	return req.ctx.ClientIP()
 }
 
 func (req *request) Set(key string, value interface{}) {
@@ -121,17 +181,25 @@ const (
 func (req *request) handleError(err error) bool {
 	if err != nil {
 		if ok, oe := errorProtocol.IsManagedError(err); ok {
+			var detail *errorProtocol.ErrorDto
+			switch e := err.(type) {
+			case errorProtocol.UserOperationError:
+				dto := errorProtocol.ErrorDto(e)
+				detail = &dto
+			case errorProtocol.NotFoundError:
+				dto := errorProtocol.ErrorDto(e)
+				detail = &dto
+			}
 
 			if oe.IsNotFound {
-				req.SetNotFound(DataWasNotFound, string(oe.OperationErrorCode))
+				req.setError(http.StatusNotFound, model.RequestError{Message: DataWasNotFound, Code: string(oe.OperationErrorCode), Detail: detail})
 			} else {
-				req.SetBadRequest(PleaseReadTheErrorCode, string(oe.OperationErrorCode))
+				req.setError(http.StatusBadRequest, model.RequestError{Message: PleaseReadTheErrorCode, Code: string(oe.OperationErrorCode), Detail: detail})
 			}
 			return true
 		}
 
-		req.SetServerError(ServerErrorOccurred)
-		logger.Error.Println(err, err.Error())
+		req.SetServerError(err.Error())
 		return true
 	}
 	return false
@@ -166,7 +234,10 @@ func (req *request) setStatusNotAcceptable() {
 
 const Data = "Data"
 
-const AcceptHeader = "Accept"
+const (
+	AcceptHeader = "Accept"
+	ContentType  = "Content-Type"
+)
 
 func (req *request) getAccept() gah.AcceptSlice {
 	accept := req.ctx.GetHeader(AcceptHeader)
@@ -346,6 +417,24 @@ func (req *request) MustGetDTO() interface{} {
 	return dto
 }
 
+func (req *request) GetPatch() (httpapi.Patch, bool) {
+	patch, exist := req.ctx.Get(httpapi.KeyPatch)
+	if !exist {
+		return nil, false
+	}
+	return patch.(httpapi.Patch), true
+}
+
+const NoPatchExist = "No patch has been given"
+
+func (req *request) MustGetPatch() httpapi.Patch {
+	patch, exist := req.GetPatch()
+	if !exist {
+		panic(NoPatchExist)
+	}
+	return patch
+}
+
 func (req *request) GetFile(partName string) (httpapi.FileHeader, bool) {
 	f, ok := req.ctx.Get(partName)
 
@@ -9,7 +9,9 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	errorProtocol "github.com/nullexp/finman-api-gateway/pkg/infrastructure/error/protocol"
 	httpapi "github.com/nullexp/finman-api-gateway/pkg/infrastructure/http/protocol"
+	"github.com/nullexp/finman-api-gateway/pkg/infrastructure/http/protocol/model"
 	"github.com/nullexp/finman-api-gateway/pkg/infrastructure/misc"
 	"github.com/stretchr/testify/assert"
 )
@@ -363,3 +365,67 @@ func NewOkTestAuthenticatorWithSubject(subject string) *testAuthenticator {
 		return TokenInfo{ExpireTime: time.Now().AddDate(1, 0, 0).Unix(), Subject: subject}, nil
 	}, func(token string) (bool, error) { return true, nil })
 }
+
+func TestTooManyRequests(t *testing.T) {
+	app := NewGinApp()
+	var a httpapi.Api = app
+
+	baseRoute := "/test"
+	a.AppendModule(NewTestModule(baseRoute, &httpapi.RequestDefinition{
+		Route:     "/login",
+		Method:    http.MethodPost,
+		FreeRoute: true,
+		Handler: func(req httpapi.Request) {
+			req.SetTooManyRequests("locked", "TooManyAttempts", 1500*time.Millisecond)
+		},
+	}))
+	app.Init(gin.TestMode)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodPost, baseRoute+"/login", nil)
+	_ = app.TestHandle(w, req)
+
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "2", w.Header().Get("Retry-After"), "Retry-After rounds up to whole seconds")
+	assert.Contains(t, w.Body.String(), "TooManyAttempts")
+}
+
+func TestErrorId(t *testing.T) {
+	app := NewGinApp()
+	var a httpapi.Api = app
+
+	baseRoute := "/test"
+	managed := errorProtocol.NewUserOperationError("user.USER_ALREADY_EXIST", "username is taken").WithIdAndDetail("1f38b18b-2606-49dc-99b0-ed187e0a2618", "username")
+	a.AppendModule(NewTestModule(baseRoute,
+		&httpapi.RequestDefinition{Route: "/managed", Method: http.MethodGet, FreeRoute: true, Handler: func(req httpapi.Request) {
+			req.Negotiate(http.StatusOK, managed, nil)
+		}},
+		&httpapi.RequestDefinition{Route: "/plain", Method: http.MethodGet, FreeRoute: true, Handler: func(req httpapi.Request) {
+			req.SetBadRequest("bad", "UnknownFormat")
+		}},
+	))
+	app.Init(gin.TestMode)
+
+	send := func(route string) model.RequestError {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, baseRoute+route, nil)
+		_ = app.TestHandle(w, req)
+		out := model.RequestError{}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &out))
+		return out
+	}
+
+	t.Run("Expect managed errors to keep their id and detail", func(t *testing.T) {
+		body := send("/managed")
+		assert.Equal(t, managed.Id, body.Id)
+		dto := errorProtocol.ErrorDto(managed)
+		assert.Equal(t, &dto, body.Detail)
+	})
+
+	t.Run("Expect every error to get an id", func(t *testing.T) {
+		first, second := send("/plain"), send("/plain")
+		assert.NotEmpty(t, first.Id)
+		assert.NotEqual(t, first.Id, second.Id)
+		assert.Nil(t, first.Detail)
+	})
+}
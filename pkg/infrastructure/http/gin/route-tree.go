@@ -0,0 +1,125 @@
+package gin
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// routeKey holds the RouteMatch of the request in the gin context.
+const routeKey = "Route"
+
+// RouteMatch is the registered route a request path falls on, with the values of its parameters.
+type RouteMatch struct {
+	Template string
+	Params   map[string]string
+}
+
+// routeNode is a segment of the registered routes. A static segment is tried before a parameter and a
+// parameter before a catch-all, backing out of branches that do not end on a route.
+type routeNode struct {
+	static   map[string]*routeNode
+	param    *routeNode
+	catchAll *routeNode
+	name     string // name of a parameter or catch-all segment
+	source   string // first route going through the node, named in conflicts
+	template string // route ending on the node
+	end      bool
+}
+
+func newRouteNode(source string) *routeNode {
+	return &routeNode{static: map[string]*routeNode{}, source: source}
+}
+
+// insert adds the route template to the tree, failing when it cannot be told apart from a route
+// added before.
+func (n *routeNode) insert(template string) error {
+	segments := splitSegments(template)
+	node := n
+	for i, v := range segments {
+		switch {
+		case strings.HasPrefix(v, ":"):
+			if node.catchAll != nil {
+				return fmt.Errorf("%s conflicts with %s, a parameter cannot sit beside a catch-all", template, node.catchAll.source)
+			}
+			if node.param == nil {
+				node.param = newRouteNode(template)
+				node.param.name = v[1:]
+			} else if node.param.name != v[1:] {
+				return fmt.Errorf("%s conflicts with %s, parameter %s is named :%s there", template, node.param.source, v, node.param.name)
+			}
+			node = node.param
+		case strings.HasPrefix(v, "*"):
+			if i != len(segments)-1 {
+				return fmt.Errorf("%s has a catch-all before its last segment", template)
+			}
+			if sibling := node.child(); sibling != nil {
+				return fmt.Errorf("%s conflicts with %s, a catch-all cannot sit beside other segments", template, sibling.source)
+			}
+			if node.catchAll == nil {
+				node.catchAll = newRouteNode(template)
+				node.catchAll.name = v[1:]
+			} else if node.catchAll.name != v[1:] {
+				return fmt.Errorf("%s conflicts with %s, catch-all %s is named *%s there", template, node.catchAll.source, v, node.catchAll.name)
+			}
+			node = node.catchAll
+		default:
+			if node.catchAll != nil {
+				return fmt.Errorf("%s conflicts with %s, a static segment cannot sit beside a catch-all", template, node.catchAll.source)
+			}
+			child := node.static[v]
+			if child == nil {
+				child = newRouteNode(template)
+				node.static[v] = child
+			}
+			node = child
+		}
+	}
+	if node.end && node.template != template {
+		return fmt.Errorf("%s conflicts with %s, both match the same paths", template, node.template)
+	}
+	node.template = template
+	node.end = true
+	return nil
+}
+
+// child returns the parameter child of the node, or else its first static child by name.
+func (n *routeNode) child() *routeNode {
+	if n.param != nil {
+		return n.param
+	}
+	keys := make([]string, 0, len(n.static))
+	for k := range n.static {
+		keys = append(keys, k)
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	slices.Sort(keys)
+	return n.static[keys[0]]
+}
+
+func (n *routeNode) match(segments []string, params map[string]string) *routeNode {
+	if len(segments) == 0 {
+		if n.end {
+			return n
+		}
+		return nil
+	}
+	if child := n.static[segments[0]]; child != nil {
+		if found := child.match(segments[1:], params); found != nil {
+			return found
+		}
+	}
+	if n.param != nil {
+		if found := n.param.match(segments[1:], params); found != nil {
+			params[n.param.name] = segments[0]
+			return found
+		}
+	}
+	if n.catchAll != nil && n.catchAll.end {
+		params[n.catchAll.name] = "/" + strings.Join(segments, "/")
+		return n.catchAll
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package gin
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/nullexp/finman-api-gateway/pkg/infrastructure/http/protocol"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRouteMatch(t *testing.T) {
+	router := NewRouter()
+	for _, v := range []string{"/transactions/:id", "/transactions/user/:id", "/transactions/:id/items/:item", "/files/*path", "/"} {
+		assert.NoError(t, router.Register(&protocol.RequestDefinition{Route: v, Method: http.MethodGet}, ""))
+	}
+
+	for path, expected := range map[string]RouteMatch{
+		"/transactions/user/user":    {Template: "/transactions/user/:id", Params: map[string]string{"id": "user"}},
+		"/transactions/user":         {Template: "/transactions/:id", Params: map[string]string{"id": "user"}},
+		"/transactions/7/items/7":    {Template: "/transactions/:id/items/:item", Params: map[string]string{"id": "7", "item": "7"}},
+		"/transactions/user/items/3": {Template: "/transactions/:id/items/:item", Params: map[string]string{"id": "user", "item": "3"}},
+		"/files/a/b.txt":             {Template: "/files/*path", Params: map[string]string{"path": "/a/b.txt"}},
+		"/":                          {Template: "/", Params: map[string]string{}},
+	} {
+		match, ok := router.Match(path)
+		assert.True(t, ok, path)
+		assert.Equal(t, expected, match, path)
+	}
+
+	for _, path := range []string{"/transactions", "/transactions/1/items", "/unknown"} {
+		match, ok := router.Match(path)
+		assert.False(t, ok, path)
+		assert.Equal(t, path, match.Template)
+	}
+}
+
+func TestRouteConflicts(t *testing.T) {
+	register := func(routes ...string) error {
+		router := NewRouter()
+		var err error
+		for _, v := range routes {
+			err = router.Register(&protocol.RequestDefinition{Route: v, Method: http.MethodGet}, "/base")
+		}
+		return err
+	}
+
+	assert.NoError(t, register("/:id", "/user/:id", "/:id/items"))
+	assert.ErrorContains(t, register("/:id", "/:id"), "registered twice")
+	assert.ErrorContains(t, register("/:id", "/:userId/items"), "/base/:id")
+	assert.ErrorContains(t, register("/items", "/items/"), "same paths")
+	assert.Error(t, register("/*path/items"))
+	assert.Error(t, register("/items", "/*path"))
+	assert.Error(t, register("/*path", "/:id"))
+
+	t.Run("Expect other methods of a route to be no conflict", func(t *testing.T) {
+		router := NewRouter()
+		assert.NoError(t, router.Register(&protocol.RequestDefinition{Route: "/:id", Method: http.MethodGet}, ""))
+		assert.NoError(t, router.Register(&protocol.RequestDefinition{Route: "/:id", Method: http.MethodDelete}, ""))
+	})
+}
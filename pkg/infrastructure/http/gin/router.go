@@ -1,6 +1,7 @@
 package gin
 
 import (
+	"fmt"
 	"net/http"
 
 	httpapi "github.com/nullexp/finman-api-gateway/pkg/infrastructure/http/protocol"
@@ -12,14 +13,24 @@ type Router struct {
 	RoutesPutMap    map[string]*httpapi.RequestDefinition
 	RoutesGetMap    map[string]*httpapi.RequestDefinition
 	RoutesDeleteMap map[string]*httpapi.RequestDefinition
+	RoutesPatchMap  map[string]*httpapi.RequestDefinition
+	tree            *routeNode
 }
 
 func NewRouter() *Router {
-	return &Router{Routes: []*httpapi.RequestDefinition{}, RoutesDeleteMap: map[string]*httpapi.RequestDefinition{}, RoutesGetMap: map[string]*httpapi.RequestDefinition{}, RoutesPutMap: map[string]*httpapi.RequestDefinition{}, RoutesPostMap: map[string]*httpapi.RequestDefinition{}}
+	return &Router{Routes: []*httpapi.RequestDefinition{}, RoutesDeleteMap: map[string]*httpapi.RequestDefinition{}, RoutesGetMap: map[string]*httpapi.RequestDefinition{}, RoutesPutMap: map[string]*httpapi.RequestDefinition{}, RoutesPostMap: map[string]*httpapi.RequestDefinition{}, RoutesPatchMap: map[string]*httpapi.RequestDefinition{}, tree: newRouteNode("")}
 }
 
-func (router *Router) Register(rt *httpapi.RequestDefinition, baseURL string) {
+// Register adds the route under the base URL. It fails when the route is registered twice for the
+// method or cannot be told apart from a route registered before.
+func (router *Router) Register(rt *httpapi.RequestDefinition, baseURL string) error {
 	fUrl := baseURL + rt.Route
+	if router.GetRoute(fUrl, rt.Method) != nil {
+		return fmt.Errorf("%s %s is registered twice", rt.Method, fUrl)
+	}
+	if err := router.tree.insert(fUrl); err != nil {
+		return err
+	}
 	switch rt.Method {
 	case "POST":
 		router.RoutesPostMap[fUrl] = rt
@@ -29,9 +40,22 @@ func (router *Router) Register(rt *httpapi.RequestDefinition, baseURL string) {
 		router.RoutesGetMap[fUrl] = rt
 	case "PUT":
 		router.RoutesPutMap[fUrl] = rt
+	case "PATCH":
+		router.RoutesPatchMap[fUrl] = rt
 	}
 
 	router.Routes = append(router.Routes, rt)
+	return nil
+}
+
+// Match finds the registered route the path falls on, whatever its method.
+func (router *Router) Match(path string) (RouteMatch, bool) {
+	params := map[string]string{}
+	node := router.tree.match(splitSegments(path), params)
+	if node == nil {
+		return RouteMatch{Template: path, Params: map[string]string{}}, false
+	}
+	return RouteMatch{Template: node.template, Params: params}, true
 }
 
 func (router *Router) GetRoutes() []*httpapi.RequestDefinition {
@@ -48,13 +72,38 @@ func (router *Router) GetRoute(route string, method httpapi.HTTPMethod) *httpapi
 		return router.RoutesGetMap[route]
 	case http.MethodPut:
 		return router.RoutesPutMap[route]
+	case http.MethodPatch:
+		return router.RoutesPatchMap[route]
+	case http.MethodHead:
+		// HEAD is answered by the GET definition
+		return router.RoutesGetMap[route]
 	}
-	panic(UnknownRoute)
+	return nil
 }
 
-const UnknownRoute = "Given route and method is not registred"
+// Allowed returns the methods the route answers, OPTIONS included.
+func (router *Router) Allowed(route string) []string {
+	out := []string{}
+	for _, method := range []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete} {
+		if router.GetRoute(route, httpapi.HTTPMethod(method)) != nil {
+			out = append(out, method)
+		}
+	}
+	if len(out) != 0 {
+		out = append(out, http.MethodOptions)
+	}
+	return out
+}
+
+// IsOptions reports whether the method only asks which methods a route allows, which needs no auth.
+func IsOptions(method httpapi.HTTPMethod) bool {
+	return method == http.MethodOptions
+}
 
 func (router *Router) IsFree(route string, method httpapi.HTTPMethod) bool {
+	if IsOptions(method) {
+		return true
+	}
 	r := router.GetRoute(route, method)
 	if r == nil {
 		return false
@@ -0,0 +1,46 @@
+package gin
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	httpapi "github.com/nullexp/finman-api-gateway/pkg/infrastructure/http/protocol"
+	"github.com/nullexp/finman-api-gateway/pkg/infrastructure/http/protocol/model"
+	"github.com/nullexp/finman-api-gateway/pkg/infrastructure/http/protocol/response"
+)
+
+const RouteTimedOut = "Route did not answer in time"
+
+// SetDefaultTimeout bounds the routes that set no timeout of their own, zero sets no deadline.
+func (ginApp *GinApp) SetDefaultTimeout(timeout time.Duration) {
+	ginApp.defaultTimeout = timeout
+}
+
+// TimeoutHandler puts the deadline of the matched route on the request context, so upstream calls made
+// with it are cut when the route times out or the client goes away. A route left without an answer by
+// its deadline gets 504.
+func (ginApp *GinApp) TimeoutHandler(c *gin.Context) {
+	definition := ginApp.router.GetRoute(ginApp.matchRoute(c).Template, httpapi.HTTPMethod(c.Request.Method))
+	if definition == nil {
+		return
+	}
+	timeout := definition.Timeout
+	if timeout == 0 {
+		timeout = ginApp.defaultTimeout
+	}
+	if timeout <= 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+	defer cancel()
+	c.Request = c.Request.WithContext(ctx)
+	c.Next()
+
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) && !c.Writer.Written() {
+		(&request{c}).setError(http.StatusGatewayTimeout, model.RequestError{Message: RouteTimedOut, Code: response.GatewayTimeout})
+	}
+}
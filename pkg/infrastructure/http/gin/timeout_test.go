@@ -0,0 +1,61 @@
+package gin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nullexp/finman-api-gateway/pkg/infrastructure/http/protocol"
+	"github.com/nullexp/finman-api-gateway/pkg/infrastructure/http/protocol/response"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimeout(t *testing.T) {
+	app := NewGinApp()
+	deadline := func(req protocol.Request) {
+		left := time.Duration(0)
+		if at, ok := req.Context().Deadline(); ok {
+			left = time.Until(at)
+		}
+		req.Negotiate(http.StatusOK, nil, map[string]any{"hasDeadline": left > 0, "underMinute": left > 0 && left < time.Minute})
+	}
+	app.AppendModule(NewTestModule("/test",
+		&protocol.RequestDefinition{Route: "/default", Method: http.MethodGet, FreeRoute: true, Handler: deadline},
+		&protocol.RequestDefinition{Route: "/own", Method: http.MethodGet, FreeRoute: true, Timeout: time.Second, Handler: deadline},
+		&protocol.RequestDefinition{Route: "/none", Method: http.MethodGet, FreeRoute: true, Timeout: -1, Handler: deadline},
+		&protocol.RequestDefinition{Route: "/hung", Method: http.MethodGet, FreeRoute: true, Timeout: 10 * time.Millisecond, Handler: func(req protocol.Request) {
+			<-req.Context().Done()
+		}},
+		&protocol.RequestDefinition{Route: "/answered", Method: http.MethodGet, FreeRoute: true, Timeout: 10 * time.Millisecond, Handler: func(req protocol.Request) {
+			<-req.Context().Done()
+			req.SetBadRequest(req.Context().Err().Error(), response.UnknownFormat)
+		}},
+	))
+	app.SetDefaultTimeout(time.Hour)
+	app.Init(gin.TestMode)
+
+	send := func(route string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, "/test"+route, nil)
+		_ = app.TestHandle(w, req)
+		return w
+	}
+
+	t.Run("Expect routes to get their deadline", func(t *testing.T) {
+		assert.JSONEq(t, `{"hasDeadline": true, "underMinute": false}`, send("/default").Body.String())
+		assert.JSONEq(t, `{"hasDeadline": true, "underMinute": true}`, send("/own").Body.String())
+		assert.JSONEq(t, `{"hasDeadline": false, "underMinute": false}`, send("/none").Body.String())
+	})
+
+	t.Run("Expect unanswered route to time out", func(t *testing.T) {
+		w := send("/hung")
+		assert.Equal(t, http.StatusGatewayTimeout, w.Code)
+		assert.Contains(t, w.Body.String(), response.GatewayTimeout)
+	})
+
+	t.Run("Expect answer of the handler to be kept", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, send("/answered").Code)
+	})
+}
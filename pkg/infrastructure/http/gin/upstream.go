@@ -0,0 +1,135 @@
+package gin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode"
+
+	errorProtocol "github.com/nullexp/finman-api-gateway/pkg/infrastructure/error/protocol"
+
+	"github.com/nullexp/finman-api-gateway/pkg/infrastructure/http/protocol/model"
+	"github.com/nullexp/finman-api-gateway/pkg/infrastructure/http/protocol/response"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// StatusClientClosedRequest is sent when the client went away, there is no standard status for it.
+const StatusClientClosedRequest = 499
+
+const (
+	upstreamErrorCause = "upstream status: %s, msg: %s"
+	// upstreamErrorCodePrefix names the error code of an upstream error that gives no reason
+	upstreamErrorCodePrefix = "generic.upstream."
+)
+
+var upstreamStatuses = map[codes.Code]struct {
+	status int
+	code   string
+}{
+	codes.Canceled:           {StatusClientClosedRequest, response.RequestCanceled},
+	codes.Unknown:            {http.StatusInternalServerError, response.ServerError},
+	codes.InvalidArgument:    {http.StatusBadRequest, response.ValidationError},
+	codes.DeadlineExceeded:   {http.StatusGatewayTimeout, response.GatewayTimeout},
+	codes.NotFound:           {http.StatusNotFound, response.NotFound},
+	codes.AlreadyExists:      {http.StatusConflict, response.Conflict},
+	codes.PermissionDenied:   {http.StatusForbidden, response.AccessDenied},
+	codes.ResourceExhausted:  {http.StatusTooManyRequests, response.TooManyRequests},
+	codes.FailedPrecondition: {http.StatusBadRequest, response.PreconditionFailed},
+	codes.Aborted:            {http.StatusConflict, response.Conflict},
+	codes.OutOfRange:         {http.StatusBadRequest, response.ValidationError},
+	codes.Unimplemented:      {http.StatusNotImplemented, response.NotImplemented},
+	codes.Internal:           {http.StatusInternalServerError, response.ServerError},
+	codes.Unavailable:        {http.StatusServiceUnavailable, response.ServiceUnavailable},
+	codes.DataLoss:           {http.StatusInternalServerError, response.ServerError},
+	codes.Unauthenticated:    {http.StatusUnauthorized, response.InvalidAuthInfo},
+}
+
+// UpstreamStatus translates the error of an upstream gRPC call to the http status and the response
+// code answering it. The code is always one of the gateway, the reason of an ErrorInfo detail is only
+// passed on in the ErrorDto. Errors that carry no gRPC status are server errors, unless they come from
+// the request context.
+func UpstreamStatus(err error) (int, string) {
+	out, ok := upstreamStatuses[upstreamStatus(err).Code()]
+	if !ok {
+		return http.StatusInternalServerError, response.ServerError
+	}
+	return out.status, out.code
+}
+
+func upstreamStatus(err error) *status.Status {
+	if st, ok := status.FromError(err); ok {
+		return st
+	}
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return status.FromContextError(err)
+	}
+	return status.New(codes.Unknown, err.Error())
+}
+
+// UpstreamError converts the error of an upstream gRPC call into an ErrorDto. Its code is the domain
+// and reason of an ErrorInfo detail, or else stands for the gRPC status, and every field violation of
+// a BadRequest detail becomes a FieldViolation. The message of a server error is left out.
+func UpstreamError(err error) errorProtocol.ErrorDto {
+	st := upstreamStatus(err)
+	status, _ := UpstreamStatus(err)
+	out := errorProtocol.ErrorDto{
+		ErrorCode:   errorProtocol.ErrorCode(upstreamErrorCodePrefix + toUpperSnake(st.Code().String())),
+		Description: st.Message(),
+		Type:        errorProtocol.ErrorTypeUserOperation,
+	}
+	switch {
+	case status >= http.StatusInternalServerError:
+		out.Description = errorProtocol.SystemErrorText
+		out.Type = errorProtocol.ErrorTypeSystemError
+	case st.Code() == codes.NotFound:
+		out.Type = errorProtocol.ErrorTypeNotFound
+	}
+
+	for _, v := range st.Details() {
+		switch detail := v.(type) {
+		case *errdetails.ErrorInfo:
+			if detail.GetReason() == "" {
+				continue
+			}
+			out.ErrorCode = errorProtocol.ErrorCode(detail.GetReason())
+			if detail.GetDomain() != "" {
+				out.ErrorCode = errorProtocol.ErrorCode(detail.GetDomain() + "." + detail.GetReason())
+			}
+		case *errdetails.BadRequest:
+			for _, violation := range detail.GetFieldViolations() {
+				out.Details = append(out.Details, errorProtocol.FieldViolation{Field: violation.GetField(), Description: violation.GetDescription()})
+			}
+		}
+	}
+	return out
+}
+
+// toUpperSnake turns the name of a gRPC code, such as NotFound, into NOT_FOUND.
+func toUpperSnake(name string) string {
+	out := strings.Builder{}
+	for i, v := range name {
+		if i != 0 && unicode.IsUpper(v) {
+			out.WriteByte('_')
+		}
+		out.WriteRune(unicode.ToUpper(v))
+	}
+	return out.String()
+}
+
+// SetUpstreamError answers with the status the error translates to and its ErrorDto. The message of the
+// upstream is passed on for client errors only, server errors are logged with it instead.
+func (req *request) SetUpstreamError(err error) {
+	code, responseCode := UpstreamStatus(err)
+	detail := UpstreamError(err)
+	st := upstreamStatus(err)
+	if code >= http.StatusInternalServerError {
+		e := model.RequestError{Message: ServerErrorOccurred, Code: responseCode, Detail: &detail}
+		req.setErrorWithCause(code, fmt.Sprintf(upstreamErrorCause, st.Code(), st.Message()), e)
+		return
+	}
+	req.setError(code, model.RequestError{Message: st.Message(), Code: responseCode, Detail: &detail})
+}
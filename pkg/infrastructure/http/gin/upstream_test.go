@@ -0,0 +1,159 @@
+package gin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	errorProtocol "github.com/nullexp/finman-api-gateway/pkg/infrastructure/error/protocol"
+	"github.com/nullexp/finman-api-gateway/pkg/infrastructure/http/protocol"
+	"github.com/nullexp/finman-api-gateway/pkg/infrastructure/http/protocol/model"
+	"github.com/nullexp/finman-api-gateway/pkg/infrastructure/http/protocol/response"
+	logger "github.com/nullexp/finman-api-gateway/pkg/infrastructure/log"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestUpstreamStatus(t *testing.T) {
+	for code, expected := range map[codes.Code]int{
+		codes.NotFound:           http.StatusNotFound,
+		codes.PermissionDenied:   http.StatusForbidden,
+		codes.Unauthenticated:    http.StatusUnauthorized,
+		codes.InvalidArgument:    http.StatusBadRequest,
+		codes.AlreadyExists:      http.StatusConflict,
+		codes.ResourceExhausted:  http.StatusTooManyRequests,
+		codes.Unavailable:        http.StatusServiceUnavailable,
+		codes.DeadlineExceeded:   http.StatusGatewayTimeout,
+		codes.Unimplemented:      http.StatusNotImplemented,
+		codes.Internal:           http.StatusInternalServerError,
+		codes.Canceled:           StatusClientClosedRequest,
+		codes.FailedPrecondition: http.StatusBadRequest,
+	} {
+		got, _ := UpstreamStatus(status.Error(code, "upstream"))
+		assert.Equal(t, expected, got, code.String())
+	}
+
+	t.Run("Expect reason of error info to be left out of the code", func(t *testing.T) {
+		st, err := status.New(codes.AlreadyExists, "taken").WithDetails(&errdetails.ErrorInfo{Reason: "USER_ALREADY_EXIST", Domain: "user"})
+		assert.NoError(t, err)
+		got, code := UpstreamStatus(st.Err())
+		assert.Equal(t, http.StatusConflict, got)
+		assert.Equal(t, response.Conflict, code)
+		assert.Equal(t, errorProtocol.ErrorCode("user.USER_ALREADY_EXIST"), UpstreamError(st.Err()).ErrorCode)
+	})
+
+	t.Run("Expect errors without status to be told apart", func(t *testing.T) {
+		got, code := UpstreamStatus(fmt.Errorf("calling: %w", context.DeadlineExceeded))
+		assert.Equal(t, http.StatusGatewayTimeout, got)
+		assert.Equal(t, response.GatewayTimeout, code)
+
+		got, code = UpstreamStatus(errors.New("broken"))
+		assert.Equal(t, http.StatusInternalServerError, got)
+		assert.Equal(t, response.ServerError, code)
+	})
+}
+
+func TestSetUpstreamError(t *testing.T) {
+	app := NewGinApp()
+	upstream := func(err error) protocol.Action {
+		return func(req protocol.Request) { req.SetUpstreamError(err) }
+	}
+	app.AppendModule(NewTestModule("/test",
+		&protocol.RequestDefinition{Route: "/missing", Method: http.MethodGet, FreeRoute: true, Handler: upstream(status.Error(codes.NotFound, "transaction 7 does not exist"))},
+		&protocol.RequestDefinition{Route: "/down", Method: http.MethodGet, FreeRoute: true, Handler: upstream(status.Error(codes.Unavailable, "dial tcp 10.0.0.7:8081: connection refused"))},
+	))
+	app.Init(gin.TestMode)
+
+	send := func(route string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, "/test"+route, nil)
+		_ = app.TestHandle(w, req)
+		return w
+	}
+
+	decode := func(w *httptest.ResponseRecorder) model.RequestError {
+		out := model.RequestError{}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &out))
+		return out
+	}
+
+	w := send("/missing")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	body := decode(w)
+	assert.Equal(t, "transaction 7 does not exist", body.Message)
+	assert.Equal(t, response.NotFound, body.Code)
+	assert.NotEmpty(t, body.Id)
+	assert.Equal(t, &errorProtocol.ErrorDto{Id: body.Id, ErrorCode: "generic.upstream.NOT_FOUND", Description: "transaction 7 does not exist", Type: errorProtocol.ErrorTypeNotFound}, body.Detail)
+
+	logged := &bytes.Buffer{}
+	logger.Error.SetOutput(logged)
+	defer logger.Error.SetOutput(os.Stderr)
+	w = send("/down")
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.NotContains(t, w.Body.String(), "10.0.0.7")
+	body = decode(w)
+	assert.Equal(t, response.ServiceUnavailable, body.Code)
+	assert.Equal(t, ServerErrorOccurred, body.Message)
+	assert.Equal(t, errorProtocol.ErrorTypeSystemError, body.Detail.Type)
+	assert.Equal(t, 1, strings.Count(logged.String(), body.Id))
+	assert.Contains(t, logged.String(), "10.0.0.7")
+}
+
+func TestSetServerError(t *testing.T) {
+	app := NewGinApp()
+	app.AppendModule(NewTestModule("/test", &protocol.RequestDefinition{Route: "/failed", Method: http.MethodGet, FreeRoute: true, Handler: func(req protocol.Request) {
+		req.SetServerError("pq: relation users does not exist")
+	}}))
+	app.Init(gin.TestMode)
+
+	logged := &bytes.Buffer{}
+	logger.Error.SetOutput(logged)
+	defer logger.Error.SetOutput(os.Stderr)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/test/failed", nil)
+	_ = app.TestHandle(w, req)
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.NotContains(t, w.Body.String(), "pq:")
+	assert.Contains(t, w.Body.String(), ServerErrorOccurred)
+	assert.Contains(t, logged.String(), "pq: relation users does not exist")
+}
+
+func TestUpstreamError(t *testing.T) {
+	st, err := status.New(codes.InvalidArgument, "invalid user").WithDetails(
+		&errdetails.ErrorInfo{Reason: "INVALID_USER", Domain: "user"},
+		&errdetails.BadRequest{FieldViolations: []*errdetails.BadRequest_FieldViolation{
+			{Field: "username", Description: "must not be empty"},
+			{Field: "roleId", Description: "unknown role"},
+		}},
+	)
+	assert.NoError(t, err)
+
+	assert.Equal(t, errorProtocol.ErrorDto{
+		ErrorCode:   "user.INVALID_USER",
+		Description: "invalid user",
+		Type:        errorProtocol.ErrorTypeUserOperation,
+		Details: []any{
+			errorProtocol.FieldViolation{Field: "username", Description: "must not be empty"},
+			errorProtocol.FieldViolation{Field: "roleId", Description: "unknown role"},
+		},
+	}, UpstreamError(st.Err()))
+
+	t.Run("Expect server errors to hide their message", func(t *testing.T) {
+		dto := UpstreamError(status.Error(codes.Internal, "pq: relation users does not exist"))
+		assert.Equal(t, errorProtocol.ErrorCode("generic.upstream.INTERNAL"), dto.ErrorCode)
+		assert.Equal(t, errorProtocol.SystemErrorText, dto.Description)
+	})
+
+	assert.Equal(t, "DEADLINE_EXCEEDED", toUpperSnake(codes.DeadlineExceeded.String()))
+}
@@ -0,0 +1,142 @@
+package gin
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	httpapi "github.com/nullexp/finman-api-gateway/pkg/infrastructure/http/protocol"
+	"github.com/nullexp/finman-api-gateway/pkg/infrastructure/http/protocol/response"
+)
+
+const (
+	AcceptVersion      = "Accept-Version"
+	Deprecation        = "Deprecation"
+	Sunset             = "Sunset"
+	UnknownVersionName = "Unknown version "
+)
+
+func moduleVersion(module httpapi.Module) (httpapi.Version, bool) {
+	versioned, ok := module.(httpapi.VersionedModule)
+	if !ok {
+		return httpapi.Version{}, false
+	}
+	return versioned.GetVersion(), true
+}
+
+// moduleBaseURL returns the base URL the routes of the module are mounted at, under the version of
+// a versioned module.
+func moduleBaseURL(module httpapi.Module) string {
+	if version, ok := moduleVersion(module); ok {
+		return "/" + version.Name + module.GetBaseURL()
+	}
+	return module.GetBaseURL()
+}
+
+// initVersions collects the versions the modules declare, a version must be declared alike by all.
+func (ginApp *GinApp) initVersions(r *gin.Engine) {
+	ginApp.versions = map[string]httpapi.Version{}
+	for _, module := range ginApp.ginDomainHandlers {
+		version, ok := moduleVersion(module)
+		if !ok {
+			continue
+		}
+		if version.Name == "" || strings.Contains(version.Name, "/") {
+			panic("invalid version name \"" + version.Name + "\" is detected")
+		}
+		if declared, ok := ginApp.versions[version.Name]; ok && (!declared.Deprecation.Equal(version.Deprecation) || !declared.Sunset.Equal(version.Sunset)) {
+			panic("version " + version.Name + " is declared differently by two modules")
+		}
+		ginApp.versions[version.Name] = version
+	}
+	if len(ginApp.versions) != 0 {
+		r.Use(ginApp.VersionHandler)
+	}
+}
+
+// routeVersion returns the version the route is mounted under.
+func (ginApp *GinApp) routeVersion(route string) (httpapi.Version, bool) {
+	segments := splitSegments(route)
+	if len(segments) == 0 {
+		return httpapi.Version{}, false
+	}
+	version, ok := ginApp.versions[segments[0]]
+	return version, ok
+}
+
+// unversioned returns the route without its version, authenticators, authorizers and pre handlers
+// being registered for the base URL of a module whatever its version.
+func (ginApp *GinApp) unversioned(route string) string {
+	if version, ok := ginApp.routeVersion(route); ok {
+		return strings.TrimPrefix(route, "/"+version.Name)
+	}
+	return route
+}
+
+// versionName returns the version the Accept-Version header names, with its "v" prefix.
+func versionName(header string) string {
+	if header != "" && !strings.HasPrefix(header, "v") {
+		return "v" + header
+	}
+	return header
+}
+
+// versionedPath returns the path of the route of the version the request asks for by the Accept-Version
+// header, when the path names no version itself and the route has one. The request is routed by it,
+// so it runs the middleware of the engine once.
+func (ginApp *GinApp) versionedPath(r *http.Request) (string, bool) {
+	name := versionName(r.Header.Get(AcceptVersion))
+	if _, ok := ginApp.versions[name]; !ok {
+		return "", false
+	}
+	if _, ok := ginApp.routeVersion(r.URL.Path); ok {
+		return "", false
+	}
+	path := "/" + name + r.URL.Path
+	if _, ok := ginApp.router.Match(path); !ok {
+		// the route is not versioned, the unversioned one answers
+		return "", false
+	}
+	return path, true
+}
+
+// ServeHTTP serves the request by the engine, a request asking for a version by the Accept-Version
+// header being served by the route of that version.
+func (ginApp *GinApp) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if path, ok := ginApp.versionedPath(r); ok {
+		url := *r.URL
+		url.Path = path
+		url.RawPath = ""
+		r = r.WithContext(r.Context())
+		r.URL = &url
+	}
+	ginApp.gin.ServeHTTP(w, r)
+}
+
+// VersionHandler refuses a request asking for a version that does not exist by the Accept-Version
+// header, when the path names no version itself. Known versions are routed by ServeHTTP.
+func (ginApp *GinApp) VersionHandler(c *gin.Context) {
+	name := versionName(c.GetHeader(AcceptVersion))
+	if name == "" {
+		return
+	}
+	if _, ok := ginApp.routeVersion(c.Request.URL.Path); ok {
+		return
+	}
+	if _, ok := ginApp.versions[name]; !ok {
+		NewRequest(c).SetBadRequest(UnknownVersionName+name, response.UnsupportedVersion)
+	}
+}
+
+// setDeprecation tells the clients of a deprecated version since when it is deprecated, RFC 9745,
+// and when it goes away, RFC 8594.
+func setDeprecation(c *gin.Context, version httpapi.Version) {
+	if !version.IsDeprecated() {
+		return
+	}
+	c.Header(Deprecation, "@"+strconv.FormatInt(version.Deprecation.Unix(), 10))
+	if !version.Sunset.IsZero() {
+		c.Header(Sunset, version.Sunset.UTC().Format(http.TimeFormat))
+	}
+}
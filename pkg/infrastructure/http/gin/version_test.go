@@ -0,0 +1,149 @@
+package gin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/nullexp/finman-api-gateway/pkg/infrastructure/http/protocol"
+	"github.com/nullexp/finman-api-gateway/pkg/infrastructure/http/protocol/model/openapi"
+	"github.com/stretchr/testify/assert"
+)
+
+type testVersionedModule struct {
+	*testModule
+	version protocol.Version
+}
+
+func (tm testVersionedModule) GetVersion() protocol.Version {
+	return tm.version
+}
+
+func newVersionModule(version protocol.Version, answer int) protocol.Module {
+	module := NewTestModuleWithTag("/items", openapi.Tag{Name: "items"}, &protocol.RequestDefinition{
+		Route:  "",
+		Method: http.MethodGet,
+		Handler: func(req protocol.Request) {
+			req.Negotiate(http.StatusOK, nil, map[string]int{"version": answer})
+		},
+	})
+	if version.Name == "" {
+		return module
+	}
+	return testVersionedModule{testModule: module, version: version}
+}
+
+func TestVersions(t *testing.T) {
+	deprecation := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	sunset := time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	app := NewGinApp()
+	app.SetInfo(openapi.Info{Version: "1.0.0", Title: "title"})
+	app.AppendModule(newVersionModule(protocol.Version{}, 0))
+	app.AppendModule(newVersionModule(protocol.Version{Name: "v1", Deprecation: deprecation, Sunset: sunset}, 1))
+	app.AppendModule(newVersionModule(protocol.Version{Name: "v2"}, 2))
+	info := TokenInfo{ExpireTime: time.Now().Add(time.Hour).Unix(), Subject: "1", Identity: uuid.NewString()}
+	app.AppendAuthenticator("/items", NewOkTestAuthenticatorWithToken(info))
+	calls := 0
+	app.AppendPreHandlers("/items", func(req protocol.Request) { calls++ })
+	assert.NoError(t, app.EnableOpenApi("/openapi"))
+	app.Init(gin.TestMode)
+
+	send := func(route, version string, authenticated bool) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, route, nil)
+		if version != "" {
+			req.Header.Set(AcceptVersion, version)
+		}
+		if authenticated {
+			req.Header.Add(Authorization, "Bearer somerandomText")
+		}
+		_ = app.TestHandle(w, req)
+		return w
+	}
+
+	t.Run("Expect versions to run side by side", func(t *testing.T) {
+		for route, expected := range map[string]string{"/items": `{"version": 0}`, "/v1/items": `{"version": 1}`, "/v2/items": `{"version": 2}`} {
+			w := send(route, "", true)
+			assert.Equal(t, http.StatusOK, w.Code, route)
+			assert.JSONEq(t, expected, w.Body.String(), route)
+		}
+	})
+
+	t.Run("Expect Accept-Version to pick the version", func(t *testing.T) {
+		w := send("/items", "v2", true)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"version": 2}`, w.Body.String())
+
+		w = send("/items", "1", true)
+		assert.JSONEq(t, `{"version": 1}`, w.Body.String())
+
+		w = send("/v2/items", "v1", true)
+		assert.JSONEq(t, `{"version": 2}`, w.Body.String())
+
+		assert.Equal(t, http.StatusBadRequest, send("/items", "v3", true).Code)
+	})
+
+	t.Run("Expect Accept-Version to be routed once", func(t *testing.T) {
+		calls = 0
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, "/items", nil)
+		req.Header.Set(AcceptVersion, "v1")
+		req.Header.Add(Authorization, "Bearer somerandomText")
+		_ = app.TestHandle(w, req)
+		assert.JSONEq(t, `{"version": 1}`, w.Body.String())
+		assert.Equal(t, 1, calls)
+		assert.Equal(t, "/items", req.URL.Path)
+	})
+
+	t.Run("Expect deprecated version to tell its dates", func(t *testing.T) {
+		w := send("/items", "v1", true)
+		assert.Equal(t, "@1767225600", w.Header().Get(Deprecation))
+		assert.Equal(t, "Fri, 01 Jan 2027 00:00:00 GMT", w.Header().Get(Sunset))
+
+		w = send("/v2/items", "", true)
+		assert.Empty(t, w.Header().Get(Deprecation))
+		assert.Empty(t, w.Header().Get(Sunset))
+	})
+
+	t.Run("Expect authenticators of the base url to cover every version", func(t *testing.T) {
+		assert.Equal(t, http.StatusUnauthorized, send("/v1/items", "", false).Code)
+		assert.Equal(t, http.StatusUnauthorized, send("/items", "v2", false).Code)
+	})
+
+	t.Run("Expect one open api document per version", func(t *testing.T) {
+		paths := func(version string) map[string]map[string]any {
+			w := send(OpenApiRoute+"?version="+version, "", false)
+			assert.Equal(t, http.StatusOK, w.Code)
+			document := map[string]any{}
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &document))
+			out := map[string]map[string]any{}
+			for k, v := range document[Paths].(map[string]any) {
+				out[k] = v.(map[string]any)
+			}
+			return out
+		}
+
+		assert.Contains(t, paths(""), "/items")
+		assert.NotContains(t, paths(""), "/v1/items")
+
+		v1 := paths("v1")
+		assert.Len(t, v1, 1)
+		assert.Equal(t, true, v1["/v1/items"]["get"].(map[string]any)[Deprecated])
+		assert.Nil(t, paths("v2")["/v2/items"]["get"].(map[string]any)[Deprecated])
+
+		assert.Equal(t, http.StatusNotFound, send(OpenApiRoute+"?version=v3", "", false).Code)
+		assert.JSONEq(t, `["v1", "v2"]`, send(OpenApiVersionsRoute, "", false).Body.String())
+	})
+}
+
+func TestVersionDeclarations(t *testing.T) {
+	app := NewGinApp()
+	app.AppendModule(newVersionModule(protocol.Version{Name: "v1"}, 1))
+	app.AppendModule(testVersionedModule{testModule: NewTestModule("/others"), version: protocol.Version{Name: "v1", Deprecation: time.Now()}})
+	assert.Panics(t, func() { app.Init(gin.TestMode) })
+}
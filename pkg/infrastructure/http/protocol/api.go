@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"net/textproto"
+	"time"
 
 	fileProtocol "github.com/nullexp/finman-api-gateway/pkg/infrastructure/file/protocol"
 	"github.com/nullexp/finman-api-gateway/pkg/infrastructure/http/protocol/model"
@@ -21,10 +22,22 @@ type (
 		AppendPreHandlers(string, Action)
 		GetRoute(url, method string) *RequestDefinition
 		AppendAuthorizer(baseURL string, authorizer Authorizer)
+		AppendBatchAuthorizer(baseURL string, authorizer BatchAuthorizer)
 		AppendAuthenticator(baseURL string, authorizer Authenticator)
+		AppendSchemeAuthenticator(baseURL, scheme string, authenticator Authenticator)
+		DisableAuth(baseURL string)
+		SetRevocationList(RevocationList)
+		SetClaimsPolicy(misc.ClaimsPolicy)
 		SetCors(cors []string)
 		SetLogHandler(LogHandler)
 		SetLogPolicy(model.LogPolicy)
+		SetAuditHandler(AuditHandler)
+		SetOwnerResolver(OwnerResolver)
+		SetPolicyFile(path string, reloadEvery time.Duration)
+		SetDefaultTimeout(time.Duration)
+		SetForwardedHeaders([]string)
+		SetTrustedProxies([]string)
+		PermissionCatalog
 		TestHandle(*httptest.ResponseRecorder, *http.Request) error
 		// OpenAPI
 		SetExternalDocs(openapi.ExternalDocs)
@@ -35,23 +48,56 @@ type (
 		SetErrors([]string)
 	}
 
+	// PermissionCatalog lists the permissions the registered routes require
+	PermissionCatalog interface {
+		GetPermissionCatalog() []model.PermissionCatalogEntry
+	}
+
 	LogHandler interface {
 		Handle(model.HttpLog)
 	}
 
+	// AuditHandler receives the audit trail of impersonated requests
+	AuditHandler interface {
+		Handle(model.AuditLog)
+	}
+
 	Module interface {
 		GetRequestHandlers() []*RequestDefinition
 		GetBaseURL() string
 		GetTag() openapi.Tag
 	}
 
+	// VersionedModule is a module served under its version, at /<version><base url> or at the base url
+	// when the Accept-Version header names the version. Versions of a module run side by side.
+	VersionedModule interface {
+		Module
+		GetVersion() Version
+	}
+
+	// Version names a version of the api, like v1. A deprecated version keeps answering, telling
+	// clients since when it is deprecated and when it goes away.
+	Version struct {
+		Name        string
+		Deprecation time.Time // zero while the version is not deprecated
+		Sunset      time.Time // zero when no removal date is set
+	}
+
 	Request interface {
+		// Context is done when the client goes away or the timeout of the route passes, upstream calls
+		// should be made with it
+		Context() context.Context
 		// GetJson and other stuff
+		// SetServerError answers with a generic message, msg is only logged
 		SetServerError(msg string)
 		SetForbidden()
 		SetUnauthorized(msg string, code string)
 		SetBadRequest(msg string, code string)
 		SetNotFound(msg string, code string)
+		SetTooManyRequests(msg string, code string, retryAfter time.Duration)
+		// SetUpstreamError answers with the http status and response code the error of an upstream call
+		// translates to
+		SetUpstreamError(err error)
 		ReturnStatus(int, error)
 		Set(key string, value interface{})
 		SetFile(key string, f FileHeader)
@@ -60,6 +106,8 @@ type (
 		MustGet(key string) interface{}
 		GetDTO() (interface{}, bool)
 		MustGetDTO() interface{}
+		GetPatch() (Patch, bool)
+		MustGetPatch() Patch
 		GetFile(partName string) (FileHeader, bool)
 		MustGetFile(partName string) FileHeader
 		GetFiles(partName string) ([]FileHeader, bool)
@@ -76,14 +124,29 @@ type (
 		GetQuery() []misc.Query
 		GetDefaultQuery() (string, bool)
 		IsAndQuery() bool
+		GetHeader(key string) string
+		SetHeader(key, value string)
+		GetClientIP() string
 	}
 
 	Verifier interface {
 		Validate(context.Context) error
 	}
 
-	Action     func(req Request)
-	Authorizer func(identity string, permission string) (bool, error)
+	// Patch is the body of a PATCH request, a JSON Merge Patch or a JSON Patch. Apply patches the JSON
+	// form of target, a pointer to the current state of the resource, and validates it with ctx when it
+	// is a Verifier.
+	Patch interface {
+		Apply(ctx context.Context, target any) error
+	}
+
+	Action func(req Request)
+	// Authorizer decides a permission of the identity, ctx being the context of the request
+	Authorizer func(ctx context.Context, identity string, permission string) (bool, error)
+	// OwnerResolver returns the id ownership rules compare with, such as the user id inside the subject
+	OwnerResolver func(claim misc.JwtClaim) (string, error)
+	// BatchAuthorizer decides several permissions at once, the result holds every asked permission
+	BatchAuthorizer func(ctx context.Context, identity string, permissions []string) (map[string]bool, error)
 
 	MultipartDefinition interface {
 		IsOptional() bool
@@ -127,6 +190,11 @@ const (
 	KeyQuery = "Query"
 	KeyAuth  = "Auth"
 	KeyDTO   = "DTO"
+	KeyPatch = "Patch"
 	KeyFile  = "File"
 	MaxLimit = "MaxLimit"
 )
+
+func (v Version) IsDeprecated() bool {
+	return !v.Deprecation.IsZero()
+}
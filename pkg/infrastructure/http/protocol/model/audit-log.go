@@ -0,0 +1,15 @@
+package model
+
+import "time"
+
+// AuditLog is written for every request made with an impersonation token.
+type AuditLog struct {
+	Time    time.Time
+	Actor   string // the admin acting as Subject
+	Subject string
+	IP      string
+	Method  string
+	Path    string
+	Route   string
+	Status  uint
+}
@@ -33,8 +33,8 @@ func (f *DataDefinition) IsOptional() bool {
 	return f.Optional
 }
 
-func (f *DataDefinition) Validate(context.Context) error {
-	return f.Object.Validate(context.Background())
+func (f *DataDefinition) Validate(ctx context.Context) error {
+	return f.Object.Validate(ctx)
 }
 
 const UnknownData = "unknown data"
@@ -0,0 +1,18 @@
+package model
+
+const (
+	RequireAny = "any" // the route needs this permission or another one of its list
+	RequireAll = "all" // the route needs this permission whatever else it needs
+)
+
+// PermissionCatalogEntry is a permission the routes require, with the routes requiring it.
+type PermissionCatalogEntry struct {
+	Permission string            `json:"permission"`
+	Routes     []PermissionRoute `json:"routes"`
+}
+
+type PermissionRoute struct {
+	Method      string `json:"method"`
+	Route       string `json:"route"`
+	Requirement string `json:"requirement"` // RequireAny or RequireAll
+}
@@ -0,0 +1,20 @@
+package model
+
+import errorProtocol "github.com/nullexp/finman-api-gateway/pkg/infrastructure/error/protocol"
+
+// Problem is an error in the problem details format of RFC 7807, sent to clients accepting
+// application/problem+json.
+type Problem struct {
+	// Type is a URI naming the kind of problem, it ends with the code
+	Type string `json:"type" description:"URI naming the kind of problem"`
+	// Title is the text of the http status
+	Title  string `json:"title" description:"short summary of the kind of problem"`
+	Status int    `json:"status" description:"http status of the response"`
+	// Detail is the message of the RequestError
+	Detail   string `json:"detail,omitempty" description:"explanation of this occurrence, for developer consumption only"`
+	Instance string `json:"instance,omitempty" description:"path of the request that failed"`
+	Code     string `json:"code" description:"error code to evaluate"`
+	// TraceId is the id of the error in the gateway logs
+	TraceId string                  `json:"traceId" description:"id of the error in the gateway logs"`
+	Error   *errorProtocol.ErrorDto `json:"error,omitempty" description:"stable error code and per-field details of the failed operation"`
+}
@@ -1,9 +1,15 @@
 package model
 
+import errorProtocol "github.com/nullexp/finman-api-gateway/pkg/infrastructure/error/protocol"
+
 // RequestError is used to inform clients from their action errors.
 type RequestError struct {
+	// Id names the error in the logs of the gateway, clients report it to support
+	Id string `json:"id" description:"id of the error in the gateway logs"`
 	// Message is details of the error
 	Message string `json:"message" description:"details of the error, for developer consumption only"`
 	// Code is based on <<Response Rules>> , Refer to authn and authz docs.
 	Code string `json:"code" description:"error code to evaluate"`
+	// Detail is the structured error of the operation when it has one
+	Detail *errorProtocol.ErrorDto `json:"detail,omitempty" description:"stable error code and per-field details of the failed operation"`
 }
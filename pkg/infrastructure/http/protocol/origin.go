@@ -0,0 +1,33 @@
+package protocol
+
+import (
+	"context"
+	"net/http"
+)
+
+// Origin describes the request a handler serves, so the services it calls know who calls and can
+// correlate their logs with the gateway. The api puts it on the request context.
+type Origin struct {
+	Subject   string // empty on free routes
+	Actor     string // subject acting on behalf of Subject, empty when nobody acts
+	TokenId   string // jti of the token
+	RequestId string
+	ClientIP  string
+	// IdempotencyKey is the key the client sent to have the request done once however often it is
+	// sent, the calls made for it can be retried safely
+	IdempotencyKey string
+	Headers        http.Header // inbound headers allowed to be forwarded
+}
+
+type originKey struct{}
+
+// WithOrigin returns a copy of ctx carrying the origin.
+func WithOrigin(ctx context.Context, origin Origin) context.Context {
+	return context.WithValue(ctx, originKey{}, origin)
+}
+
+// OriginFrom returns the origin ctx carries.
+func OriginFrom(ctx context.Context) (Origin, bool) {
+	origin, ok := ctx.Value(originKey{}).(Origin)
+	return origin, ok
+}
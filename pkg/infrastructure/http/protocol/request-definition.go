@@ -1,5 +1,10 @@
 package protocol
 
+import (
+	"strings"
+	"time"
+)
+
 type RequestDefinition struct {
 	Route          string
 	Parameters     []RequestParameter
@@ -10,8 +15,16 @@ type RequestDefinition struct {
 	Handler        Action
 	MaxLimit       int
 	Method         HTTPMethod
-	AnyPermissions []string
-	FreeRoute      bool // Free route require neither authentication nor authorization
+	AnyPermissions []string // the caller needs at least one of these
+	AllPermissions []string // the caller needs every one of these, on top of AnyPermissions
+	FreeRoute      bool     // Free route require neither authentication nor authorization
+	// Ownership lets the owner of the resource in without the permissions above
+	Ownership *OwnershipRule
+	// Impersonation tokens may only read, unless the route allows them explicitly
+	AllowImpersonation bool
+	// Timeout bounds the context of the request, zero takes the default timeout of the app and a
+	// negative one sets no deadline
+	Timeout time.Duration
 
 	// Specific for Swagger
 	Summary             string
@@ -21,4 +34,24 @@ type RequestDefinition struct {
 	ResponseDefinitions []ResponseDefinition
 }
 
+// OwnershipRule declares who owns the resource of a route. The caller owns it when its owner id equals
+// the path param, or the field of the JSON response. Everyone else needs the permissions of the route,
+// a route without permissions is then closed to them.
+type OwnershipRule struct {
+	PathParam     string `json:"pathParam,omitempty"`
+	ResponseField string `json:"responseField,omitempty"` // dotted path into the response body, such as transaction.userId
+}
+
 type HTTPMethod string
+
+// RouteScope is the scope letting a scoped claim call a route that requires no permission, such as
+// "GET:/users/me/permissions". It holds no space, token scopes being separated by spaces.
+func RouteScope(method HTTPMethod, route string) string {
+	return string(method) + ":" + route
+}
+
+// IsRouteScope reports whether the scope names a route instead of a permission.
+func IsRouteScope(scope string) bool {
+	_, route, ok := strings.Cut(scope, ":")
+	return ok && strings.HasPrefix(route, "/")
+}
@@ -24,6 +24,40 @@ const (
 	// MalformMultipart indicate client send malformed multipart form data.
 	MalformMultipart = "MalformMultipart"
 	AccessDenied     = "AccessDenied"
+	// InvalidRefreshToken explaining a refresh token is unknown or expired.
+	InvalidRefreshToken = "InvalidRefreshToken"
+	// RefreshTokenReused explaining an already used refresh token was presented and its family is revoked.
+	RefreshTokenReused = "RefreshTokenReused"
+	// SessionRevoked explaining that client token was revoked by logout or an admin.
+	SessionRevoked = "SessionRevoked"
+	// TokenNotYetValid explaining that client token nbf claim is in the future.
+	TokenNotYetValid = "TokenNotYetValid"
+	// TokenIssuedInFuture explaining that client token iat claim is in the future.
+	TokenIssuedInFuture = "TokenIssuedInFuture"
+	// InvalidIssuer explaining that client token is issued by an untrusted issuer.
+	InvalidIssuer = "InvalidIssuer"
+	// InvalidAudience explaining that client token is minted for another audience.
+	InvalidAudience = "InvalidAudience"
+	// TooManyAttempts explaining a username or client is locked out after failed logins.
+	TooManyAttempts = "TooManyAttempts"
+	// InvalidPatch explaining a patch is malformed, its test operation failed or it leaves the resource invalid.
+	InvalidPatch = "InvalidPatch"
+	// UnsupportedVersion explaining the Accept-Version header names a version no module serves.
+	UnsupportedVersion = "UnsupportedVersion"
+	// GatewayTimeout explaining the route did not answer before its timeout.
+	GatewayTimeout = "GatewayTimeout"
+	// Conflict explaining the resource already exists or changed during the operation.
+	Conflict = "Conflict"
+	// PreconditionFailed explaining the resource is not in a state the operation needs.
+	PreconditionFailed = "PreconditionFailed"
+	// TooManyRequests explaining an upstream quota of the client ran out.
+	TooManyRequests = "TooManyRequests"
+	// RequestCanceled explaining the client went away before the operation finished.
+	RequestCanceled = "RequestCanceled"
+	// NotImplemented explaining the upstream service does not offer the operation.
+	NotImplemented = "NotImplemented"
+	// ServiceUnavailable explaining an upstream service can not be reached, the request may be retried.
+	ServiceUnavailable = "ServiceUnavailable"
 )
 
 func GetErrors() []string {
@@ -40,5 +74,22 @@ func GetErrors() []string {
 		NotFound,
 		MalformMultipart,
 		AccessDenied,
+		InvalidRefreshToken,
+		RefreshTokenReused,
+		SessionRevoked,
+		TokenNotYetValid,
+		TokenIssuedInFuture,
+		InvalidIssuer,
+		InvalidAudience,
+		TooManyAttempts,
+		InvalidPatch,
+		UnsupportedVersion,
+		GatewayTimeout,
+		Conflict,
+		PreconditionFailed,
+		TooManyRequests,
+		RequestCanceled,
+		NotImplemented,
+		ServiceUnavailable,
 	}
 }
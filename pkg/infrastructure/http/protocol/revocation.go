@@ -0,0 +1,10 @@
+package protocol
+
+import "github.com/nullexp/finman-api-gateway/pkg/infrastructure/misc"
+
+// RevocationList is consulted after a token is authenticated, so tokens can be
+// rejected before they expire. Entries are keyed by the token identity (jti).
+type RevocationList interface {
+	Revoke(identity string, expiresAt int64) error
+	IsRevoked(claim misc.JwtClaim) (bool, error)
+}
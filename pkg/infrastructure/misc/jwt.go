@@ -1,9 +1,19 @@
 package misc
 
 import (
+	"errors"
+	"slices"
 	"time"
 )
 
+var (
+	ErrTokenExpired        = errors.New("token is expired")
+	ErrTokenNotYetValid    = errors.New("token is not valid yet")
+	ErrTokenIssuedInFuture = errors.New("token is issued in the future")
+	ErrInvalidIssuer       = errors.New("token issuer is not accepted")
+	ErrInvalidAudience     = errors.New("token audience is not accepted")
+)
+
 type Claims interface {
 	Valid() error
 }
@@ -15,9 +25,65 @@ type JwtClaim interface {
 	GetAudience() []string
 	GetIssuedAt() int64
 	GetIdentity() string
+	GetNotBefore() int64
 	IsExpired() bool
 }
 
+// ScopedClaim is a claim that grants only a subset of the permissions of its subject, such as the claim of an api key.
+type ScopedClaim interface {
+	JwtClaim
+	GetScopes() []string
+}
+
+// ActingClaim is a claim of a token one subject uses on behalf of another, GetActor is empty when nobody acts.
+type ActingClaim interface {
+	JwtClaim
+	GetActor() string
+}
+
+// SessionClaim is a claim of a token minted for a login session, GetSessionId is empty for tokens of no
+// session.
+type SessionClaim interface {
+	JwtClaim
+	GetSessionId() string
+}
+
+// ClaimsPolicy describes the registered claims a token must satisfy. Empty Issuers or
+// Audiences accept any value, Leeway tolerates clock skew between the issuer and us.
+type ClaimsPolicy struct {
+	Issuers   []string
+	Audiences []string
+	Leeway    time.Duration
+}
+
+// Validate checks exp, nbf, iat, iss and aud in that order and returns the first failure.
+func (p ClaimsPolicy) Validate(c JwtClaim) error {
+	now := time.Now().Unix()
+	leeway := int64(p.Leeway / time.Second)
+
+	if now > c.GetExpireTime()+leeway {
+		return ErrTokenExpired
+	}
+	if nbf := c.GetNotBefore(); nbf != 0 && now+leeway < nbf {
+		return ErrTokenNotYetValid
+	}
+	if iat := c.GetIssuedAt(); iat != 0 && now+leeway < iat {
+		return ErrTokenIssuedInFuture
+	}
+	if len(p.Issuers) != 0 && !slices.Contains(p.Issuers, c.GetIssuer()) {
+		return ErrInvalidIssuer
+	}
+	if len(p.Audiences) != 0 {
+		for _, v := range c.GetAudience() {
+			if slices.Contains(p.Audiences, v) {
+				return nil
+			}
+		}
+		return ErrInvalidAudience
+	}
+	return nil
+}
+
 func NewValidJwtClaim() JwtClaim {
 	return StandardClaims{ExpiresAt: time.Now().Add(10 * time.Minute).Unix()}
 }
@@ -33,7 +99,7 @@ type StandardClaims struct {
 }
 
 func (c StandardClaims) Valid() error {
-	return nil
+	return ClaimsPolicy{}.Validate(c)
 }
 
 func (c StandardClaims) GetExpireTime() int64 {
@@ -60,6 +126,10 @@ func (c StandardClaims) GetIdentity() string {
 	return c.Identity
 }
 
+func (c StandardClaims) GetNotBefore() int64 {
+	return c.NotBefore
+}
+
 func (c StandardClaims) IsExpired() bool {
 	return time.Now().Unix() > c.ExpiresAt
 }